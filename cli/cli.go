@@ -0,0 +1,148 @@
+// Package cli implements the snickers commands driving the API of
+// a Snickers server, and the one encoding files without a server.
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/snickers/snickers/client"
+)
+
+// errUsage is returned by commands called with the wrong arguments,
+// after they printed how to call them
+var errUsage = errors.New("usage")
+
+// command runs a command with the arguments following its name
+type command func(env *environment, args []string) error
+
+// environment is where commands write to
+type environment struct {
+	stdout io.Writer
+	stderr io.Writer
+}
+
+const usage = `Usage: snickers <command> [arguments]
+
+Commands:
+  server                                run the API server (default)
+  worker                                run the jobs queued by the API servers
+  preset create|update <file.json>      create or update a preset
+  preset list                           list the presets
+  preset get|delete <name>              show or delete a preset
+  job create [flags] [file.json]        create a job and print its ID
+  job start|status|wait|cancel <id>     start, show, wait for or cancel a job
+  job list [flags]                      list the jobs
+  encode -preset <file.json> <source>   encode a file without a server
+
+API commands talk to SNICKERS_URL (http://localhost:8000 by default)
+with the SNICKERS_API_KEY, if set. Their -url and -api-key flags
+override these.
+`
+
+// Run runs the command named by the first argument and returns
+// the exit status
+func Run(args []string, stdout io.Writer, stderr io.Writer) int {
+	env := &environment{stdout: stdout, stderr: stderr}
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	commands := map[string]command{
+		"preset": runPreset,
+		"job":    runJob,
+		"encode": runEncode,
+	}
+
+	var err error
+	switch run, ok := commands[args[0]]; {
+	case ok:
+		err = run(env, args[1:])
+	case args[0] == "help" || args[0] == "-h" || args[0] == "--help":
+		fmt.Fprint(stdout, usage)
+	default:
+		fmt.Fprintf(stderr, "snickers: unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+
+	if err == errUsage {
+		return 2
+	} else if err != nil {
+		fmt.Fprintf(stderr, "snickers: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runSubcommand runs the subcommand named by the first argument
+func runSubcommand(env *environment, name string, subcommands map[string]command, args []string) error {
+	if len(args) > 0 {
+		if run, ok := subcommands[args[0]]; ok {
+			return run(env, args[1:])
+		}
+	}
+
+	names := []string{}
+	for subcommand := range subcommands {
+		names = append(names, subcommand)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(env.stderr, "Usage: snickers %s %s\n", name, strings.Join(names, "|"))
+	return errUsage
+}
+
+// newFlagSet returns the flags of a command, printing its usage
+// to stderr
+func newFlagSet(env *environment, name string, arguments string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(env.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(env.stderr, "Usage: snickers %s %s\n", name, arguments)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseFlags parses the flags of a command that takes the given
+// number of arguments
+func parseFlags(flags *flag.FlagSet, args []string, arguments int) error {
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() != arguments {
+		flags.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// newAPIFlagSet returns the flags of a command talking to the API,
+// along with the client they set up
+func newAPIFlagSet(env *environment, name string, arguments string) (*flag.FlagSet, *client.Client) {
+	flags := newFlagSet(env, name, arguments)
+	api := &client.Client{}
+	url := os.Getenv("SNICKERS_URL")
+	if url == "" {
+		url = "http://localhost:8000"
+	}
+	flags.StringVar(&api.URL, "url", url, "address of the Snickers API")
+	flags.StringVar(&api.APIKey, "api-key", os.Getenv("SNICKERS_API_KEY"), "API key to authenticate with")
+	return flags, api
+}
+
+// printJSON writes the value as indented JSON
+func printJSON(w io.Writer, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/flavioribeiro/gonfig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/server"
+	"github.com/snickers/snickers/types"
+)
+
+var _ = Describe("Cli", func() {
+	var (
+		dbInstance db.Storage
+		api        *httptest.Server
+		stdout     *bytes.Buffer
+		stderr     *bytes.Buffer
+		presetFile string
+	)
+
+	// run runs an API subcommand against the test server
+	run := func(group string, subcommand string, args ...string) int {
+		stdout.Reset()
+		stderr.Reset()
+		return Run(append([]string{group, subcommand, "-url", api.URL}, args...), stdout, stderr)
+	}
+
+	BeforeEach(func() {
+		currentDir, _ := os.Getwd()
+		cfg, _ := gonfig.FromJsonFile(currentDir + "/../fixtures/config.json")
+		dbInstance, _ = db.GetDatabase(cfg)
+		dbInstance.ClearDatabase()
+		api = httptest.NewServer(server.New(lagertest.NewTestLogger("cli"), cfg, "tcp", ":8000", dbInstance).Handler())
+
+		stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+		presetFile = currentDir + "/../examples/preset_mp4.json"
+	})
+
+	AfterEach(func() {
+		api.Close()
+	})
+
+	It("should print the usage for unknown commands", func() {
+		Expect(Run([]string{"transcode"}, stdout, stderr)).To(Equal(2))
+		Expect(stderr.String()).To(ContainSubstring(`unknown command "transcode"`))
+		Expect(stderr.String()).To(ContainSubstring("Usage: snickers"))
+	})
+
+	It("should print the usage of subcommands called without arguments", func() {
+		Expect(Run([]string{"preset"}, stdout, stderr)).To(Equal(2))
+		Expect(stderr.String()).To(Equal("Usage: snickers preset create|delete|get|list|update\n"))
+	})
+
+	Context("preset commands", func() {
+		It("should create a preset from a file", func() {
+			Expect(run("preset", "create", presetFile)).To(Equal(0))
+			Expect(stdout.String()).To(ContainSubstring(`"name": "mp4_240p"`))
+
+			preset, err := dbInstance.RetrievePreset("", "mp4_240p")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(preset.Video.Codec).To(Equal("h264"))
+		})
+
+		It("should list, get and delete presets", func() {
+			dbInstance.StorePreset(types.Preset{Name: "webm_720p", Container: "webm", Description: "720p"})
+
+			Expect(run("preset", "list")).To(Equal(0))
+			Expect(stdout.String()).To(ContainSubstring("NAME"))
+			Expect(stdout.String()).To(ContainSubstring("webm_720p"))
+
+			Expect(run("preset", "get", "webm_720p")).To(Equal(0))
+			Expect(stdout.String()).To(ContainSubstring(`"container": "webm"`))
+
+			Expect(run("preset", "delete", "webm_720p")).To(Equal(0))
+			_, err := dbInstance.RetrievePreset("", "webm_720p")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should report the errors of the API", func() {
+			Expect(run("preset", "get", "missing")).To(Equal(1))
+			Expect(stderr.String()).To(HavePrefix("snickers: "))
+		})
+
+		It("should fail when the arguments are missing", func() {
+			Expect(run("preset", "get")).To(Equal(2))
+			Expect(stderr.String()).To(ContainSubstring("Usage: snickers preset get [flags] <name>"))
+		})
+	})
+
+	Context("job commands", func() {
+		BeforeEach(func() {
+			dbInstance.StorePreset(types.Preset{Name: "mp4_240p"})
+		})
+
+		It("should create a job from flags and print its ID", func() {
+			Expect(run("job", "create", "-source", "http://example.com/video.mov", "-destination", "s3://bucket/", "-preset", "mp4_240p", "-priority", "3")).To(Equal(0))
+
+			job, err := dbInstance.RetrieveJob(strings.TrimSpace(stdout.String()))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(job.Source).To(Equal("http://example.com/video.mov"))
+			Expect(job.Priority).To(Equal(3))
+			Expect(job.Status).To(Equal(types.JobCreated))
+		})
+
+		It("should create a job from a file, overridden by the flags", func() {
+			jobFile, _ := ioutil.TempFile("", "job")
+			defer os.Remove(jobFile.Name())
+			jobFile.WriteString(`{"source": "http://example.com/video.mov", "destination": "s3://bucket/", "preset": "other"}`)
+			jobFile.Close()
+
+			Expect(run("job", "create", "-preset", "mp4_240p", "-start-at", "2030-01-01T00:00:00Z", jobFile.Name())).To(Equal(0))
+
+			job, _ := dbInstance.RetrieveJob(strings.TrimSpace(stdout.String()))
+			Expect(job.Preset.Name).To(Equal("mp4_240p"))
+			Expect(job.Status).To(Equal(types.JobScheduled))
+		})
+
+		It("should show, list and cancel jobs", func() {
+			dbInstance.StoreJob(types.Job{ID: "123", Status: types.JobCreated, Source: "http://example.com/video.mov"})
+
+			Expect(run("job", "status", "123")).To(Equal(0))
+			Expect(stdout.String()).To(ContainSubstring(`"status": "created"`))
+
+			Expect(run("job", "list", "-status", "created")).To(Equal(0))
+			Expect(stdout.String()).To(ContainSubstring("123"))
+
+			Expect(run("job", "cancel", "123")).To(Equal(0))
+			Expect(stdout.String()).To(Equal("canceled\n"))
+
+			Expect(run("job", "cancel", "123")).To(Equal(1))
+		})
+
+		It("should wait for jobs until they are done", func() {
+			dbInstance.StoreJob(types.Job{ID: "123", Status: types.JobFinished, ProgressText: "100%"})
+			Expect(run("job", "wait", "123")).To(Equal(0))
+			Expect(stdout.String()).To(Equal("finished 100%\n"))
+
+			dbInstance.StoreJob(types.Job{ID: "456", Status: types.JobError, Details: "no such file"})
+			Expect(run("job", "wait", "456")).To(Equal(1))
+			Expect(stderr.String()).To(ContainSubstring("job 456 failed: no such file"))
+		})
+	})
+
+	Context("encode command", func() {
+		It("should require a preset", func() {
+			Expect(Run([]string{"encode", "video.mov"}, stdout, stderr)).To(Equal(2))
+		})
+
+		It("should fail on missing sources without leaving files behind", func() {
+			outputDir, _ := ioutil.TempDir("", "outputs")
+			defer os.RemoveAll(outputDir)
+
+			Expect(Run([]string{"encode", "-preset", presetFile, "-output", outputDir, filepath.Join(outputDir, "missing.mov")}, stdout, stderr)).To(Equal(1))
+			entries, _ := ioutil.ReadDir(outputDir)
+			Expect(entries).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/flavioribeiro/gonfig"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/events"
+	"github.com/snickers/snickers/pipeline"
+	"github.com/snickers/snickers/types"
+)
+
+// runEncode encodes a file with the preset on a JSON file, running
+// the pipeline in this process on a memory database. The outputs
+// are moved to the output directory.
+func runEncode(env *environment, args []string) error {
+	flags := newFlagSet(env, "encode", "[flags] <source>")
+	presetFile := flags.String("preset", "", "JSON file of the preset to encode with")
+	outputDir := flags.String("output", ".", "directory to write the outputs to")
+	verbose := flags.Bool("verbose", false, "log the pipeline stages to stderr")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	if *presetFile == "" {
+		flags.Usage()
+		return errUsage
+	}
+
+	preset, err := readPreset(*presetFile)
+	if err != nil {
+		return err
+	}
+	source, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(source); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(*outputDir, 0755); err != nil {
+		return err
+	}
+	// swapping next to the outputs lets them be renamed in place
+	swapDir, err := ioutil.TempDir(*outputDir, ".snickers-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(swapDir)
+
+	config, err := encodeConfig(swapDir)
+	if err != nil {
+		return err
+	}
+	dbInstance, err := db.GetDatabase(config)
+	if err != nil {
+		return err
+	}
+	if _, err := dbInstance.StorePreset(preset); err != nil {
+		return err
+	}
+
+	job, err := pipeline.CreateJob(dbInstance, types.JobInput{
+		Source:      (&url.URL{Scheme: "file", Path: source}).String(),
+		Destination: "local://",
+		PresetName:  preset.Name,
+	})
+	if err != nil {
+		return err
+	}
+
+	logger := lager.NewLogger("snickers")
+	if *verbose {
+		logger.RegisterSink(lager.NewWriterSink(env.stderr, lager.INFO))
+	}
+	job, err = runLocalJob(env, logger, config, dbInstance, job)
+	if err != nil {
+		return err
+	}
+
+	jobDir := filepath.Join(swapDir, "outputs", job.ID)
+	entries, err := ioutil.ReadDir(jobDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		target := filepath.Join(*outputDir, entry.Name())
+		if err := os.Rename(filepath.Join(jobDir, entry.Name()), target); err != nil {
+			return err
+		}
+		fmt.Fprintln(env.stdout, target)
+	}
+	return nil
+}
+
+// runLocalJob runs a job, printing its progress to stderr, and
+// returns it once it's done
+func runLocalJob(env *environment, logger lager.Logger, config gonfig.Gonfig, dbInstance db.Storage, job types.Job) (types.Job, error) {
+	subscription := events.DefaultBus.Subscribe(job.ID)
+	defer subscription.Close()
+
+	done := make(chan struct{})
+	go func() {
+		pipeline.StartJob(logger, config, dbInstance, job)
+		close(done)
+	}()
+
+	last := ""
+	for running := true; running; {
+		select {
+		case event := <-subscription.Events:
+			line := string(event.Status)
+			if event.ProgressText != "" {
+				line += " " + event.ProgressText
+			}
+			if line != last {
+				fmt.Fprintln(env.stderr, line)
+				last = line
+			}
+		case <-done:
+			running = false
+		}
+	}
+
+	job, err := dbInstance.RetrieveJob(job.ID)
+	if err != nil {
+		return job, err
+	}
+	if job.Status != types.JobFinished {
+		return job, fmt.Errorf("encoding failed: %s", job.Details)
+	}
+	return job, nil
+}
+
+// encodeConfig returns the configuration of the local pipeline,
+// keeping everything under the swap directory
+func encodeConfig(swapDir string) (gonfig.Gonfig, error) {
+	data, err := json.Marshal(map[string]interface{}{
+		"DATABASE_DRIVER":        "memory",
+		"SWAP_DIRECTORY":         swapDir + string(filepath.Separator),
+		"LOCAL_OUTPUT_DIRECTORY": filepath.Join(swapDir, "outputs"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return gonfig.FromJson(bytes.NewReader(data))
+}
@@ -0,0 +1,175 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"text/tabwriter"
+	"time"
+
+	"github.com/snickers/snickers/types"
+)
+
+// runJob runs the job subcommands
+func runJob(env *environment, args []string) error {
+	return runSubcommand(env, "job", map[string]command{
+		"create": createJob,
+		"start":  startJob,
+		"status": jobStatus,
+		"wait":   waitJob,
+		"cancel": cancelJob,
+		"list":   listJobs,
+	}, args)
+}
+
+// createJob creates a job from a JSON file like examples/job.json,
+// or from the flags when no file is given, and prints its ID
+func createJob(env *environment, args []string) error {
+	flags, api := newAPIFlagSet(env, "job create", "[flags] [file.json]")
+	source := flags.String("source", "", "address of the source file")
+	destination := flags.String("destination", "", "address to upload the outputs to")
+	preset := flags.String("preset", "", "name of the preset to encode with")
+	priority := flags.Int("priority", 0, "priority among the queued jobs, higher first")
+	startAt := flags.String("start-at", "", "time to start the job at, in RFC 3339 format")
+	start := flags.Bool("start", false, "start the job right after creating it")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return errUsage
+	}
+
+	var input types.JobInput
+	if flags.NArg() == 1 {
+		data, err := ioutil.ReadFile(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &input); err != nil {
+			return fmt.Errorf("reading %s: %s", flags.Arg(0), err)
+		}
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "source":
+			input.Source = *source
+		case "destination":
+			input.Destination = *destination
+		case "preset":
+			input.PresetName = *preset
+		case "priority":
+			input.Priority = *priority
+		case "start":
+			input.AutoStart = *start
+		}
+	})
+	if *startAt != "" {
+		at, err := time.Parse(time.RFC3339, *startAt)
+		if err != nil {
+			return fmt.Errorf("invalid -start-at %q", *startAt)
+		}
+		input.StartAt = &at
+	}
+
+	job, err := api.CreateJob(context.Background(), input)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(env.stdout, job.ID)
+	return nil
+}
+
+func startJob(env *environment, args []string) error {
+	flags, api := newAPIFlagSet(env, "job start", "[flags] <id>")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	return api.StartJob(context.Background(), flags.Arg(0))
+}
+
+func jobStatus(env *environment, args []string) error {
+	flags, api := newAPIFlagSet(env, "job status", "[flags] <id>")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+
+	job, err := api.GetJob(context.Background(), flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	return printJSON(env.stdout, job)
+}
+
+// waitJob prints the progress of a job until it's done, failing
+// unless it finished
+func waitJob(env *environment, args []string) error {
+	flags, api := newAPIFlagSet(env, "job wait", "[flags] <id>")
+	interval := flags.Duration("interval", 2*time.Second, "time between the checks of the job")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+
+	api.PollInterval = *interval
+	job, err := api.WaitForJob(context.Background(), flags.Arg(0), func(job types.Job) {
+		if job.ProgressText != "" {
+			fmt.Fprintln(env.stdout, job.Status, job.ProgressText)
+		} else {
+			fmt.Fprintln(env.stdout, job.Status)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	switch job.Status {
+	case types.JobError:
+		return fmt.Errorf("job %s failed: %s", job.ID, job.Details)
+	case types.JobCanceled:
+		return fmt.Errorf("job %s was canceled", job.ID)
+	}
+	return nil
+}
+
+func cancelJob(env *environment, args []string) error {
+	flags, api := newAPIFlagSet(env, "job cancel", "[flags] <id>")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+
+	job, err := api.CancelJob(context.Background(), flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(env.stdout, job.Status)
+	return nil
+}
+
+func listJobs(env *environment, args []string) error {
+	flags, api := newAPIFlagSet(env, "job list", "[flags]")
+	status := flags.String("status", "", "only list the jobs with this status")
+	preset := flags.String("preset", "", "only list the jobs with this preset")
+	limit := flags.Int("limit", 0, "maximum number of jobs to list")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+
+	page, err := api.ListJobs(context.Background(), types.JobQuery{
+		Status:     types.JobStatus(*status),
+		PresetName: *preset,
+		Limit:      *limit,
+	})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tPROGRESS\tPRESET\tSOURCE")
+	for _, job := range page.Jobs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", job.ID, job.Status, job.ProgressText, job.Preset.Name, job.Source)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"text/tabwriter"
+
+	"github.com/snickers/snickers/types"
+)
+
+// runPreset runs the preset subcommands
+func runPreset(env *environment, args []string) error {
+	return runSubcommand(env, "preset", map[string]command{
+		"create": createPreset,
+		"update": updatePreset,
+		"list":   listPresets,
+		"get":    getPreset,
+		"delete": deletePreset,
+	}, args)
+}
+
+// createPreset creates the preset on a JSON file and prints the
+// stored one
+func createPreset(env *environment, args []string) error {
+	flags, api := newAPIFlagSet(env, "preset create", "[flags] <file.json>")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+
+	preset, err := readPreset(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	preset, err = api.CreatePreset(context.Background(), preset)
+	if err != nil {
+		return err
+	}
+	return printJSON(env.stdout, preset)
+}
+
+// updatePreset replaces a preset with the one on a JSON file and
+// prints the stored one
+func updatePreset(env *environment, args []string) error {
+	flags, api := newAPIFlagSet(env, "preset update", "[flags] <file.json>")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+
+	preset, err := readPreset(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	preset, err = api.UpdatePreset(context.Background(), preset)
+	if err != nil {
+		return err
+	}
+	return printJSON(env.stdout, preset)
+}
+
+func listPresets(env *environment, args []string) error {
+	flags, api := newAPIFlagSet(env, "preset list", "[flags]")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+
+	presets, err := api.ListPresets(context.Background())
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tCONTAINER\tVIDEO\tAUDIO\tDESCRIPTION")
+	for _, preset := range presets {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", preset.Name, preset.Container, preset.Video.Codec, preset.Audio.Codec, preset.Description)
+	}
+	return w.Flush()
+}
+
+func getPreset(env *environment, args []string) error {
+	flags, api := newAPIFlagSet(env, "preset get", "[flags] <name>")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+
+	preset, err := api.GetPreset(context.Background(), flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	return printJSON(env.stdout, preset)
+}
+
+func deletePreset(env *environment, args []string) error {
+	flags, api := newAPIFlagSet(env, "preset delete", "[flags] <name>")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	return api.DeletePreset(context.Background(), flags.Arg(0))
+}
+
+// readPreset reads a preset from a JSON file like
+// examples/preset_mp4.json
+func readPreset(file string) (types.Preset, error) {
+	var preset types.Preset
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return preset, err
+	}
+	if err := json.Unmarshal(data, &preset); err != nil {
+		return preset, fmt.Errorf("reading %s: %s", file, err)
+	}
+	return preset, nil
+}
@@ -0,0 +1,214 @@
+// Package client is a Go client for the Snickers HTTP API. It sends
+// the requests of every route and returns the same types the server
+// works with.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/snickers/snickers/types"
+)
+
+// defaultPollInterval is how often WaitForJob checks on a job when
+// PollInterval is not set
+const defaultPollInterval = 2 * time.Second
+
+// Client sends requests to the Snickers API on URL, authenticated
+// with APIKey when it's set
+type Client struct {
+	URL    string
+	APIKey string
+
+	// HTTPClient sends the requests, http.DefaultClient when nil
+	HTTPClient *http.Client
+
+	// PollInterval is how often WaitForJob checks on a job
+	PollInterval time.Duration
+}
+
+// New returns a client for the API on the given URL, such as
+// http://localhost:8000
+func New(url string, apiKey string) *Client {
+	return &Client{URL: url, APIKey: apiKey}
+}
+
+// Error is a request the API answered with an error status. Message
+// is the error on the body, or the status text when there is none.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.StatusCode)
+}
+
+// StatusCode returns the HTTP status of an API error, or 0 for
+// other errors
+func StatusCode(err error) int {
+	if apiErr, ok := err.(*Error); ok {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// HealthStatus tells if the server takes jobs, as answered by the
+// health endpoint
+type HealthStatus struct {
+	Status      string            `json:"status"`
+	Checks      map[string]string `json:"checks"`
+	RunningJobs []string          `json:"runningJobs"`
+}
+
+// Health returns the health of the server. Unhealthy and draining
+// servers are reported on the Status rather than as an error.
+func (c *Client) Health(ctx context.Context) (HealthStatus, error) {
+	var status HealthStatus
+	resp, err := c.send(ctx, http.MethodGet, "/healthz", nil, nil)
+	if err != nil {
+		return status, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return status, responseError(resp)
+	}
+	return status, json.NewDecoder(resp.Body).Decode(&status)
+}
+
+// Metrics returns the Prometheus metrics of the server, in the
+// text exposition format
+func (c *Client) Metrics(ctx context.Context) ([]byte, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/metrics", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// CreateAPIKey creates an API key with the name, tenant and scopes
+// of the given one. The secret is only on the returned key.
+func (c *Client) CreateAPIKey(ctx context.Context, key types.APIKey) (types.APIKey, error) {
+	var created types.APIKey
+	err := c.doJSON(ctx, http.MethodPost, "/apikeys", nil, key, &created)
+	return created, err
+}
+
+// ListAPIKeys lists the API keys, without their secrets
+func (c *Client) ListAPIKeys(ctx context.Context) ([]types.APIKey, error) {
+	var keys []types.APIKey
+	err := c.doJSON(ctx, http.MethodGet, "/apikeys", nil, nil, &keys)
+	return keys, err
+}
+
+// RevokeAPIKey deletes an API key
+func (c *Client) RevokeAPIKey(ctx context.Context, keyID string) error {
+	return c.doJSON(ctx, http.MethodDelete, escapePath("/apikeys", keyID), nil, nil, nil)
+}
+
+// doJSON sends the value as the JSON body, unless it's nil, and
+// decodes the JSON response into out, unless it's nil
+func (c *Client) doJSON(ctx context.Context, method string, path string, header http.Header, value interface{}, out interface{}) error {
+	var body io.Reader
+	if value != nil {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+		if header == nil {
+			header = http.Header{}
+		}
+		header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.do(ctx, method, path, header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// do sends a request, failing with an *Error when the API answers
+// with an error status. The caller closes the response body.
+func (c *Client) do(ctx context.Context, method string, path string, header http.Header, body io.Reader) (*http.Response, error) {
+	resp, err := c.send(ctx, method, path, header, body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// send sends a request whatever the status it gets back
+func (c *Client) send(ctx context.Context, method string, path string, header http.Header, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, strings.TrimRight(c.URL, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return httpClient.Do(req)
+}
+
+// responseError reads the error of a failed request. The API sends
+// it as {"error": "..."}, which isn't always valid JSON since the
+// message isn't escaped.
+func responseError(resp *http.Response) error {
+	apiErr := &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	data, _ := ioutil.ReadAll(resp.Body)
+	text := strings.TrimSpace(string(data))
+
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(data, &body); err == nil && body.Error != "" {
+		apiErr.Message = body.Error
+	} else if text != "" {
+		apiErr.Message = text
+	}
+	return apiErr
+}
+
+// escapePath joins the segments to the path, escaping each of them
+func escapePath(path string, segments ...string) string {
+	for _, segment := range segments {
+		path += "/" + url.PathEscape(segment)
+	}
+	return path
+}
+
+// ifMatch is the header making a change conditional on the version
+// of a job or preset
+func ifMatch(version int64) http.Header {
+	return http.Header{"If-Match": []string{strconv.Quote(strconv.FormatInt(version, 10))}}
+}
@@ -0,0 +1,63 @@
+package client_test
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/flavioribeiro/gonfig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/snickers/snickers/client"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/server"
+
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Client Suite")
+}
+
+// adminKey authenticates the clients of the test servers
+const adminKey = "admin-secret"
+
+// testServer runs the real server on a memory database
+type testServer struct {
+	*httptest.Server
+	db        db.Storage
+	outputDir string
+}
+
+func newTestServer() *testServer {
+	outputDir, err := ioutil.TempDir("", "outputs")
+	Expect(err).NotTo(HaveOccurred())
+
+	cfg, err := gonfig.FromJson(strings.NewReader(`{
+		"DATABASE_DRIVER": "memory",
+		"SWAP_DIRECTORY": "/tmp/",
+		"LOCAL_OUTPUT_DIRECTORY": "` + outputDir + `",
+		"ADMIN_API_KEY": "` + adminKey + `"
+	}`))
+	Expect(err).NotTo(HaveOccurred())
+	dbInstance, err := db.GetDatabase(cfg)
+	Expect(err).NotTo(HaveOccurred())
+	dbInstance.ClearDatabase()
+
+	sn := server.New(lagertest.NewTestLogger("client"), cfg, "tcp", ":8000", dbInstance)
+	return &testServer{Server: httptest.NewServer(sn.Handler()), db: dbInstance, outputDir: outputDir}
+}
+
+func (s *testServer) client() *client.Client {
+	return client.New(s.URL, adminKey)
+}
+
+func (s *testServer) Close() {
+	s.CloseClientConnections()
+	s.Server.Close()
+	s.db.ClearDatabase()
+	os.RemoveAll(s.outputDir)
+}
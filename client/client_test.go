@@ -0,0 +1,100 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/snickers/snickers/client"
+	"github.com/snickers/snickers/types"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		server *testServer
+		api    *client.Client
+		ctx    context.Context
+	)
+
+	BeforeEach(func() {
+		server = newTestServer()
+		api = server.client()
+		ctx = context.Background()
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("errors", func() {
+		It("should decode the error of the body", func() {
+			_, err := api.GetJob(ctx, "missing")
+			Expect(err).To(BeAssignableToTypeOf(&client.Error{}))
+			Expect(err.(*client.Error).Message).To(Equal("retrieving job: job not found"))
+			Expect(client.StatusCode(err)).To(Equal(http.StatusBadRequest))
+		})
+
+		It("should decode errors whose message has quotes", func() {
+			_, err := api.CreateAPIKey(ctx, types.APIKey{Name: "key", Scopes: []types.APIScope{"jobs:everything"}})
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*client.Error).Message).To(Equal(`validating api key: unknown scope "jobs:everything"`))
+		})
+
+		It("should fall back to the status text for errors without a body", func() {
+			_, _, err := api.GetUpload(ctx, "missing")
+			Expect(err).To(Equal(&client.Error{StatusCode: http.StatusNotFound, Message: "Not Found"}))
+		})
+
+		It("should fail with 401 without a valid api key", func() {
+			api.APIKey = "wrong"
+			_, err := api.ListJobs(ctx, types.JobQuery{})
+			Expect(client.StatusCode(err)).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should have no status for other errors", func() {
+			Expect(client.StatusCode(errors.New("connection refused"))).To(Equal(0))
+		})
+	})
+
+	Describe("Health", func() {
+		It("should return the health checks", func() {
+			status, err := api.Health(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status.Checks).To(HaveKey("storage"))
+			Expect(status.Checks["storage"]).To(Equal("ok"))
+		})
+	})
+
+	Describe("Metrics", func() {
+		It("should return the Prometheus metrics", func() {
+			metrics, err := api.Metrics(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(metrics)).To(ContainSubstring("snickers_"))
+		})
+	})
+
+	Describe("API keys", func() {
+		It("should create, list and revoke keys", func() {
+			key, err := api.CreateAPIKey(ctx, types.APIKey{Name: "encoder", Scopes: []types.APIScope{types.ScopeReadJobs}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key.Key).NotTo(BeEmpty())
+
+			keys, err := api.ListAPIKeys(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys).To(HaveLen(1))
+			Expect(keys[0].Key).To(BeEmpty())
+
+			reader := client.New(server.URL, key.Key)
+			_, err = reader.ListJobs(ctx, types.JobQuery{})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = reader.CreateJob(ctx, types.JobInput{})
+			Expect(client.StatusCode(err)).To(Equal(http.StatusForbidden))
+
+			Expect(api.RevokeAPIKey(ctx, key.ID)).To(Succeed())
+			_, err = reader.ListJobs(ctx, types.JobQuery{})
+			Expect(client.StatusCode(err)).To(Equal(http.StatusUnauthorized))
+		})
+	})
+})
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/snickers/snickers/events"
+)
+
+// maxEventSize is the longest line an event stream may have
+const maxEventSize = 1 << 20
+
+// EventStream reads the Server-Sent Events of the event routes
+type EventStream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+}
+
+// StreamJobEvents streams the status and progress changes of a
+// job, starting with its current state. Closing the stream or
+// canceling the context ends it.
+func (c *Client) StreamJobEvents(ctx context.Context, jobID string) (*EventStream, error) {
+	return c.streamEvents(ctx, escapePath("/jobs", jobID, "events"))
+}
+
+// StreamEvents streams the status and progress changes of every
+// job of the caller
+func (c *Client) StreamEvents(ctx context.Context) (*EventStream, error) {
+	return c.streamEvents(ctx, "/events")
+}
+
+func (c *Client) streamEvents(ctx context.Context, path string) (*EventStream, error) {
+	header := http.Header{"Accept": []string{"text/event-stream"}}
+	resp, err := c.do(ctx, http.MethodGet, path, header, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 4096), maxEventSize)
+	return &EventStream{body: resp.Body, scanner: scanner}, nil
+}
+
+// Next waits for the next event. It fails with io.EOF once the
+// server ends the stream.
+func (s *EventStream) Next() (events.Event, error) {
+	var event events.Event
+	data := ""
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		switch {
+		case line == "" && data != "":
+			err := json.Unmarshal([]byte(data), &event)
+			return event, err
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")
+		}
+		// comments keep the stream alive, and the event type is on
+		// the data as well
+	}
+
+	if err := s.scanner.Err(); err != nil {
+		return event, err
+	}
+	return event, io.EOF
+}
+
+// Close ends the stream
+func (s *EventStream) Close() error {
+	return s.body.Close()
+}
@@ -0,0 +1,75 @@
+package client_test
+
+import (
+	"context"
+	"io"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/snickers/snickers/client"
+	"github.com/snickers/snickers/events"
+	"github.com/snickers/snickers/types"
+)
+
+var _ = Describe("Events", func() {
+	var (
+		server *testServer
+		api    *client.Client
+	)
+
+	BeforeEach(func() {
+		server = newTestServer()
+		api = server.client()
+		server.db.StoreJob(types.Job{ID: "123", Status: types.JobCreated})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should stream the events of a job, starting with its state", func() {
+		stream, err := api.StreamJobEvents(context.Background(), "123")
+		Expect(err).NotTo(HaveOccurred())
+		defer stream.Close()
+
+		event, err := stream.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.Type).To(Equal(events.JobStatusChanged))
+		Expect(event.Status).To(Equal(types.JobCreated))
+
+		events.PublishJob(events.JobProgressChanged, types.Job{ID: "123", Status: types.JobEncoding, ProgressText: "42.00%"})
+		event, err = stream.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.Type).To(Equal(events.JobProgressChanged))
+		Expect(event.ProgressText).To(Equal("42.00%"))
+	})
+
+	It("should stream the events of every job", func() {
+		stream, err := api.StreamEvents(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		defer stream.Close()
+
+		events.PublishJob(events.JobStatusChanged, types.Job{ID: "456", Status: types.JobQueued})
+		event, err := stream.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.JobID).To(Equal("456"))
+	})
+
+	It("should end the stream when the context is canceled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream, err := api.StreamJobEvents(ctx, "123")
+		Expect(err).NotTo(HaveOccurred())
+		defer stream.Close()
+
+		stream.Next()
+		cancel()
+		_, err = stream.Next()
+		Expect(err).To(HaveOccurred())
+		Expect(err).NotTo(Equal(io.EOF))
+	})
+
+	It("should fail on jobs that don't exist", func() {
+		_, err := api.StreamJobEvents(context.Background(), "missing")
+		Expect(client.StatusCode(err)).To(Equal(404))
+	})
+})
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/snickers/snickers/types"
+)
+
+// CreateJob creates a job with the given source, destination and
+// preset. Jobs with a start time or auto start are scheduled to
+// start by themselves.
+func (c *Client) CreateJob(ctx context.Context, input types.JobInput) (types.Job, error) {
+	var job types.Job
+	err := c.doJSON(ctx, http.MethodPost, "/jobs", nil, input, &job)
+	return job, err
+}
+
+// ListJobs lists a page of the jobs matching the query. The owner
+// on the query is ignored, jobs are always those of the caller. Pass
+// the NextCursor of a page on the query to get the next one.
+func (c *Client) ListJobs(ctx context.Context, query types.JobQuery) (types.JobPage, error) {
+	var page types.JobPage
+	resp, err := c.do(ctx, http.MethodGet, "/jobs"+encodeJobQuery(query), nil, nil)
+	if err != nil {
+		return page, err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(&page.Jobs); err != nil {
+		return page, err
+	}
+	page.NextCursor = nextCursor(resp.Header.Get("Link"))
+	return page, nil
+}
+
+// GetJob returns the details of a job
+func (c *Client) GetJob(ctx context.Context, jobID string) (types.Job, error) {
+	var job types.Job
+	err := c.doJSON(ctx, http.MethodGet, escapePath("/jobs", jobID), nil, nil, &job)
+	return job, err
+}
+
+// DeleteJob deletes a job
+func (c *Client) DeleteJob(ctx context.Context, jobID string) error {
+	return c.doJSON(ctx, http.MethodDelete, escapePath("/jobs", jobID), nil, nil, nil)
+}
+
+// StartJob starts a job, which is run once the scheduler picks it
+func (c *Client) StartJob(ctx context.Context, jobID string) error {
+	return c.doJSON(ctx, http.MethodPost, escapePath("/jobs", jobID, "start"), nil, nil, nil)
+}
+
+// StartJobIfMatch starts a job only if it's still on the given
+// version, failing with 412 otherwise
+func (c *Client) StartJobIfMatch(ctx context.Context, jobID string, version int64) error {
+	return c.doJSON(ctx, http.MethodPost, escapePath("/jobs", jobID, "start"), ifMatch(version), nil, nil)
+}
+
+// CancelJob cancels a job that didn't start running yet, failing
+// with 409 otherwise
+func (c *Client) CancelJob(ctx context.Context, jobID string) (types.Job, error) {
+	var job types.Job
+	err := c.doJSON(ctx, http.MethodPost, escapePath("/jobs", jobID, "cancel"), nil, nil, &job)
+	return job, err
+}
+
+// GetJobOutput opens a file of a job with local:// destination, at
+// a path such as the ones on its outputs. The caller closes it.
+func (c *Client) GetJobOutput(ctx context.Context, jobID string, path string) (io.ReadCloser, error) {
+	segments := append([]string{jobID, "outputs"}, strings.Split(strings.TrimPrefix(path, "/"), "/")...)
+	resp, err := c.do(ctx, http.MethodGet, escapePath("/jobs", segments...), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// WaitForJob checks on a job every PollInterval until it's finished,
+// failed or canceled, and returns it. onChange, when given, is called
+// whenever its status or progress changes. It stops early when the
+// context is done.
+func (c *Client) WaitForJob(ctx context.Context, jobID string, onChange func(types.Job)) (types.Job, error) {
+	interval := c.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last types.Job
+	for {
+		job, err := c.GetJob(ctx, jobID)
+		if ctx.Err() != nil {
+			return last, ctx.Err()
+		} else if err != nil {
+			return job, err
+		}
+
+		if onChange != nil && (job.Status != last.Status || job.ProgressText != last.ProgressText) {
+			onChange(job)
+		}
+		last = job
+
+		if job.Status == types.JobFinished || job.Status == types.JobError || job.Status == types.JobCanceled {
+			return job, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// encodeJobQuery returns the query string of a job listing
+func encodeJobQuery(query types.JobQuery) string {
+	values := url.Values{}
+	set := func(key string, value string) {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	set("status", string(query.Status))
+	set("preset", query.PresetName)
+	set("source", query.Source)
+	set("destination", query.Destination)
+	set("sort", query.Sort)
+	set("cursor", query.Cursor)
+	if !query.CreatedAfter.IsZero() {
+		set("createdAfter", query.CreatedAfter.Format(time.RFC3339))
+	}
+	if !query.CreatedBefore.IsZero() {
+		set("createdBefore", query.CreatedBefore.Format(time.RFC3339))
+	}
+	if query.Limit > 0 {
+		set("limit", strconv.Itoa(query.Limit))
+	}
+
+	if len(values) == 0 {
+		return ""
+	}
+	return "?" + values.Encode()
+}
+
+// nextCursor takes the cursor of the next page from the Link
+// header of a job listing
+func nextCursor(link string) string {
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start < 0 || end < start || !strings.Contains(link[end:], `rel="next"`) {
+		return ""
+	}
+	next, err := url.Parse(link[start+1 : end])
+	if err != nil {
+		return ""
+	}
+	return next.Query().Get("cursor")
+}
@@ -0,0 +1,144 @@
+package client_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/snickers/snickers/client"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/types"
+)
+
+var _ = Describe("Jobs", func() {
+	var (
+		server *testServer
+		api    *client.Client
+		ctx    context.Context
+		input  types.JobInput
+	)
+
+	BeforeEach(func() {
+		server = newTestServer()
+		api = server.client()
+		api.PollInterval = 10 * time.Millisecond
+		ctx = context.Background()
+
+		server.db.StorePreset(types.Preset{Name: "mp4_240p", Container: "mp4"})
+		input = types.JobInput{
+			Source:      "http://example.com/video.mov",
+			Destination: "s3://bucket/",
+			PresetName:  "mp4_240p",
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should create and get jobs", func() {
+		created, err := api.CreateJob(ctx, input)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(created.Status).To(Equal(types.JobCreated))
+		Expect(created.Preset.Name).To(Equal("mp4_240p"))
+
+		job, err := api.GetJob(ctx, created.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.Source).To(Equal("http://example.com/video.mov"))
+	})
+
+	It("should list jobs page by page", func() {
+		for i := 0; i < 3; i++ {
+			api.CreateJob(ctx, input)
+		}
+
+		page, err := api.ListJobs(ctx, types.JobQuery{Limit: 2, Sort: types.SortByID})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page.Jobs).To(HaveLen(2))
+		Expect(page.NextCursor).NotTo(BeEmpty())
+
+		page, err = api.ListJobs(ctx, types.JobQuery{Limit: 2, Sort: types.SortByID, Cursor: page.NextCursor})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page.Jobs).To(HaveLen(1))
+		Expect(page.NextCursor).To(BeEmpty())
+
+		page, err = api.ListJobs(ctx, types.JobQuery{Status: types.JobFinished})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page.Jobs).To(BeEmpty())
+	})
+
+	It("should cancel and delete jobs", func() {
+		created, _ := api.CreateJob(ctx, input)
+
+		job, err := api.CancelJob(ctx, created.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.Status).To(Equal(types.JobCanceled))
+
+		_, err = api.CancelJob(ctx, created.ID)
+		Expect(client.StatusCode(err)).To(Equal(http.StatusConflict))
+
+		Expect(api.DeleteJob(ctx, created.ID)).To(Succeed())
+		_, err = api.GetJob(ctx, created.ID)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should start jobs only on the version given", func() {
+		created, _ := api.CreateJob(ctx, input)
+		db.ModifyJob(server.db, created.ID, func(job *types.Job) error {
+			job.Details = "changed"
+			return nil
+		})
+
+		err := api.StartJobIfMatch(ctx, created.ID, created.Version)
+		Expect(client.StatusCode(err)).To(Equal(http.StatusPreconditionFailed))
+	})
+
+	It("should start jobs and wait until they are done", func() {
+		server.db.StoreJob(types.Job{
+			ID:     "123",
+			Status: types.JobCreated,
+			Source: "upload://video.mov",
+			Upload: &types.SourceUpload{Filename: "video.mov", Length: 10, Offset: 4},
+		})
+		Expect(api.StartJob(ctx, "123")).To(Succeed())
+
+		statuses := []types.JobStatus{}
+		job, err := api.WaitForJob(ctx, "123", func(job types.Job) {
+			statuses = append(statuses, job.Status)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.Status).To(Equal(types.JobError))
+		Expect(job.Details).To(Equal("source upload is not complete"))
+		Expect(statuses[len(statuses)-1]).To(Equal(types.JobError))
+	})
+
+	It("should stop waiting when the context is done", func() {
+		created, _ := api.CreateJob(ctx, input)
+
+		timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		job, err := api.WaitForJob(timeout, created.ID, nil)
+		Expect(err).To(Equal(context.DeadlineExceeded))
+		Expect(job.Status).To(Equal(types.JobCreated))
+	})
+
+	It("should get the outputs of jobs", func() {
+		created, _ := api.CreateJob(ctx, input)
+		os.MkdirAll(filepath.Join(server.outputDir, created.ID, "hls"), 0700)
+		ioutil.WriteFile(filepath.Join(server.outputDir, created.ID, "hls", "video.m3u8"), []byte("#EXTM3U"), 0600)
+
+		output, err := api.GetJobOutput(ctx, created.ID, "hls/video.m3u8")
+		Expect(err).NotTo(HaveOccurred())
+		defer output.Close()
+		data, _ := ioutil.ReadAll(output)
+		Expect(string(data)).To(Equal("#EXTM3U"))
+
+		_, err = api.GetJobOutput(ctx, created.ID, "missing.mp4")
+		Expect(client.StatusCode(err)).To(Equal(http.StatusNotFound))
+	})
+})
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/snickers/snickers/types"
+)
+
+// CreatePreset creates a preset for the caller
+func (c *Client) CreatePreset(ctx context.Context, preset types.Preset) (types.Preset, error) {
+	var created types.Preset
+	err := c.doJSON(ctx, http.MethodPost, "/presets", nil, preset, &created)
+	return created, err
+}
+
+// UpdatePreset replaces the preset with the same name
+func (c *Client) UpdatePreset(ctx context.Context, preset types.Preset) (types.Preset, error) {
+	var updated types.Preset
+	err := c.doJSON(ctx, http.MethodPut, "/presets", nil, preset, &updated)
+	return updated, err
+}
+
+// UpdatePresetIfMatch replaces the preset with the same name only
+// if it's still on the given version, failing with 412 otherwise
+func (c *Client) UpdatePresetIfMatch(ctx context.Context, preset types.Preset, version int64) (types.Preset, error) {
+	var updated types.Preset
+	err := c.doJSON(ctx, http.MethodPut, "/presets", ifMatch(version), preset, &updated)
+	return updated, err
+}
+
+// ListPresets lists the presets of the caller and the system ones
+func (c *Client) ListPresets(ctx context.Context) ([]types.Preset, error) {
+	var presets []types.Preset
+	err := c.doJSON(ctx, http.MethodGet, "/presets", nil, nil, &presets)
+	return presets, err
+}
+
+// GetPreset returns the details of a preset
+func (c *Client) GetPreset(ctx context.Context, name string) (types.Preset, error) {
+	var preset types.Preset
+	err := c.doJSON(ctx, http.MethodGet, escapePath("/presets", name), nil, nil, &preset)
+	return preset, err
+}
+
+// DeletePreset deletes a preset
+func (c *Client) DeletePreset(ctx context.Context, name string) error {
+	return c.doJSON(ctx, http.MethodDelete, escapePath("/presets", name), nil, nil, nil)
+}
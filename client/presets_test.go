@@ -0,0 +1,63 @@
+package client_test
+
+import (
+	"context"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/snickers/snickers/client"
+	"github.com/snickers/snickers/types"
+)
+
+var _ = Describe("Presets", func() {
+	var (
+		server *testServer
+		api    *client.Client
+		ctx    context.Context
+	)
+
+	BeforeEach(func() {
+		server = newTestServer()
+		api = server.client()
+		ctx = context.Background()
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should create, get, list and delete presets", func() {
+		created, err := api.CreatePreset(ctx, types.Preset{Name: "mp4_240p", Container: "mp4"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(created.Name).To(Equal("mp4_240p"))
+
+		preset, err := api.GetPreset(ctx, "mp4_240p")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(preset.Container).To(Equal("mp4"))
+
+		presets, err := api.ListPresets(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(presets).To(HaveLen(1))
+
+		Expect(api.DeletePreset(ctx, "mp4_240p")).To(Succeed())
+		_, err = api.GetPreset(ctx, "mp4_240p")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should update presets only on the version given", func() {
+		created, _ := api.CreatePreset(ctx, types.Preset{Name: "mp4_240p", Container: "mp4"})
+
+		updated, err := api.UpdatePresetIfMatch(ctx, types.Preset{Name: "mp4_240p", Container: "webm"}, created.Version)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updated.Container).To(Equal("webm"))
+		Expect(updated.Version).To(BeNumerically(">", created.Version))
+
+		_, err = api.UpdatePresetIfMatch(ctx, types.Preset{Name: "mp4_240p", Container: "mov"}, created.Version)
+		Expect(client.StatusCode(err)).To(Equal(http.StatusPreconditionFailed))
+
+		updated, err = api.UpdatePreset(ctx, types.Preset{Name: "mp4_240p", Container: "mov"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updated.Container).To(Equal("mov"))
+	})
+})
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// tusResumable is the version of the tus protocol spoken by the
+// source upload routes
+const tusResumable = "1.0.0"
+
+// UploadSource sends the whole source of a job, which must not
+// have started yet
+func (c *Client) UploadSource(ctx context.Context, jobID string, filename string, source io.Reader) error {
+	header := http.Header{"Tus-Resumable": []string{tusResumable}}
+	resp, err := c.do(ctx, http.MethodPost, sourcePath(jobID, filename), header, source)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// CreateUpload creates a resumable upload of length bytes for the
+// source of a job, to be sent in chunks with ResumeUpload
+func (c *Client) CreateUpload(ctx context.Context, jobID string, filename string, length int64) error {
+	header := http.Header{
+		"Tus-Resumable": []string{tusResumable},
+		"Upload-Length": []string{strconv.FormatInt(length, 10)},
+	}
+	resp, err := c.do(ctx, http.MethodPost, sourcePath(jobID, filename), header, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// GetUpload returns how many bytes of a resumable upload were
+// received so far, out of its length
+func (c *Client) GetUpload(ctx context.Context, jobID string) (offset int64, length int64, err error) {
+	header := http.Header{"Tus-Resumable": []string{tusResumable}}
+	resp, err := c.do(ctx, http.MethodHead, escapePath("/jobs", jobID, "source"), header, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	resp.Body.Close()
+
+	return parseInt(resp.Header.Get("Upload-Offset")), parseInt(resp.Header.Get("Upload-Length")), nil
+}
+
+// ResumeUpload sends the chunk of a resumable upload starting at
+// offset, and returns the offset to send the next one from. The
+// offset is returned as well when the chunk was cut short, so the
+// upload can go on from there.
+func (c *Client) ResumeUpload(ctx context.Context, jobID string, offset int64, chunk io.Reader) (int64, error) {
+	header := http.Header{
+		"Tus-Resumable": []string{tusResumable},
+		"Content-Type":  []string{"application/offset+octet-stream"},
+		"Upload-Offset": []string{strconv.FormatInt(offset, 10)},
+	}
+	resp, err := c.send(ctx, http.MethodPatch, escapePath("/jobs", jobID, "source"), header, chunk)
+	if err != nil {
+		return offset, err
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Upload-Offset") != "" {
+		offset = parseInt(resp.Header.Get("Upload-Offset"))
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return offset, responseError(resp)
+	}
+	return offset, nil
+}
+
+func sourcePath(jobID string, filename string) string {
+	path := escapePath("/jobs", jobID, "source")
+	if filename != "" {
+		path += "?" + url.Values{"filename": []string{filename}}.Encode()
+	}
+	return path
+}
+
+func parseInt(value string) int64 {
+	n, _ := strconv.ParseInt(value, 10, 64)
+	return n
+}
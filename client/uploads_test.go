@@ -0,0 +1,63 @@
+package client_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/snickers/snickers/client"
+	"github.com/snickers/snickers/types"
+)
+
+var _ = Describe("Uploads", func() {
+	var (
+		server *testServer
+		api    *client.Client
+		ctx    context.Context
+	)
+
+	BeforeEach(func() {
+		server = newTestServer()
+		api = server.client()
+		ctx = context.Background()
+		server.db.StoreJob(types.Job{ID: "123", Status: types.JobCreated})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should upload whole sources", func() {
+		Expect(api.UploadSource(ctx, "123", "video.mov", strings.NewReader("0123456789"))).To(Succeed())
+
+		job, _ := server.db.RetrieveJob("123")
+		Expect(job.Source).To(Equal("upload://video.mov"))
+		Expect(job.Upload.Complete).To(BeTrue())
+		Expect(job.Upload.Length).To(Equal(int64(10)))
+	})
+
+	It("should upload sources in chunks", func() {
+		Expect(api.CreateUpload(ctx, "123", "video.mov", 10)).To(Succeed())
+
+		offset, err := api.ResumeUpload(ctx, "123", 0, strings.NewReader("0123"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(offset).To(Equal(int64(4)))
+
+		offset, length, err := api.GetUpload(ctx, "123")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(offset).To(Equal(int64(4)))
+		Expect(length).To(Equal(int64(10)))
+
+		_, err = api.ResumeUpload(ctx, "123", 2, strings.NewReader("456789"))
+		Expect(client.StatusCode(err)).To(Equal(http.StatusConflict))
+
+		offset, err = api.ResumeUpload(ctx, "123", 4, strings.NewReader("456789"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(offset).To(Equal(int64(10)))
+
+		job, _ := server.db.RetrieveJob("123")
+		Expect(job.Upload.Complete).To(BeTrue())
+	})
+})
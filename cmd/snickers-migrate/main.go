@@ -0,0 +1,36 @@
+// Command snickers-migrate brings the PostgreSQL database set on
+// config.json to the schema version expected by this Snickers build.
+// Run it before deploying when POSTGRES_AUTO_MIGRATE is false.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/flavioribeiro/gonfig"
+	"github.com/snickers/snickers/db"
+)
+
+func main() {
+	configPath := flag.String("config", "config.json", "path to the Snickers config file")
+	flag.Parse()
+
+	config, err := gonfig.FromJsonFile(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "reading config:", err)
+		os.Exit(1)
+	}
+
+	from, to, err := db.MigratePostgres(config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrating database:", err)
+		os.Exit(1)
+	}
+
+	if from == to {
+		fmt.Printf("database schema is up to date on version %d\n", to)
+		return
+	}
+	fmt.Printf("database schema migrated from version %d to %d\n", from, to)
+}
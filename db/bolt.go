@@ -0,0 +1,628 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flavioribeiro/gonfig"
+	"github.com/snickers/snickers/types"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltMetaBucket    = []byte("meta")
+	boltPresetsBucket = []byte("presets")
+	boltJobsBucket    = []byte("jobs")
+	boltAPIKeysBucket = []byte("apiKeys")
+
+	boltJobsByCreatedAtBucket = []byte("jobsByCreatedAt")
+
+	boltSchemaVersionKey = []byte("schemaVersion")
+)
+
+// boltMigrations brings the file from one schema version to the
+// next. The schema version of a file is the number of migrations
+// applied to it, so new migrations must only be appended.
+var boltMigrations = []func(tx *bolt.Tx) error{
+	// 1: presets and jobs buckets, keyed by name and id
+	func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{boltPresetsBucket, boltJobsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 2: index of jobs by creation time, for sorted queries
+	func(tx *bolt.Tx) error {
+		index, err := tx.CreateBucketIfNotExists(boltJobsByCreatedAtBucket)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(boltJobsBucket).ForEach(func(id, raw []byte) error {
+			job, err := decodeJob(raw)
+			if err != nil {
+				return err
+			}
+			return index.Put(boltCreatedAtKey(job.CreatedAt, string(id)), id)
+		})
+	},
+	// 3: API keys, keyed by id
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltAPIKeysBucket)
+		return err
+	},
+	// 4: presets keyed by owner and name
+	func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltPresetsBucket)
+		presets := map[string][]byte{}
+		if err := b.ForEach(func(name, raw []byte) error {
+			presets[string(name)] = append([]byte{}, raw...)
+			return nil
+		}); err != nil {
+			return err
+		}
+		for name, raw := range presets {
+			if err := b.Delete([]byte(name)); err != nil {
+				return err
+			}
+			if err := b.Put(boltPresetKey("", name), raw); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// Database struct that persists configurations on a BoltDB file
+type boltDatabase struct {
+	db *bolt.DB
+}
+
+var boltInstancesMtx sync.Mutex
+var boltInstances = map[string]*boltDatabase{}
+
+// getBoltDatabase returns the database stored on BOLTDB_PATH,
+// opening it only once per file
+func getBoltDatabase(cfg gonfig.Gonfig) (Storage, error) {
+	swapDir, err := cfg.GetString("SWAP_DIRECTORY", "")
+	if err != nil {
+		return nil, err
+	}
+
+	dbPath, err := cfg.GetString("BOLTDB_PATH", path.Join(swapDir, "snickers.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	boltInstancesMtx.Lock()
+	defer boltInstancesMtx.Unlock()
+
+	if instance, ok := boltInstances[dbPath]; ok {
+		return instance, nil
+	}
+
+	instance, err := openBoltDatabase(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	boltInstances[dbPath] = instance
+	return instance, nil
+}
+
+// openBoltDatabase opens the file and migrates it to the
+// current schema version
+func openBoltDatabase(dbPath string) (*boltDatabase, error) {
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Update(migrateBoltSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltDatabase{db: db}, nil
+}
+
+func migrateBoltSchema(tx *bolt.Tx) error {
+	meta, err := tx.CreateBucketIfNotExists(boltMetaBucket)
+	if err != nil {
+		return err
+	}
+
+	version := 0
+	if raw := meta.Get(boltSchemaVersionKey); raw != nil {
+		version = int(binary.BigEndian.Uint64(raw))
+	}
+
+	if version > len(boltMigrations) {
+		return fmt.Errorf("database schema version %d is newer than the supported %d", version, len(boltMigrations))
+	}
+
+	for ; version < len(boltMigrations); version++ {
+		if err := boltMigrations[version](tx); err != nil {
+			return fmt.Errorf("migrating database schema to version %d: %s", version+1, err)
+		}
+	}
+
+	raw := make([]byte, 8)
+	binary.BigEndian.PutUint64(raw, uint64(version))
+	return meta.Put(boltSchemaVersionKey, raw)
+}
+
+// ClearDatabase clears the database
+func (r *boltDatabase) ClearDatabase() error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{boltPresetsBucket, boltJobsBucket, boltJobsByCreatedAtBucket, boltAPIKeysBucket} {
+			if err := tx.DeleteBucket(bucket); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// StorePreset stores preset information
+func (r *boltDatabase) StorePreset(preset types.Preset) (types.Preset, error) {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltPresetsBucket)
+		key := boltPresetKey(preset.Owner, preset.Name)
+
+		//prevent replacing existing preset
+		if b.Get(key) != nil {
+			return errors.New("Error 409: Preset already exists, please update instead.")
+		}
+		return putBoltValue(b, key, preset)
+	})
+	if err != nil {
+		return types.Preset{}, err
+	}
+	return preset, nil
+}
+
+// RetrievePreset retrieves one preset of the owner, or the system
+// preset with that name, from the database
+func (r *boltDatabase) RetrievePreset(owner string, presetName string) (types.Preset, error) {
+	result := types.Preset{}
+	err := r.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltPresetsBucket)
+		raw := b.Get(boltPresetKey(owner, presetName))
+		if raw == nil {
+			raw = b.Get(boltPresetKey(types.SystemOwner, presetName))
+		}
+		if raw == nil {
+			return errors.New("preset not found")
+		}
+		return json.Unmarshal(raw, &result)
+	})
+	if err != nil {
+		return types.Preset{}, err
+	}
+	return result, nil
+}
+
+// UpdatePreset updates a preset
+func (r *boltDatabase) UpdatePreset(owner string, presetName string, newPreset types.Preset) (types.Preset, error) {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltPresetsBucket)
+		key := boltPresetKey(owner, presetName)
+		if raw := b.Get(key); raw != nil {
+			current := types.Preset{}
+			if err := json.Unmarshal(raw, &current); err != nil {
+				return err
+			}
+			if current.Version != newPreset.Version {
+				return ErrVersionConflict
+			}
+		}
+		newPreset.Owner = owner
+		newPreset.Version++
+		return putBoltValue(b, key, newPreset)
+	})
+	if err != nil {
+		return types.Preset{}, err
+	}
+	return newPreset, nil
+}
+
+// GetPresets retrieves the presets of the owner and the
+// system presets from the database
+func (r *boltDatabase) GetPresets(owner string) ([]types.Preset, error) {
+	res := []types.Preset{}
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltPresetsBucket).ForEach(func(_, raw []byte) error {
+			preset := types.Preset{}
+			if err := json.Unmarshal(raw, &preset); err != nil {
+				return err
+			}
+			if visiblePreset(preset, owner) {
+				res = append(res, preset)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// DeletePreset deletes a preset from the database
+func (r *boltDatabase) DeletePreset(owner string, presetName string) (types.Preset, error) {
+	result := types.Preset{}
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltPresetsBucket)
+		key := boltPresetKey(owner, presetName)
+		raw := b.Get(key)
+		if raw == nil {
+			return errors.New("preset not found")
+		}
+		if err := json.Unmarshal(raw, &result); err != nil {
+			return err
+		}
+		return b.Delete(key)
+	})
+	if err != nil {
+		return types.Preset{}, err
+	}
+	return result, nil
+}
+
+// DeleteJob deletes a job from the database
+func (r *boltDatabase) DeleteJob(jobID string) (types.Job, error) {
+	result := types.Job{}
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltJobsBucket)
+		raw := b.Get([]byte(jobID))
+		if raw == nil {
+			return errors.New("job not found")
+		}
+		job, err := decodeJob(raw)
+		if err != nil {
+			return err
+		}
+		result = job
+		if err := tx.Bucket(boltJobsByCreatedAtBucket).Delete(boltCreatedAtKey(job.CreatedAt, jobID)); err != nil {
+			return err
+		}
+		return b.Delete([]byte(jobID))
+	})
+	if err != nil {
+		return types.Job{}, err
+	}
+	return result, nil
+}
+
+// StoreJob stores job information
+func (r *boltDatabase) StoreJob(job types.Job) (types.Job, error) {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		return putBoltJob(tx, job.ID, job)
+	})
+	if err != nil {
+		return types.Job{}, err
+	}
+	return job, nil
+}
+
+// RetrieveJob retrieves one job from the database
+func (r *boltDatabase) RetrieveJob(jobID string) (types.Job, error) {
+	result := types.Job{}
+	err := r.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(boltJobsBucket).Get([]byte(jobID))
+		if raw == nil {
+			return errors.New("job not found")
+		}
+		job, err := decodeJob(raw)
+		result = job
+		return err
+	})
+	if err != nil {
+		return types.Job{}, err
+	}
+	return result, nil
+}
+
+// UpdateJob updates a job
+func (r *boltDatabase) UpdateJob(jobID string, newJob types.Job) (types.Job, error) {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		if raw := tx.Bucket(boltJobsBucket).Get([]byte(jobID)); raw != nil {
+			current, err := decodeJob(raw)
+			if err != nil {
+				return err
+			}
+			if current.Version != newJob.Version {
+				return ErrVersionConflict
+			}
+		}
+		newJob.Version++
+		return putBoltJob(tx, jobID, newJob)
+	})
+	if err != nil {
+		return types.Job{}, err
+	}
+	return newJob, nil
+}
+
+// UpdateJobProgress updates only the progress of a job
+func (r *boltDatabase) UpdateJobProgress(jobID string, progress types.Progress) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(boltJobsBucket).Get([]byte(jobID))
+		if raw == nil {
+			return errors.New("job not found")
+		}
+		job, err := decodeJob(raw)
+		if err != nil {
+			return err
+		}
+		job.SetProgress(progress)
+		return putBoltJob(tx, jobID, job)
+	})
+}
+
+// GetJobs retrieves all jobs of the database
+func (r *boltDatabase) GetJobs() ([]types.Job, error) {
+	res := []types.Job{}
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltJobsBucket).ForEach(func(_, raw []byte) error {
+			job, err := decodeJob(raw)
+			if err != nil {
+				return err
+			}
+			res = append(res, job)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// CountJobsByStatus counts the jobs on each status
+func (r *boltDatabase) CountJobsByStatus() (map[types.JobStatus]int, error) {
+	counts := map[types.JobStatus]int{}
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltJobsBucket).ForEach(func(_, raw []byte) error {
+			job := struct {
+				Status types.JobStatus `json:"status"`
+			}{}
+			if err := json.Unmarshal(raw, &job); err != nil {
+				return err
+			}
+			counts[job.Status]++
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// Ping tells if the database is reachable
+func (r *boltDatabase) Ping() error {
+	return r.db.View(func(tx *bolt.Tx) error {
+		return nil
+	})
+}
+
+// StoreAPIKey stores an API key
+func (r *boltDatabase) StoreAPIKey(key types.APIKey) (types.APIKey, error) {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltAPIKeysBucket)
+		if b.Get([]byte(key.ID)) != nil {
+			return errors.New("api key already exists")
+		}
+		return putBoltValue(b, []byte(key.ID), key)
+	})
+	if err != nil {
+		return types.APIKey{}, err
+	}
+	return key, nil
+}
+
+// RetrieveAPIKey retrieves one API key from the database
+func (r *boltDatabase) RetrieveAPIKey(keyID string) (types.APIKey, error) {
+	result := types.APIKey{}
+	err := r.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(boltAPIKeysBucket).Get([]byte(keyID))
+		if raw == nil {
+			return errors.New("api key not found")
+		}
+		return json.Unmarshal(raw, &result)
+	})
+	if err != nil {
+		return types.APIKey{}, err
+	}
+	return result, nil
+}
+
+// GetAPIKeys retrieves all API keys of the database
+func (r *boltDatabase) GetAPIKeys() ([]types.APIKey, error) {
+	res := []types.APIKey{}
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltAPIKeysBucket).ForEach(func(_, raw []byte) error {
+			key := types.APIKey{}
+			if err := json.Unmarshal(raw, &key); err != nil {
+				return err
+			}
+			res = append(res, key)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// DeleteAPIKey deletes an API key from the database
+func (r *boltDatabase) DeleteAPIKey(keyID string) (types.APIKey, error) {
+	result := types.APIKey{}
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltAPIKeysBucket)
+		raw := b.Get([]byte(keyID))
+		if raw == nil {
+			return errors.New("api key not found")
+		}
+		if err := json.Unmarshal(raw, &result); err != nil {
+			return err
+		}
+		return b.Delete([]byte(keyID))
+	})
+	if err != nil {
+		return types.APIKey{}, err
+	}
+	return result, nil
+}
+
+// QueryJobs retrieves a page of jobs. Jobs are walked on the order
+// of the jobs bucket or of the creation time index, starting
+// from the cursor, so only the jobs before the page end are read.
+func (r *boltDatabase) QueryJobs(query types.JobQuery) (types.JobPage, error) {
+	query, cursor, err := normalizeJobQuery(query)
+	if err != nil {
+		return types.JobPage{}, err
+	}
+
+	byID := query.Sort == types.SortByID || query.Sort == types.SortByIDDesc
+	desc := strings.HasPrefix(query.Sort, "-")
+
+	jobs := []types.Job{}
+	err = r.db.View(func(tx *bolt.Tx) error {
+		jobsBucket := tx.Bucket(boltJobsBucket)
+
+		var c *bolt.Cursor
+		var start []byte
+		if byID {
+			c = jobsBucket.Cursor()
+			if cursor != nil {
+				start = []byte(cursor.ID)
+			}
+		} else {
+			c = tx.Bucket(boltJobsByCreatedAtBucket).Cursor()
+			if cursor != nil {
+				start = boltCreatedAtKey(cursor.CreatedAt, cursor.ID)
+			}
+		}
+
+		for k, v := seekBoltCursor(c, start, desc); k != nil && len(jobs) <= query.Limit; k, v = stepBoltCursor(c, desc) {
+			raw := v
+			if !byID {
+				raw = jobsBucket.Get(v)
+			}
+			job, err := decodeJob(raw)
+			if err != nil {
+				return err
+			}
+
+			if !byID && pastCreatedRange(job, query, desc) {
+				break
+			}
+			if matchesJobQuery(job, query) {
+				jobs = append(jobs, job)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return types.JobPage{}, err
+	}
+	return newJobPage(jobs, query.Limit), nil
+}
+
+// seekBoltCursor moves to the first key after start on the walking
+// direction, or to the first key of all if there is no start
+func seekBoltCursor(c *bolt.Cursor, start []byte, desc bool) ([]byte, []byte) {
+	if start == nil {
+		if desc {
+			return c.Last()
+		}
+		return c.First()
+	}
+
+	k, v := c.Seek(start)
+	if desc {
+		if k == nil {
+			return c.Last()
+		}
+		return c.Prev()
+	}
+	if k != nil && bytes.Equal(k, start) {
+		return c.Next()
+	}
+	return k, v
+}
+
+func stepBoltCursor(c *bolt.Cursor, desc bool) ([]byte, []byte) {
+	if desc {
+		return c.Prev()
+	}
+	return c.Next()
+}
+
+// pastCreatedRange tells if a walk by creation time already
+// left the created range of the query
+func pastCreatedRange(job types.Job, query types.JobQuery, desc bool) bool {
+	if desc {
+		return !query.CreatedAfter.IsZero() && !job.CreatedAt.After(query.CreatedAfter)
+	}
+	return !query.CreatedBefore.IsZero() && !job.CreatedAt.Before(query.CreatedBefore)
+}
+
+// boltCreatedAtKey builds the key of a job on the creation time
+// index. Times are fixed width so keys sort chronologically.
+func boltCreatedAtKey(createdAt time.Time, jobID string) []byte {
+	return []byte(createdAt.UTC().Format("2006-01-02T15:04:05.000000000") + "\x00" + jobID)
+}
+
+// putBoltJob stores a job, keeping the creation time index
+// in sync with it
+func putBoltJob(tx *bolt.Tx, jobID string, job types.Job) error {
+	jobs := tx.Bucket(boltJobsBucket)
+	index := tx.Bucket(boltJobsByCreatedAtBucket)
+
+	if old := jobs.Get([]byte(jobID)); old != nil {
+		oldJob, err := decodeJob(old)
+		if err != nil {
+			return err
+		}
+		if err := index.Delete(boltCreatedAtKey(oldJob.CreatedAt, jobID)); err != nil {
+			return err
+		}
+	}
+
+	raw, err := encodeJob(job)
+	if err != nil {
+		return err
+	}
+	if err := jobs.Put([]byte(jobID), raw); err != nil {
+		return err
+	}
+	return index.Put(boltCreatedAtKey(job.CreatedAt, jobID), []byte(jobID))
+}
+
+// boltPresetKey builds the key of a preset, as names are only
+// unique among the presets of an owner
+func boltPresetKey(owner string, name string) []byte {
+	return []byte(owner + "\x00" + name)
+}
+
+func putBoltValue(b *bolt.Bucket, key []byte, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, raw)
+}
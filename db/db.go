@@ -1,28 +1,53 @@
 package db
 
 import (
+	"encoding/json"
+	"errors"
+
 	"github.com/flavioribeiro/gonfig"
 	"github.com/snickers/snickers/types"
 )
 
 //go:generate counterfeiter . Storage
 
-// Storage defines functions for accessing data
+// ErrVersionConflict is returned by the updates made on top of
+// a version that is no longer the stored one
+var ErrVersionConflict = errors.New("version conflict")
+
+// maxModifyAttempts is how many times ModifyJob retries an
+// update that conflicted with someone else's
+const maxModifyAttempts = 10
+
+// Storage defines functions for accessing data. Presets and jobs
+// are only updated if their Version matches the stored one, and
+// the updated copy is returned with the next Version. Presets are
+// kept by owner and name; retrieving and listing the presets of
+// an owner also finds the system presets.
 type Storage interface {
 	// Preset methods
 	StorePreset(types.Preset) (types.Preset, error)
-	RetrievePreset(string) (types.Preset, error)
-	UpdatePreset(string, types.Preset) (types.Preset, error)
-	GetPresets() ([]types.Preset, error)
-	DeletePreset(string) (types.Preset, error)
+	RetrievePreset(owner string, name string) (types.Preset, error)
+	UpdatePreset(owner string, name string, preset types.Preset) (types.Preset, error)
+	GetPresets(owner string) ([]types.Preset, error)
+	DeletePreset(owner string, name string) (types.Preset, error)
 
 	// Job methods
 	DeleteJob(string) (types.Job, error)
 	StoreJob(types.Job) (types.Job, error)
 	RetrieveJob(string) (types.Job, error)
 	UpdateJob(string, types.Job) (types.Job, error)
+	UpdateJobProgress(string, types.Progress) error
 	GetJobs() ([]types.Job, error)
+	QueryJobs(types.JobQuery) (types.JobPage, error)
+	CountJobsByStatus() (map[types.JobStatus]int, error)
 
+	// API key methods
+	StoreAPIKey(types.APIKey) (types.APIKey, error)
+	RetrieveAPIKey(string) (types.APIKey, error)
+	GetAPIKeys() ([]types.APIKey, error)
+	DeleteAPIKey(string) (types.APIKey, error)
+
+	Ping() error
 	ClearDatabase() error
 }
 
@@ -32,8 +57,69 @@ func GetDatabase(config gonfig.Gonfig) (Storage, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := configureProgressFlush(config); err != nil {
+		return nil, err
+	}
 	if driver == "mongo" || driver == "mongodb" {
 		return getMongoDatabase(config)
 	}
+	if driver == "bolt" || driver == "boltdb" {
+		return getBoltDatabase(config)
+	}
+	if driver == "postgres" || driver == "postgresql" {
+		return getPostgresDatabase(config)
+	}
 	return getMemoryDatabase()
 }
+
+// ModifyJob applies modify to the latest version of a job and
+// stores the result, starting over if the job was updated by
+// someone else in the meantime
+func ModifyJob(dbInstance Storage, jobID string, modify func(*types.Job) error) (types.Job, error) {
+	for attempt := 0; attempt < maxModifyAttempts; attempt++ {
+		job, err := dbInstance.RetrieveJob(jobID)
+		if err != nil {
+			return types.Job{}, err
+		}
+		if err := modify(&job); err != nil {
+			return types.Job{}, err
+		}
+
+		job, err = dbInstance.UpdateJob(jobID, job)
+		if err != ErrVersionConflict {
+			return job, err
+		}
+	}
+	return types.Job{}, ErrVersionConflict
+}
+
+// storedJob is how jobs are encoded by the drivers that keep
+// them as JSON. The local paths aren't part of the API but the
+// pipeline stages rely on them.
+type storedJob struct {
+	types.Job
+	LocalSource      string `json:"localSource,omitempty"`
+	LocalDestination string `json:"localDestination,omitempty"`
+
+	// shadows the estimate so it is never stored
+	EstimatedTimeRemaining *float64 `json:"estimatedTimeRemaining,omitempty"`
+}
+
+func encodeJob(job types.Job) ([]byte, error) {
+	return json.Marshal(storedJob{
+		Job:              job,
+		LocalSource:      job.LocalSource,
+		LocalDestination: job.LocalDestination,
+	})
+}
+
+func decodeJob(raw []byte) (types.Job, error) {
+	stored := storedJob{}
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		return types.Job{}, err
+	}
+	job := stored.Job
+	job.LocalSource = stored.LocalSource
+	job.LocalDestination = stored.LocalDestination
+	return job, nil
+}
@@ -2,7 +2,14 @@ package db
 
 import (
 	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
 
 	"github.com/flavioribeiro/gonfig"
 	"github.com/snickers/snickers/types"
@@ -75,14 +82,14 @@ var _ = Describe("Database", func() {
 			})
 
 			It("should be able to retrieve a preset by its name", func() {
-				res, err := dbInstance.RetrievePreset("examplePreset")
+				res, err := dbInstance.RetrievePreset("", "examplePreset")
 				Expect(err).NotTo(HaveOccurred())
 				Expect(res).To(Equal(preset))
 			})
 
 			Context("when the present does not exist", func() {
 				It("should return an error", func() {
-					_, err := dbInstance.RetrievePreset("invalid-preset")
+					_, err := dbInstance.RetrievePreset("", "invalid-preset")
 					Expect(err).To(HaveOccurred())
 				})
 			})
@@ -104,7 +111,7 @@ var _ = Describe("Database", func() {
 			})
 
 			It("should be able to list presets", func() {
-				presets, err := dbInstance.GetPresets()
+				presets, err := dbInstance.GetPresets("")
 				Expect(err).NotTo(HaveOccurred())
 				Expect(presets).To(ConsistOf(preset, anotherPreset))
 			})
@@ -118,16 +125,38 @@ var _ = Describe("Database", func() {
 			It("should be able to update preset", func() {
 				expectedDescription := "New description for this preset"
 				preset.Description = expectedDescription
-				dbInstance.UpdatePreset(preset.Name, preset)
-				res, err := dbInstance.GetPresets()
+				dbInstance.UpdatePreset("", preset.Name, preset)
+				res, err := dbInstance.GetPresets("")
 				Expect(err).NotTo(HaveOccurred())
 
 				Expect(res[0].Description).To(Equal(expectedDescription))
 			})
 
+			It("should bump the version of the preset", func() {
+				updated, err := dbInstance.UpdatePreset("", preset.Name, preset)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(updated.Version).To(Equal(int64(1)))
+
+				res, err := dbInstance.RetrievePreset("", preset.Name)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(res.Version).To(Equal(int64(1)))
+			})
+
+			It("should refuse updates made on top of an outdated version", func() {
+				_, err := dbInstance.UpdatePreset("", preset.Name, preset)
+				Expect(err).NotTo(HaveOccurred())
+
+				preset.Description = "outdated"
+				_, err = dbInstance.UpdatePreset("", preset.Name, preset)
+				Expect(err).To(Equal(ErrVersionConflict))
+
+				res, _ := dbInstance.RetrievePreset("", preset.Name)
+				Expect(res.Description).NotTo(Equal("outdated"))
+			})
+
 			Context("when the present does not exist", func() {
 				It("should return an error", func() {
-					_, err := dbInstance.RetrievePreset("invalid-preset")
+					_, err := dbInstance.RetrievePreset("", "invalid-preset")
 					Expect(err).To(HaveOccurred())
 				})
 			})
@@ -139,13 +168,71 @@ var _ = Describe("Database", func() {
 			})
 
 			It("should be able to delete a preset", func() {
-				dbInstance.DeletePreset("examplePreset")
-				presets, err := dbInstance.GetPresets()
+				dbInstance.DeletePreset("", "examplePreset")
+				presets, err := dbInstance.GetPresets("")
 				Expect(err).NotTo(HaveOccurred())
 				Expect(presets).Should(BeEmpty())
 			})
 		})
 
+		Describe("preset owners", func() {
+			JustBeforeEach(func() {
+				preset.Owner = "team-a"
+				dbInstance.StorePreset(preset)
+			})
+
+			It("should keep presets with the same name apart by owner", func() {
+				preset.Owner = "team-b"
+				preset.Description = "team b preset"
+				_, err := dbInstance.StorePreset(preset)
+				Expect(err).NotTo(HaveOccurred())
+
+				res, err := dbInstance.RetrievePreset("team-a", preset.Name)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(res.Description).To(Equal("This is an example of preset"))
+
+				res, err = dbInstance.RetrievePreset("team-b", preset.Name)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(res.Description).To(Equal("team b preset"))
+			})
+
+			It("should not find the presets of other owners", func() {
+				_, err := dbInstance.RetrievePreset("team-b", preset.Name)
+				Expect(err).To(HaveOccurred())
+
+				presets, err := dbInstance.GetPresets("team-b")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(presets).To(BeEmpty())
+
+				_, err = dbInstance.DeletePreset("team-b", preset.Name)
+				Expect(err).To(HaveOccurred())
+			})
+
+			It("should find the system presets for every owner", func() {
+				preset.Owner = types.SystemOwner
+				preset.Name = "systemPreset"
+				dbInstance.StorePreset(preset)
+
+				res, err := dbInstance.RetrievePreset("team-b", "systemPreset")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(res.Owner).To(Equal(types.SystemOwner))
+
+				presets, err := dbInstance.GetPresets("team-a")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(presets).To(HaveLen(2))
+			})
+
+			It("should prefer the preset of the owner over the system one", func() {
+				preset.Owner = types.SystemOwner
+				preset.Description = "system preset"
+				dbInstance.StorePreset(preset)
+
+				res, err := dbInstance.RetrievePreset("team-a", preset.Name)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(res.Owner).To(Equal("team-a"))
+			})
+		})
+
 		Describe("StoreJob", func() {
 			It("should be able to store a job", func() {
 				res, err := dbInstance.StoreJob(job)
@@ -199,6 +286,119 @@ var _ = Describe("Database", func() {
 			})
 		})
 
+		Describe("QueryJobs", func() {
+			var jobs []types.Job
+
+			BeforeEach(func() {
+				jobs = []types.Job{}
+				created := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+				for i, id := range []string{"a", "c", "b", "e", "d"} {
+					jobs = append(jobs, types.Job{
+						ID:          id,
+						Source:      "http://source.here/" + id + ".mp4",
+						Destination: "s3://bucket/" + id + ".mp4",
+						Preset:      types.Preset{Name: "preset" + strconv.Itoa(i%2)},
+						Status:      types.JobCreated,
+						CreatedAt:   created.Add(time.Duration(i) * time.Hour),
+					})
+				}
+				jobs[1].Status = types.JobFinished
+				jobs[3].Status = types.JobFinished
+			})
+
+			JustBeforeEach(func() {
+				for _, job := range jobs {
+					dbInstance.StoreJob(job)
+				}
+			})
+
+			ids := func(page types.JobPage) []string {
+				res := []string{}
+				for _, job := range page.Jobs {
+					res = append(res, job.ID)
+				}
+				return res
+			}
+
+			It("should return the newest jobs first by default", func() {
+				page, err := dbInstance.QueryJobs(types.JobQuery{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ids(page)).To(Equal([]string{"d", "e", "b", "c", "a"}))
+				Expect(page.NextCursor).To(BeEmpty())
+			})
+
+			It("should filter by owner", func() {
+				jobs[2].Owner = "team-a"
+				dbInstance.StoreJob(jobs[2])
+
+				page, err := dbInstance.QueryJobs(types.JobQuery{Owner: "team-a"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ids(page)).To(Equal([]string{"b"}))
+
+				page, err = dbInstance.QueryJobs(types.JobQuery{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ids(page)).To(Equal([]string{"d", "e", "c", "a"}))
+
+				page, err = dbInstance.QueryJobs(types.JobQuery{Owner: types.AnyOwner})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ids(page)).To(HaveLen(5))
+			})
+
+			It("should sort by id", func() {
+				page, err := dbInstance.QueryJobs(types.JobQuery{Sort: types.SortByID})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ids(page)).To(Equal([]string{"a", "b", "c", "d", "e"}))
+			})
+
+			It("should filter by status and preset", func() {
+				page, err := dbInstance.QueryJobs(types.JobQuery{Status: types.JobCreated, PresetName: "preset0", Sort: types.SortByCreatedAt})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ids(page)).To(Equal([]string{"a", "b", "d"}))
+			})
+
+			It("should filter by creation time", func() {
+				page, err := dbInstance.QueryJobs(types.JobQuery{
+					CreatedAfter:  jobs[0].CreatedAt,
+					CreatedBefore: jobs[4].CreatedAt,
+					Sort:          types.SortByCreatedAt,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ids(page)).To(Equal([]string{"c", "b", "e"}))
+			})
+
+			It("should filter by source and destination substrings", func() {
+				page, err := dbInstance.QueryJobs(types.JobQuery{Source: "/e.mp4", Destination: "bucket/e"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ids(page)).To(Equal([]string{"e"}))
+			})
+
+			It("should paginate with cursors", func() {
+				for _, sort := range []string{types.SortByCreatedAt, types.SortByCreatedAtDesc, types.SortByID, types.SortByIDDesc} {
+					all, err := dbInstance.QueryJobs(types.JobQuery{Sort: sort})
+					Expect(err).NotTo(HaveOccurred())
+
+					paged := []string{}
+					query := types.JobQuery{Sort: sort, Limit: 2}
+					for {
+						page, err := dbInstance.QueryJobs(query)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(len(page.Jobs)).To(BeNumerically("<=", 2))
+						paged = append(paged, ids(page)...)
+						if page.NextCursor == "" {
+							break
+						}
+						query.Cursor = page.NextCursor
+					}
+					Expect(paged).To(Equal(ids(all)))
+				}
+			})
+
+			It("should refuse an invalid sort", func() {
+				_, err := dbInstance.QueryJobs(types.JobQuery{Sort: "status"})
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
 		Describe("UpdateJob", func() {
 			JustBeforeEach(func() {
 				dbInstance.StoreJob(job)
@@ -213,6 +413,212 @@ var _ = Describe("Database", func() {
 				Expect(err).NotTo(HaveOccurred())
 				Expect(res[0].Status).To(Equal(expectedStatus))
 			})
+
+			It("should refuse updates made on top of an outdated version", func() {
+				updated, err := dbInstance.UpdateJob(job.ID, job)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(updated.Version).To(Equal(int64(1)))
+
+				job.Status = types.JobError
+				_, err = dbInstance.UpdateJob(job.ID, job)
+				Expect(err).To(Equal(ErrVersionConflict))
+
+				res, err := dbInstance.RetrieveJob(job.ID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(res.Status).To(Equal(types.JobCreated))
+				Expect(res.Version).To(Equal(int64(1)))
+			})
+		})
+
+		Describe("ModifyJob", func() {
+			JustBeforeEach(func() {
+				dbInstance.StoreJob(job)
+			})
+
+			It("should apply the changes on top of the latest version", func() {
+				job.Details = "updated meanwhile"
+				dbInstance.UpdateJob(job.ID, job)
+
+				res, err := ModifyJob(dbInstance, job.ID, func(job *types.Job) error {
+					job.Status = types.JobEncoding
+					return nil
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(res.Status).To(Equal(types.JobEncoding))
+				Expect(res.Details).To(Equal("updated meanwhile"))
+				Expect(res.Version).To(Equal(int64(2)))
+			})
+
+			It("should not update the job if the changes fail", func() {
+				_, err := ModifyJob(dbInstance, job.ID, func(job *types.Job) error {
+					job.Status = types.JobEncoding
+					return errors.New("changes failed")
+				})
+				Expect(err).To(MatchError("changes failed"))
+
+				res, _ := dbInstance.RetrieveJob(job.ID)
+				Expect(res.Status).To(Equal(types.JobCreated))
+			})
+		})
+
+		Describe("leases", func() {
+			JustBeforeEach(func() {
+				dbInstance.StoreJob(job)
+			})
+
+			It("should lease the job to a single worker", func() {
+				results := make(chan error, 5)
+				for i := 0; i < 5; i++ {
+					go func(worker string) {
+						_, err := AcquireLease(dbInstance, job.ID, worker, time.Minute)
+						results <- err
+					}("worker-" + strconv.Itoa(i))
+				}
+
+				leased := 0
+				for i := 0; i < 5; i++ {
+					if <-results == nil {
+						leased++
+					}
+				}
+				Expect(leased).To(Equal(1))
+			})
+
+			It("should renew the lease of the worker holding it", func() {
+				first, _ := AcquireLease(dbInstance, job.ID, "worker-1", time.Minute)
+				res, err := AcquireLease(dbInstance, job.ID, "worker-1", time.Hour)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(res.Lease.ExpiresAt).To(BeTemporally(">", first.Lease.ExpiresAt))
+
+				_, err = AcquireLease(dbInstance, job.ID, "worker-2", time.Minute)
+				Expect(err).To(Equal(ErrLeaseHeld))
+			})
+
+			It("should let other workers take over an expired lease", func() {
+				AcquireLease(dbInstance, job.ID, "worker-1", -time.Second)
+				res, err := AcquireLease(dbInstance, job.ID, "worker-2", time.Minute)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(res.Lease.Worker).To(Equal("worker-2"))
+
+				Expect(ReleaseLease(dbInstance, job.ID, "worker-1")).To(Equal(ErrLeaseHeld))
+			})
+
+			It("should release the lease", func() {
+				AcquireLease(dbInstance, job.ID, "worker-1", time.Minute)
+				Expect(ReleaseLease(dbInstance, job.ID, "worker-1")).To(Succeed())
+
+				res, _ := dbInstance.RetrieveJob(job.ID)
+				Expect(res.Lease).To(BeNil())
+			})
+
+			It("should stop the writes of a worker that lost the lease", func() {
+				AcquireLease(dbInstance, job.ID, "worker-1", -time.Second)
+				leased := WithLease(dbInstance, job.ID, "worker-1")
+				_, err := ModifyJob(leased, job.ID, func(job *types.Job) error {
+					job.Status = types.JobEncoding
+					return nil
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				AcquireLease(dbInstance, job.ID, "worker-2", time.Minute)
+				_, err = ModifyJob(leased, job.ID, func(job *types.Job) error {
+					job.Status = types.JobError
+					return nil
+				})
+				Expect(err).To(Equal(ErrLeaseLost))
+				Expect(leased.UpdateJobProgress(job.ID, types.Progress{Percent: 50})).To(Equal(ErrLeaseLost))
+
+				res, _ := dbInstance.RetrieveJob(job.ID)
+				Expect(res.Status).To(Equal(types.JobEncoding))
+				Expect(res.Progress.Percent).To(BeZero())
+			})
+		})
+
+		Describe("UpdateJobProgress", func() {
+			JustBeforeEach(func() {
+				job.Status = types.JobEncoding
+				dbInstance.StoreJob(job)
+			})
+
+			It("should update only the progress of the job", func() {
+				progress := types.NewProgress(types.StageEncode, 50, 100, types.ProgressFrames, 25)
+				Expect(dbInstance.UpdateJobProgress(job.ID, progress)).To(Succeed())
+
+				res, err := dbInstance.RetrieveJob(job.ID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(res.Progress).To(Equal(progress))
+				Expect(res.ProgressText).To(Equal("50.00%"))
+				Expect(res.Status).To(Equal(types.JobEncoding))
+				Expect(res.Source).To(Equal(job.Source))
+			})
+
+			It("should fail for a job that does not exist", func() {
+				progress := types.NewProgress(types.StageEncode, 50, 100, types.ProgressFrames, 25)
+				Expect(dbInstance.UpdateJobProgress("missing", progress)).NotTo(Succeed())
+			})
+		})
+
+		Describe("CountJobsByStatus", func() {
+			It("should count the jobs on each status", func() {
+				for i, status := range []types.JobStatus{types.JobCreated, types.JobEncoding, types.JobEncoding} {
+					job.ID = "job-" + strconv.Itoa(i)
+					job.Status = status
+					dbInstance.StoreJob(job)
+				}
+
+				counts, err := dbInstance.CountJobsByStatus()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(counts).To(Equal(map[types.JobStatus]int{types.JobCreated: 1, types.JobEncoding: 2}))
+			})
+		})
+
+		Describe("API keys", func() {
+			var key types.APIKey
+
+			BeforeEach(func() {
+				key = types.APIKey{ID: "123", Name: "encoder", Hash: "abc", Scopes: []types.APIScope{types.ScopeReadJobs}}
+			})
+
+			It("should store and retrieve a key", func() {
+				_, err := dbInstance.StoreAPIKey(key)
+				Expect(err).NotTo(HaveOccurred())
+
+				res, err := dbInstance.RetrieveAPIKey("123")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(res.Name).To(Equal("encoder"))
+				Expect(res.Hash).To(Equal("abc"))
+				Expect(res.Scopes).To(Equal(key.Scopes))
+			})
+
+			It("should fail to store a key that already exists", func() {
+				dbInstance.StoreAPIKey(key)
+				_, err := dbInstance.StoreAPIKey(key)
+				Expect(err).To(HaveOccurred())
+			})
+
+			It("should list the keys", func() {
+				dbInstance.StoreAPIKey(key)
+				keys, err := dbInstance.GetAPIKeys()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(keys).To(HaveLen(1))
+			})
+
+			It("should delete a key", func() {
+				dbInstance.StoreAPIKey(key)
+				_, err := dbInstance.DeleteAPIKey("123")
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = dbInstance.RetrieveAPIKey("123")
+				Expect(err).To(HaveOccurred())
+				_, err = dbInstance.DeleteAPIKey("123")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Describe("Ping", func() {
+			It("should reach the storage", func() {
+				Expect(dbInstance.Ping()).To(Succeed())
+			})
 		})
 	}
 
@@ -229,6 +635,101 @@ var _ = Describe("Database", func() {
 		runDatabaseSuite()
 	})
 
+	Describe("when the storage is boltdb", func() {
+		var dbPath string
+
+		BeforeEach(func() {
+			tmpDir, _ := ioutil.TempDir(os.TempDir(), "snickers-bolt")
+			dbPath = filepath.Join(tmpDir, "snickers.db")
+			cfg, _ := gonfig.FromJson(strings.NewReader(`{"DATABASE_DRIVER":"bolt", "BOLTDB_PATH":"` + dbPath + `"}`))
+			dbInstance, _ = GetDatabase(cfg)
+		})
+
+		AfterEach(func() {
+			dbInstance.ClearDatabase()
+		})
+
+		runDatabaseSuite()
+
+		It("should keep the local paths used by the pipeline", func() {
+			job.LocalSource = "/tmp/123/src/source.mp4"
+			job.LocalDestination = "/tmp/123/dst/source.mp4"
+			dbInstance.StoreJob(job)
+
+			res, err := dbInstance.RetrieveJob("123")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal(job))
+		})
+
+		It("should keep the data when the file is opened again", func() {
+			otherPath := filepath.Join(filepath.Dir(dbPath), "other.db")
+			instance, err := openBoltDatabase(otherPath)
+			Expect(err).NotTo(HaveOccurred())
+			instance.StoreJob(job)
+			instance.db.Close()
+
+			instance, err = openBoltDatabase(otherPath)
+			Expect(err).NotTo(HaveOccurred())
+			defer instance.db.Close()
+			res, err := instance.RetrieveJob("123")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal(job))
+		})
+
+		It("should refuse files with a newer schema version", func() {
+			otherPath := filepath.Join(filepath.Dir(dbPath), "newer.db")
+			raw, _ := bolt.Open(otherPath, 0600, nil)
+			raw.Update(func(tx *bolt.Tx) error {
+				meta, _ := tx.CreateBucketIfNotExists(boltMetaBucket)
+				return meta.Put(boltSchemaVersionKey, []byte{0, 0, 0, 0, 0, 0, 0, 99})
+			})
+			raw.Close()
+
+			_, err := openBoltDatabase(otherPath)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("when the storage is postgres", func() {
+		var postgresURL string
+
+		BeforeEach(func() {
+			postgresURL = os.Getenv("POSTGRES_URL")
+			if postgresURL == "" {
+				postgresURL = "postgres://postgres@localhost/snickers_test?sslmode=disable"
+			}
+			cfg, _ := gonfig.FromJson(strings.NewReader(`{"DATABASE_DRIVER":"postgres", "POSTGRES_URL":"` + postgresURL + `"}`))
+			dbInstance, _ = GetDatabase(cfg)
+		})
+
+		AfterEach(func() {
+			dbInstance.ClearDatabase()
+		})
+
+		runDatabaseSuite()
+
+		It("should keep the local paths used by the pipeline", func() {
+			job.LocalSource = "/tmp/123/src/source.mp4"
+			dbInstance.StoreJob(job)
+
+			res, err := dbInstance.RetrieveJob("123")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal(job))
+		})
+
+		It("should fail to delete a job that does not exist", func() {
+			_, err := dbInstance.DeleteJob("invalid-job")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should be on the current schema version after migrating", func() {
+			cfg, _ := gonfig.FromJson(strings.NewReader(`{"POSTGRES_URL":"` + postgresURL + `"}`))
+			_, to, err := MigratePostgres(cfg)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(to).To(Equal(len(postgresMigrations)))
+		})
+	})
+
 	Describe("when the storage is mongodb", func() {
 		Describe("When it connects", func() {
 			BeforeEach(func() {
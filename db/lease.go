@@ -0,0 +1,81 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/snickers/snickers/types"
+)
+
+// ErrLeaseHeld is returned when leasing a job held by another worker
+var ErrLeaseHeld = errors.New("job is leased by another worker")
+
+// AcquireLease leases the job to the worker for ttl. It renews the
+// lease the worker already holds and takes over expired ones. As
+// jobs are only updated on top of their stored version, a job is
+// never leased to two workers at once, whatever the driver.
+func AcquireLease(dbInstance Storage, jobID string, worker string, ttl time.Duration) (types.Job, error) {
+	return ModifyJob(dbInstance, jobID, func(job *types.Job) error {
+		now := time.Now()
+		if job.Lease != nil && job.Lease.Worker != worker && job.Lease.ExpiresAt.After(now) {
+			return ErrLeaseHeld
+		}
+		job.Lease = &types.JobLease{Worker: worker, ExpiresAt: now.Add(ttl)}
+		return nil
+	})
+}
+
+// ReleaseLease gives up the lease the worker holds on the job
+func ReleaseLease(dbInstance Storage, jobID string, worker string) error {
+	_, err := ModifyJob(dbInstance, jobID, func(job *types.Job) error {
+		if job.Lease == nil || job.Lease.Worker != worker {
+			return ErrLeaseHeld
+		}
+		job.Lease = nil
+		return nil
+	})
+	return err
+}
+
+// ErrLeaseLost is returned by the writes to a job made through
+// WithLease once the worker no longer holds its lease
+var ErrLeaseLost = errors.New("lease on the job was lost")
+
+// leasedStorage writes a job only while the worker holds its lease
+type leasedStorage struct {
+	Storage
+	jobID  string
+	worker string
+}
+
+// WithLease returns a storage failing the writes to the job with
+// ErrLeaseLost once the worker no longer holds its lease. As jobs
+// are only updated on top of their stored version, a job taken over
+// by another worker is never written by the one that lost it.
+func WithLease(dbInstance Storage, jobID string, worker string) Storage {
+	return &leasedStorage{Storage: dbInstance, jobID: jobID, worker: worker}
+}
+
+func (s *leasedStorage) UpdateJob(id string, job types.Job) (types.Job, error) {
+	if id == s.jobID && !s.holds(job) {
+		return job, ErrLeaseLost
+	}
+	return s.Storage.UpdateJob(id, job)
+}
+
+func (s *leasedStorage) UpdateJobProgress(id string, progress types.Progress) error {
+	if id == s.jobID {
+		job, err := s.Storage.RetrieveJob(id)
+		if err != nil {
+			return err
+		}
+		if !s.holds(job) {
+			return ErrLeaseLost
+		}
+	}
+	return s.Storage.UpdateJobProgress(id, progress)
+}
+
+func (s *leasedStorage) holds(job types.Job) bool {
+	return job.Lease != nil && job.Lease.Worker == s.worker
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"errors"
 	"github.com/snickers/snickers/types"
+	"sort"
 	"sync"
 )
 
@@ -10,8 +11,16 @@ import (
 type memoryDatabase struct {
 	mtx sync.RWMutex
 
-	presets map[string]types.Preset
+	presets map[presetKey]types.Preset
 	jobs    map[string]types.Job
+	apiKeys map[string]types.APIKey
+}
+
+// presetKey identifies a preset, as names are only unique
+// among the presets of an owner
+type presetKey struct {
+	owner string
+	name  string
 }
 
 var databaseInit sync.Once
@@ -21,8 +30,9 @@ var memoryInstance *memoryDatabase
 func getMemoryDatabase() (Storage, error) {
 	databaseInit.Do(func() {
 		memoryInstance = &memoryDatabase{}
-		memoryInstance.presets = map[string]types.Preset{}
+		memoryInstance.presets = map[presetKey]types.Preset{}
 		memoryInstance.jobs = map[string]types.Job{}
+		memoryInstance.apiKeys = map[string]types.APIKey{}
 	})
 
 	return memoryInstance, nil
@@ -33,65 +43,80 @@ func (r *memoryDatabase) ClearDatabase() error {
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
 
-	memoryInstance.presets = map[string]types.Preset{}
+	memoryInstance.presets = map[presetKey]types.Preset{}
 	memoryInstance.jobs = map[string]types.Job{}
+	memoryInstance.apiKeys = map[string]types.APIKey{}
 	return nil
 }
 
 // StorePreset stores preset information
 func (r *memoryDatabase) StorePreset(preset types.Preset) (types.Preset, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
 
 	//prevent replacing existing preset
-	if _, err := r.RetrievePreset(preset.Name); err == nil {
+	key := presetKey{preset.Owner, preset.Name}
+	if _, ok := r.presets[key]; ok {
 		return types.Preset{}, errors.New("Error 409: Preset already exists, please update instead.")
 	}
 
-	r.mtx.Lock()
-	defer r.mtx.Unlock()
-
-	r.presets[preset.Name] = preset
+	r.presets[key] = preset
 	return preset, nil
 }
 
-// RetrievePreset retrieves one preset from the database
-func (r *memoryDatabase) RetrievePreset(presetName string) (types.Preset, error) {
+// RetrievePreset retrieves one preset of the owner, or the system
+// preset with that name, from the database
+func (r *memoryDatabase) RetrievePreset(owner string, presetName string) (types.Preset, error) {
 	r.mtx.RLock()
 	defer r.mtx.RUnlock()
 
-	if val, ok := r.presets[presetName]; ok {
+	if val, ok := r.presets[presetKey{owner, presetName}]; ok {
+		return val, nil
+	}
+	if val, ok := r.presets[presetKey{types.SystemOwner, presetName}]; ok {
 		return val, nil
 	}
 	return types.Preset{}, errors.New("preset not found")
 }
 
 // UpdatePreset updates a preset
-func (r *memoryDatabase) UpdatePreset(presetName string, newPreset types.Preset) (types.Preset, error) {
+func (r *memoryDatabase) UpdatePreset(owner string, presetName string, newPreset types.Preset) (types.Preset, error) {
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
 
-	r.presets[presetName] = newPreset
+	key := presetKey{owner, presetName}
+	if current, ok := r.presets[key]; ok && current.Version != newPreset.Version {
+		return types.Preset{}, ErrVersionConflict
+	}
+	newPreset.Owner = owner
+	newPreset.Version++
+	r.presets[key] = newPreset
 	return newPreset, nil
 }
 
-// GetPresets retrieves all presets of the database
-func (r *memoryDatabase) GetPresets() ([]types.Preset, error) {
+// GetPresets retrieves the presets of the owner and the
+// system presets from the database
+func (r *memoryDatabase) GetPresets(owner string) ([]types.Preset, error) {
 	r.mtx.RLock()
 	defer r.mtx.RUnlock()
 
 	res := make([]types.Preset, 0, len(r.presets))
 	for _, value := range r.presets {
-		res = append(res, value)
+		if visiblePreset(value, owner) {
+			res = append(res, value)
+		}
 	}
 	return res, nil
 }
 
 // DeletePreset deletes a preset from the database
-func (r *memoryDatabase) DeletePreset(presetName string) (types.Preset, error) {
+func (r *memoryDatabase) DeletePreset(owner string, presetName string) (types.Preset, error) {
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
 
-	if val, ok := r.presets[presetName]; ok {
-		delete(r.presets, presetName)
+	key := presetKey{owner, presetName}
+	if val, ok := r.presets[key]; ok {
+		delete(r.presets, key)
 		return val, nil
 	}
 	return types.Preset{}, errors.New("preset not found")
@@ -133,10 +158,28 @@ func (r *memoryDatabase) UpdateJob(jobID string, newJob types.Job) (types.Job, e
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
 
+	if current, ok := r.jobs[jobID]; ok && current.Version != newJob.Version {
+		return types.Job{}, ErrVersionConflict
+	}
+	newJob.Version++
 	r.jobs[jobID] = newJob
 	return newJob, nil
 }
 
+// UpdateJobProgress updates only the progress of a job
+func (r *memoryDatabase) UpdateJobProgress(jobID string, progress types.Progress) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	job, ok := r.jobs[jobID]
+	if !ok {
+		return errors.New("job not found")
+	}
+	job.SetProgress(progress)
+	r.jobs[jobID] = job
+	return nil
+}
+
 //GetJobs retrieves all jobs of the database
 func (r *memoryDatabase) GetJobs() ([]types.Job, error) {
 	r.mtx.RLock()
@@ -148,3 +191,99 @@ func (r *memoryDatabase) GetJobs() ([]types.Job, error) {
 	}
 	return res, nil
 }
+
+// CountJobsByStatus counts the jobs on each status
+func (r *memoryDatabase) CountJobsByStatus() (map[types.JobStatus]int, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	counts := map[types.JobStatus]int{}
+	for _, job := range r.jobs {
+		counts[job.Status]++
+	}
+	return counts, nil
+}
+
+// Ping tells if the database is reachable
+func (r *memoryDatabase) Ping() error {
+	return nil
+}
+
+// QueryJobs retrieves a page of jobs
+func (r *memoryDatabase) QueryJobs(query types.JobQuery) (types.JobPage, error) {
+	query, cursor, err := normalizeJobQuery(query)
+	if err != nil {
+		return types.JobPage{}, err
+	}
+
+	r.mtx.RLock()
+	res := []types.Job{}
+	for _, value := range r.jobs {
+		if matchesJobQuery(value, query) && afterJobCursor(value, cursor, query.Sort) {
+			res = append(res, value)
+		}
+	}
+	r.mtx.RUnlock()
+
+	sort.Sort(jobsByQuery{jobs: res, sort: query.Sort})
+	if len(res) > query.Limit+1 {
+		res = res[:query.Limit+1]
+	}
+	return newJobPage(res, query.Limit), nil
+}
+
+type jobsByQuery struct {
+	jobs []types.Job
+	sort string
+}
+
+func (j jobsByQuery) Len() int           { return len(j.jobs) }
+func (j jobsByQuery) Swap(a, b int)      { j.jobs[a], j.jobs[b] = j.jobs[b], j.jobs[a] }
+func (j jobsByQuery) Less(a, b int) bool { return jobLess(j.jobs[a], j.jobs[b], j.sort) }
+
+// StoreAPIKey stores an API key
+func (r *memoryDatabase) StoreAPIKey(key types.APIKey) (types.APIKey, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if _, ok := r.apiKeys[key.ID]; ok {
+		return types.APIKey{}, errors.New("api key already exists")
+	}
+	r.apiKeys[key.ID] = key
+	return key, nil
+}
+
+// RetrieveAPIKey retrieves one API key from the database
+func (r *memoryDatabase) RetrieveAPIKey(keyID string) (types.APIKey, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	if val, ok := r.apiKeys[keyID]; ok {
+		return val, nil
+	}
+	return types.APIKey{}, errors.New("api key not found")
+}
+
+// GetAPIKeys retrieves all API keys of the database
+func (r *memoryDatabase) GetAPIKeys() ([]types.APIKey, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	res := make([]types.APIKey, 0, len(r.apiKeys))
+	for _, value := range r.apiKeys {
+		res = append(res, value)
+	}
+	return res, nil
+}
+
+// DeleteAPIKey deletes an API key from the database
+func (r *memoryDatabase) DeleteAPIKey(keyID string) (types.APIKey, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if val, ok := r.apiKeys[keyID]; ok {
+		delete(r.apiKeys, keyID)
+		return val, nil
+	}
+	return types.APIKey{}, errors.New("api key not found")
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"errors"
+	"regexp"
 	"sync"
 
 	"github.com/flavioribeiro/gonfig"
@@ -47,14 +48,15 @@ func (r *mongoDatabase) ClearDatabase() error {
 
 // StorePreset stores preset information
 func (r *mongoDatabase) StorePreset(preset types.Preset) (types.Preset, error) {
+	c := r.db.C("presets")
 
 	//prevent replacing existing preset
-	if _, err := r.RetrievePreset(preset.Name); err == nil {
+	if n, err := c.Find(bson.M{"owner": mongoOwner(preset.Owner), "name": preset.Name}).Count(); err != nil {
+		return types.Preset{}, err
+	} else if n > 0 {
 		return types.Preset{}, errors.New("Error 409: Preset already exists, please update instead.")
 	}
 
-	c := r.db.C("presets")
-
 	err := c.Insert(preset)
 	if err != nil {
 		return types.Preset{}, err
@@ -63,41 +65,54 @@ func (r *mongoDatabase) StorePreset(preset types.Preset) (types.Preset, error) {
 }
 
 // UpdatePreset updates a preset
-func (r *mongoDatabase) UpdatePreset(presetName string, newPreset types.Preset) (types.Preset, error) {
+func (r *mongoDatabase) UpdatePreset(owner string, presetName string, newPreset types.Preset) (types.Preset, error) {
 	c := r.db.C("presets")
-	err := c.Update(bson.M{"name": presetName}, newPreset)
-	if err != nil {
+	selector := bson.M{"owner": mongoOwner(owner), "name": presetName, "version": mongoVersion(newPreset.Version)}
+	newPreset.Owner = owner
+	newPreset.Version++
+	err := c.Update(selector, newPreset)
+	if err == mgo.ErrNotFound {
+		return types.Preset{}, r.conflictOrNotFound(c, bson.M{"owner": mongoOwner(owner), "name": presetName}, err)
+	} else if err != nil {
 		return types.Preset{}, err
 	}
 	return newPreset, nil
 }
 
-// RetrievePreset retrieves one preset from the database
-func (r *mongoDatabase) RetrievePreset(presetName string) (types.Preset, error) {
+// RetrievePreset retrieves one preset of the owner, or the system
+// preset with that name, from the database
+func (r *mongoDatabase) RetrievePreset(owner string, presetName string) (types.Preset, error) {
 	c := r.db.C("presets")
 	result := types.Preset{}
-	err := c.Find(bson.M{"name": presetName}).One(&result)
+	err := c.Find(bson.M{"owner": mongoOwner(owner), "name": presetName}).One(&result)
+	if err == mgo.ErrNotFound {
+		err = c.Find(bson.M{"owner": types.SystemOwner, "name": presetName}).One(&result)
+	}
 	return result, err
 }
 
-// GetPresets retrieves all presets of the database
-func (r *mongoDatabase) GetPresets() ([]types.Preset, error) {
+// GetPresets retrieves the presets of the owner and the
+// system presets from the database
+func (r *mongoDatabase) GetPresets(owner string) ([]types.Preset, error) {
 	results := []types.Preset{}
 	c := r.db.C("presets")
-	err := c.Find(nil).All(&results)
+	err := c.Find(bson.M{"$or": []bson.M{
+		{"owner": mongoOwner(owner)},
+		{"owner": types.SystemOwner},
+	}}).All(&results)
 	return results, err
 }
 
 // DeletePreset deletes a preset from the database
-func (r *mongoDatabase) DeletePreset(presetName string) (types.Preset, error) {
-	result, err := r.RetrievePreset(presetName)
-	if err != nil {
+func (r *mongoDatabase) DeletePreset(owner string, presetName string) (types.Preset, error) {
+	c := r.db.C("presets")
+	selector := bson.M{"owner": mongoOwner(owner), "name": presetName}
+
+	result := types.Preset{}
+	if err := c.Find(selector).One(&result); err != nil {
 		return types.Preset{}, err
 	}
-
-	c := r.db.C("presets")
-	err = c.Remove(bson.M{"name": presetName})
-	if err != nil {
+	if err := c.Remove(selector); err != nil {
 		return types.Preset{}, err
 	}
 	return result, nil
@@ -139,13 +154,29 @@ func (r *mongoDatabase) RetrieveJob(jobID string) (types.Job, error) {
 // UpdateJob updates a job
 func (r *mongoDatabase) UpdateJob(jobID string, newJob types.Job) (types.Job, error) {
 	c := r.db.C("jobs")
-	err := c.Update(bson.M{"id": jobID}, newJob)
-	if err != nil {
+	selector := bson.M{"id": jobID, "version": mongoVersion(newJob.Version)}
+	newJob.Version++
+	err := c.Update(selector, newJob)
+	if err == mgo.ErrNotFound {
+		return types.Job{}, r.conflictOrNotFound(c, bson.M{"id": jobID}, err)
+	} else if err != nil {
 		return types.Job{}, err
 	}
 	return newJob, nil
 }
 
+// UpdateJobProgress updates only the progress of a job
+func (r *mongoDatabase) UpdateJobProgress(jobID string, progress types.Progress) error {
+	job := types.Job{}
+	job.SetProgress(progress)
+
+	c := r.db.C("jobs")
+	return c.Update(bson.M{"id": jobID}, bson.M{"$set": bson.M{
+		"progress":     job.Progress,
+		"progresstext": job.ProgressText,
+	}})
+}
+
 //GetJobs retrieves all jobs of the database
 func (r *mongoDatabase) GetJobs() ([]types.Job, error) {
 	results := []types.Job{}
@@ -153,3 +184,164 @@ func (r *mongoDatabase) GetJobs() ([]types.Job, error) {
 	err := c.Find(nil).All(&results)
 	return results, err
 }
+
+// CountJobsByStatus counts the jobs on each status
+func (r *mongoDatabase) CountJobsByStatus() (map[types.JobStatus]int, error) {
+	results := []struct {
+		Status types.JobStatus `bson:"_id"`
+		Count  int             `bson:"count"`
+	}{}
+	err := r.db.C("jobs").Pipe([]bson.M{
+		{"$group": bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}},
+	}).All(&results)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[types.JobStatus]int{}
+	for _, result := range results {
+		counts[result.Status] = result.Count
+	}
+	return counts, nil
+}
+
+// Ping tells if the database is reachable
+func (r *mongoDatabase) Ping() error {
+	return r.db.Session.Ping()
+}
+
+// StoreAPIKey stores an API key
+func (r *mongoDatabase) StoreAPIKey(key types.APIKey) (types.APIKey, error) {
+	if _, err := r.RetrieveAPIKey(key.ID); err == nil {
+		return types.APIKey{}, errors.New("api key already exists")
+	}
+
+	c := r.db.C("apikeys")
+	if err := c.Insert(key); err != nil {
+		return types.APIKey{}, err
+	}
+	return key, nil
+}
+
+// RetrieveAPIKey retrieves one API key from the database
+func (r *mongoDatabase) RetrieveAPIKey(keyID string) (types.APIKey, error) {
+	c := r.db.C("apikeys")
+	result := types.APIKey{}
+	err := c.Find(bson.M{"id": keyID}).One(&result)
+	return result, err
+}
+
+// GetAPIKeys retrieves all API keys of the database
+func (r *mongoDatabase) GetAPIKeys() ([]types.APIKey, error) {
+	results := []types.APIKey{}
+	c := r.db.C("apikeys")
+	err := c.Find(nil).All(&results)
+	return results, err
+}
+
+// DeleteAPIKey deletes an API key from the database
+func (r *mongoDatabase) DeleteAPIKey(keyID string) (types.APIKey, error) {
+	result, err := r.RetrieveAPIKey(keyID)
+	if err != nil {
+		return types.APIKey{}, err
+	}
+
+	c := r.db.C("apikeys")
+	if err := c.Remove(bson.M{"id": keyID}); err != nil {
+		return types.APIKey{}, err
+	}
+	return result, nil
+}
+
+// QueryJobs retrieves a page of jobs
+func (r *mongoDatabase) QueryJobs(query types.JobQuery) (types.JobPage, error) {
+	query, cursor, err := normalizeJobQuery(query)
+	if err != nil {
+		return types.JobPage{}, err
+	}
+
+	filters := []bson.M{}
+	if query.Owner != types.AnyOwner {
+		filters = append(filters, bson.M{"owner": mongoOwner(query.Owner)})
+	}
+	if query.Status != "" {
+		filters = append(filters, bson.M{"status": query.Status})
+	}
+	if query.PresetName != "" {
+		filters = append(filters, bson.M{"preset.name": query.PresetName})
+	}
+	if !query.CreatedAfter.IsZero() {
+		filters = append(filters, bson.M{"createdat": bson.M{"$gt": query.CreatedAfter}})
+	}
+	if !query.CreatedBefore.IsZero() {
+		filters = append(filters, bson.M{"createdat": bson.M{"$lt": query.CreatedBefore}})
+	}
+	if query.Source != "" {
+		filters = append(filters, bson.M{"source": bson.RegEx{Pattern: regexp.QuoteMeta(query.Source)}})
+	}
+	if query.Destination != "" {
+		filters = append(filters, bson.M{"destination": bson.RegEx{Pattern: regexp.QuoteMeta(query.Destination)}})
+	}
+
+	op := "$gt"
+	if query.Sort == types.SortByCreatedAtDesc || query.Sort == types.SortByIDDesc {
+		op = "$lt"
+	}
+
+	sortFields := []string{"id"}
+	if query.Sort == types.SortByCreatedAt || query.Sort == types.SortByCreatedAtDesc {
+		sortFields = []string{"createdat", "id"}
+		if cursor != nil {
+			filters = append(filters, bson.M{"$or": []bson.M{
+				{"createdat": bson.M{op: cursor.CreatedAt}},
+				{"createdat": cursor.CreatedAt, "id": bson.M{op: cursor.ID}},
+			}})
+		}
+	} else if cursor != nil {
+		filters = append(filters, bson.M{"id": bson.M{op: cursor.ID}})
+	}
+	if op == "$lt" {
+		for i, field := range sortFields {
+			sortFields[i] = "-" + field
+		}
+	}
+
+	selector := bson.M{}
+	if len(filters) > 0 {
+		selector = bson.M{"$and": filters}
+	}
+
+	results := []types.Job{}
+	c := r.db.C("jobs")
+	err = c.Find(selector).Sort(sortFields...).Limit(query.Limit + 1).All(&results)
+	if err != nil {
+		return types.JobPage{}, err
+	}
+	return newJobPage(results, query.Limit), nil
+}
+
+// mongoVersion matches a version on updates. Documents stored
+// before versions existed have none, which counts as version 0.
+func mongoVersion(version int64) interface{} {
+	if version == 0 {
+		return bson.M{"$in": []interface{}{0, nil}}
+	}
+	return version
+}
+
+// mongoOwner matches an owner. Documents stored before owners
+// existed have none, which counts as the default tenant.
+func mongoOwner(owner string) interface{} {
+	if owner == "" {
+		return bson.M{"$in": []interface{}{"", nil}}
+	}
+	return owner
+}
+
+// conflictOrNotFound tells why an update matched no document
+func (r *mongoDatabase) conflictOrNotFound(c *mgo.Collection, selector bson.M, err error) error {
+	if n, countErr := c.Find(selector).Count(); countErr == nil && n > 0 {
+		return ErrVersionConflict
+	}
+	return err
+}
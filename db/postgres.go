@@ -0,0 +1,633 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/flavioribeiro/gonfig"
+	// registers the postgres driver on database/sql
+	_ "github.com/lib/pq"
+	"github.com/snickers/snickers/types"
+)
+
+// postgresMigrations brings the database from one schema version
+// to the next. New migrations must only be appended.
+var postgresMigrations = []string{
+	// 1: presets and jobs
+	`CREATE TABLE presets (
+		name       TEXT PRIMARY KEY,
+		data       JSONB NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	CREATE TABLE jobs (
+		id          TEXT PRIMARY KEY,
+		status      TEXT NOT NULL,
+		preset_name TEXT NOT NULL,
+		source      TEXT NOT NULL,
+		destination TEXT NOT NULL,
+		data        JSONB NOT NULL,
+		created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+		updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	CREATE INDEX jobs_status_idx ON jobs (status);
+	CREATE INDEX jobs_created_at_idx ON jobs (created_at);`,
+	// 2: API keys
+	`CREATE TABLE api_keys (
+		id         TEXT PRIMARY KEY,
+		data       JSONB NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);`,
+	// 3: owners of presets and jobs
+	`ALTER TABLE presets ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+	ALTER TABLE presets DROP CONSTRAINT presets_pkey;
+	ALTER TABLE presets ADD PRIMARY KEY (owner, name);
+	ALTER TABLE jobs ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+	CREATE INDEX jobs_owner_idx ON jobs (owner);`,
+}
+
+// postgresMigrationLock is the advisory lock held while migrating,
+// so instances starting together don't migrate twice
+const postgresMigrationLock = 7135
+
+// Database struct that persists configurations on PostgreSQL
+type postgresDatabase struct {
+	db *sql.DB
+}
+
+var postgresInstancesMtx sync.Mutex
+var postgresInstances = map[string]*postgresDatabase{}
+
+// getPostgresDatabase returns the database on POSTGRES_URL, migrating
+// its schema unless POSTGRES_AUTO_MIGRATE is false
+func getPostgresDatabase(cfg gonfig.Gonfig) (Storage, error) {
+	postgresURL, err := cfg.GetString("POSTGRES_URL", "")
+	if err != nil {
+		return nil, err
+	}
+
+	autoMigrate, err := cfg.GetBool("POSTGRES_AUTO_MIGRATE", true)
+	if err != nil {
+		return nil, err
+	}
+
+	postgresInstancesMtx.Lock()
+	defer postgresInstancesMtx.Unlock()
+
+	if instance, ok := postgresInstances[postgresURL]; ok {
+		return instance, nil
+	}
+
+	instance, err := openPostgresDatabase(postgresURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if autoMigrate {
+		_, err = instance.migrate()
+	} else {
+		err = instance.checkSchema()
+	}
+	if err != nil {
+		instance.db.Close()
+		return nil, err
+	}
+
+	postgresInstances[postgresURL] = instance
+	return instance, nil
+}
+
+// MigratePostgres brings the database on POSTGRES_URL to the current
+// schema version and returns the versions before and after it
+func MigratePostgres(cfg gonfig.Gonfig) (int, int, error) {
+	postgresURL, err := cfg.GetString("POSTGRES_URL", "")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	instance, err := openPostgresDatabase(postgresURL)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer instance.db.Close()
+
+	from, err := instance.schemaVersion()
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := instance.migrate()
+	return from, to, err
+}
+
+func openPostgresDatabase(postgresURL string) (*postgresDatabase, error) {
+	db, err := sql.Open("postgres", postgresURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &postgresDatabase{db: db}, nil
+}
+
+func (r *postgresDatabase) schemaVersion() (int, error) {
+	var version int
+	err := r.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// checkSchema fails unless the database is on the current
+// schema version
+func (r *postgresDatabase) checkSchema() error {
+	version, err := r.schemaVersion()
+	if err != nil {
+		return err
+	}
+	if version != len(postgresMigrations) {
+		return fmt.Errorf("database schema is on version %d, expected %d: run snickers-migrate", version, len(postgresMigrations))
+	}
+	return nil
+}
+
+// migrate applies the pending migrations, each one on its
+// own transaction, and returns the resulting schema version
+func (r *postgresDatabase) migrate() (int, error) {
+	for {
+		version, done, err := r.migrateOnce()
+		if err != nil || done {
+			return version, err
+		}
+	}
+}
+
+func (r *postgresDatabase) migrateOnce() (int, bool, error) {
+	var version int
+	err := r.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, postgresMigrationLock); err != nil {
+			return err
+		}
+		if err := tx.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+			return err
+		}
+		if version > len(postgresMigrations) {
+			return fmt.Errorf("database schema version %d is newer than the supported %d", version, len(postgresMigrations))
+		}
+		if version == len(postgresMigrations) {
+			return nil
+		}
+
+		if _, err := tx.Exec(postgresMigrations[version]); err != nil {
+			return fmt.Errorf("migrating database schema to version %d: %s", version+1, err)
+		}
+		version++
+		_, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES ($1)`, version)
+		return err
+	})
+	return version, version == len(postgresMigrations), err
+}
+
+func (r *postgresDatabase) withTx(fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ClearDatabase clears the database
+func (r *postgresDatabase) ClearDatabase() error {
+	_, err := r.db.Exec(`TRUNCATE presets, jobs, api_keys`)
+	return err
+}
+
+// StorePreset stores preset information
+func (r *postgresDatabase) StorePreset(preset types.Preset) (types.Preset, error) {
+	data, err := json.Marshal(preset)
+	if err != nil {
+		return types.Preset{}, err
+	}
+
+	//prevent replacing existing preset
+	res, err := r.db.Exec(`INSERT INTO presets (owner, name, data) VALUES ($1, $2, $3)
+		ON CONFLICT (owner, name) DO NOTHING`, preset.Owner, preset.Name, data)
+	if err != nil {
+		return types.Preset{}, err
+	}
+	if inserted, err := res.RowsAffected(); err != nil {
+		return types.Preset{}, err
+	} else if inserted == 0 {
+		return types.Preset{}, errors.New("Error 409: Preset already exists, please update instead.")
+	}
+	return preset, nil
+}
+
+// RetrievePreset retrieves one preset of the owner, or the system
+// preset with that name, from the database
+func (r *postgresDatabase) RetrievePreset(owner string, presetName string) (types.Preset, error) {
+	var data []byte
+	err := r.db.QueryRow(`SELECT data FROM presets WHERE name = $1 AND owner IN ($2, $3)
+		ORDER BY owner = $3 LIMIT 1`, presetName, owner, types.SystemOwner).Scan(&data)
+	if err == sql.ErrNoRows {
+		return types.Preset{}, errors.New("preset not found")
+	} else if err != nil {
+		return types.Preset{}, err
+	}
+
+	result := types.Preset{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return types.Preset{}, err
+	}
+	return result, nil
+}
+
+// UpdatePreset updates a preset
+func (r *postgresDatabase) UpdatePreset(owner string, presetName string, newPreset types.Preset) (types.Preset, error) {
+	newPreset.Owner = owner
+	newPreset.Version++
+	data, err := json.Marshal(newPreset)
+	if err != nil {
+		return types.Preset{}, err
+	}
+
+	res, err := r.db.Exec(`INSERT INTO presets (owner, name, data) VALUES ($1, $2, $3)
+		ON CONFLICT (owner, name) DO UPDATE SET data = EXCLUDED.data, updated_at = now()
+		WHERE COALESCE((presets.data->>'version')::bigint, 0) = $4`,
+		owner, presetName, data, newPreset.Version-1)
+	if err != nil {
+		return types.Preset{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return types.Preset{}, err
+	} else if n == 0 {
+		return types.Preset{}, ErrVersionConflict
+	}
+	return newPreset, nil
+}
+
+// GetPresets retrieves the presets of the owner and the
+// system presets from the database
+func (r *postgresDatabase) GetPresets(owner string) ([]types.Preset, error) {
+	rows, err := r.db.Query(`SELECT data FROM presets WHERE owner IN ($1, $2) ORDER BY created_at`, owner, types.SystemOwner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []types.Preset{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		preset := types.Preset{}
+		if err := json.Unmarshal(data, &preset); err != nil {
+			return nil, err
+		}
+		res = append(res, preset)
+	}
+	return res, rows.Err()
+}
+
+// DeletePreset deletes a preset from the database
+func (r *postgresDatabase) DeletePreset(owner string, presetName string) (types.Preset, error) {
+	var data []byte
+	err := r.db.QueryRow(`DELETE FROM presets WHERE owner = $1 AND name = $2 RETURNING data`, owner, presetName).Scan(&data)
+	if err == sql.ErrNoRows {
+		return types.Preset{}, errors.New("preset not found")
+	} else if err != nil {
+		return types.Preset{}, err
+	}
+
+	result := types.Preset{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return types.Preset{}, err
+	}
+	return result, nil
+}
+
+// DeleteJob deletes a job from the database
+func (r *postgresDatabase) DeleteJob(jobID string) (types.Job, error) {
+	var data []byte
+	err := r.db.QueryRow(`DELETE FROM jobs WHERE id = $1 RETURNING data`, jobID).Scan(&data)
+	if err == sql.ErrNoRows {
+		return types.Job{}, errors.New("job not found")
+	} else if err != nil {
+		return types.Job{}, err
+	}
+	return decodeJob(data)
+}
+
+// StoreJob stores job information
+func (r *postgresDatabase) StoreJob(job types.Job) (types.Job, error) {
+	if _, err := r.putJob(job.ID, job, ""); err != nil {
+		return types.Job{}, err
+	}
+	return job, nil
+}
+
+// RetrieveJob retrieves one job from the database
+func (r *postgresDatabase) RetrieveJob(jobID string) (types.Job, error) {
+	var data []byte
+	err := r.db.QueryRow(`SELECT data FROM jobs WHERE id = $1`, jobID).Scan(&data)
+	if err == sql.ErrNoRows {
+		return types.Job{}, errors.New("job not found")
+	} else if err != nil {
+		return types.Job{}, err
+	}
+	return decodeJob(data)
+}
+
+// UpdateJob updates a job
+func (r *postgresDatabase) UpdateJob(jobID string, newJob types.Job) (types.Job, error) {
+	version := newJob.Version
+	newJob.Version++
+	updated, err := r.putJob(jobID, newJob, `WHERE COALESCE((jobs.data->>'version')::bigint, 0) = $9`, version)
+	if err != nil {
+		return types.Job{}, err
+	}
+	if !updated {
+		return types.Job{}, ErrVersionConflict
+	}
+	return newJob, nil
+}
+
+// putJob inserts or replaces a job, telling if it did. An
+// existing job is only replaced if it matches the condition,
+// whose arguments start at $9.
+func (r *postgresDatabase) putJob(jobID string, job types.Job, condition string, args ...interface{}) (bool, error) {
+	data, err := encodeJob(job)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := r.db.Exec(`INSERT INTO jobs (id, status, preset_name, source, destination, data, created_at, owner)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (id) DO UPDATE SET
+			owner = EXCLUDED.owner,
+			status = EXCLUDED.status,
+			preset_name = EXCLUDED.preset_name,
+			source = EXCLUDED.source,
+			destination = EXCLUDED.destination,
+			data = EXCLUDED.data,
+			created_at = EXCLUDED.created_at,
+			updated_at = now()
+		`+condition,
+		append([]interface{}{jobID, string(job.Status), job.Preset.Name, job.Source, job.Destination, data, job.CreatedAt, job.Owner}, args...)...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// UpdateJobProgress updates only the progress of a job
+func (r *postgresDatabase) UpdateJobProgress(jobID string, progress types.Progress) error {
+	job := types.Job{}
+	job.SetProgress(progress)
+	data, err := json.Marshal(job.Progress)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.db.Exec(`UPDATE jobs SET
+			data = jsonb_set(jsonb_set(data, '{progressDetails}', $2::jsonb), '{progress}', to_jsonb($3::text)),
+			updated_at = now()
+		WHERE id = $1`,
+		jobID, string(data), job.ProgressText)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.New("job not found")
+	}
+	return nil
+}
+
+// GetJobs retrieves all jobs of the database
+func (r *postgresDatabase) GetJobs() ([]types.Job, error) {
+	rows, err := r.db.Query(`SELECT data FROM jobs ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []types.Job{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		job, err := decodeJob(data)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, job)
+	}
+	return res, rows.Err()
+}
+
+// CountJobsByStatus counts the jobs on each status
+func (r *postgresDatabase) CountJobsByStatus() (map[types.JobStatus]int, error) {
+	rows, err := r.db.Query(`SELECT status, count(*) FROM jobs GROUP BY status`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[types.JobStatus]int{}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[types.JobStatus(status)] = count
+	}
+	return counts, rows.Err()
+}
+
+// Ping tells if the database is reachable
+func (r *postgresDatabase) Ping() error {
+	return r.db.Ping()
+}
+
+// StoreAPIKey stores an API key
+func (r *postgresDatabase) StoreAPIKey(key types.APIKey) (types.APIKey, error) {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return types.APIKey{}, err
+	}
+
+	res, err := r.db.Exec(`INSERT INTO api_keys (id, data) VALUES ($1, $2)
+		ON CONFLICT (id) DO NOTHING`, key.ID, data)
+	if err != nil {
+		return types.APIKey{}, err
+	}
+	if inserted, err := res.RowsAffected(); err != nil {
+		return types.APIKey{}, err
+	} else if inserted == 0 {
+		return types.APIKey{}, errors.New("api key already exists")
+	}
+	return key, nil
+}
+
+// RetrieveAPIKey retrieves one API key from the database
+func (r *postgresDatabase) RetrieveAPIKey(keyID string) (types.APIKey, error) {
+	var data []byte
+	err := r.db.QueryRow(`SELECT data FROM api_keys WHERE id = $1`, keyID).Scan(&data)
+	if err == sql.ErrNoRows {
+		return types.APIKey{}, errors.New("api key not found")
+	} else if err != nil {
+		return types.APIKey{}, err
+	}
+
+	result := types.APIKey{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return types.APIKey{}, err
+	}
+	return result, nil
+}
+
+// GetAPIKeys retrieves all API keys of the database
+func (r *postgresDatabase) GetAPIKeys() ([]types.APIKey, error) {
+	rows, err := r.db.Query(`SELECT data FROM api_keys ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []types.APIKey{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		key := types.APIKey{}
+		if err := json.Unmarshal(data, &key); err != nil {
+			return nil, err
+		}
+		res = append(res, key)
+	}
+	return res, rows.Err()
+}
+
+// DeleteAPIKey deletes an API key from the database
+func (r *postgresDatabase) DeleteAPIKey(keyID string) (types.APIKey, error) {
+	var data []byte
+	err := r.db.QueryRow(`DELETE FROM api_keys WHERE id = $1 RETURNING data`, keyID).Scan(&data)
+	if err == sql.ErrNoRows {
+		return types.APIKey{}, errors.New("api key not found")
+	} else if err != nil {
+		return types.APIKey{}, err
+	}
+
+	result := types.APIKey{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return types.APIKey{}, err
+	}
+	return result, nil
+}
+
+// QueryJobs retrieves a page of jobs
+func (r *postgresDatabase) QueryJobs(query types.JobQuery) (types.JobPage, error) {
+	query, cursor, err := normalizeJobQuery(query)
+	if err != nil {
+		return types.JobPage{}, err
+	}
+
+	conditions := []string{}
+	args := []interface{}{}
+	where := func(condition string, values ...interface{}) {
+		for _, value := range values {
+			args = append(args, value)
+			condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(args)), 1)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	if query.Owner != types.AnyOwner {
+		where("owner = ?", query.Owner)
+	}
+	if query.Status != "" {
+		where("status = ?", string(query.Status))
+	}
+	if query.PresetName != "" {
+		where("preset_name = ?", query.PresetName)
+	}
+	if !query.CreatedAfter.IsZero() {
+		where("created_at > ?", query.CreatedAfter)
+	}
+	if !query.CreatedBefore.IsZero() {
+		where("created_at < ?", query.CreatedBefore)
+	}
+	if query.Source != "" {
+		where("strpos(source, ?) > 0", query.Source)
+	}
+	if query.Destination != "" {
+		where("strpos(destination, ?) > 0", query.Destination)
+	}
+
+	op, direction := ">", "ASC"
+	if query.Sort == types.SortByCreatedAtDesc || query.Sort == types.SortByIDDesc {
+		op, direction = "<", "DESC"
+	}
+
+	order := "id " + direction
+	if query.Sort == types.SortByCreatedAt || query.Sort == types.SortByCreatedAtDesc {
+		order = "created_at " + direction + ", id " + direction
+		if cursor != nil {
+			where("(created_at, id) "+op+" (?, ?)", cursor.CreatedAt, cursor.ID)
+		}
+	} else if cursor != nil {
+		where("id "+op+" ?", cursor.ID)
+	}
+
+	sqlQuery := "SELECT data FROM jobs"
+	if len(conditions) > 0 {
+		sqlQuery += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, query.Limit+1)
+	sqlQuery += fmt.Sprintf(" ORDER BY %s LIMIT $%d", order, len(args))
+
+	rows, err := r.db.Query(sqlQuery, args...)
+	if err != nil {
+		return types.JobPage{}, err
+	}
+	defer rows.Close()
+
+	res := []types.Job{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return types.JobPage{}, err
+		}
+		job, err := decodeJob(data)
+		if err != nil {
+			return types.JobPage{}, err
+		}
+		res = append(res, job)
+	}
+	if err := rows.Err(); err != nil {
+		return types.JobPage{}, err
+	}
+	return newJobPage(res, query.Limit), nil
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"sync"
+	"time"
+
+	"github.com/flavioribeiro/gonfig"
+	"github.com/snickers/snickers/types"
+)
+
+// How often a ProgressWriter writes the progress of a job,
+// whatever comes first. Set from PROGRESS_FLUSH_INTERVAL_MS and
+// PROGRESS_FLUSH_STEP by GetDatabase.
+var (
+	ProgressFlushInterval = time.Second
+	ProgressFlushStep     = float64(1)
+)
+
+func configureProgressFlush(config gonfig.Gonfig) error {
+	interval, err := config.GetInt("PROGRESS_FLUSH_INTERVAL_MS", 1000)
+	if err != nil {
+		return err
+	}
+	step, err := config.GetFloat("PROGRESS_FLUSH_STEP", float64(1))
+	if err != nil {
+		return err
+	}
+
+	ProgressFlushInterval = time.Duration(interval) * time.Millisecond
+	ProgressFlushStep = step
+	return nil
+}
+
+// ProgressWriter keeps the latest progress of a job in memory
+// and only writes it to the database once ProgressFlushInterval
+// went by or the stage moved ProgressFlushStep percent since the
+// last write. Stage changes and completions are written right away.
+type ProgressWriter struct {
+	db    Storage
+	jobID string
+
+	mtx       sync.Mutex
+	pending   *types.Progress
+	written   types.Progress
+	writtenAt time.Time
+}
+
+// NewProgressWriter returns a writer for the progress of a job
+func NewProgressWriter(dbInstance Storage, jobID string) *ProgressWriter {
+	return &ProgressWriter{db: dbInstance, jobID: jobID}
+}
+
+// Update records the progress of the job, writing it if it's due
+func (w *ProgressWriter) Update(progress types.Progress) error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	w.pending = &progress
+	if !w.due(progress) {
+		return nil
+	}
+	return w.flush()
+}
+
+// Flush writes the progress recorded since the last write, if any
+func (w *ProgressWriter) Flush() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if w.pending == nil {
+		return nil
+	}
+	return w.flush()
+}
+
+func (w *ProgressWriter) due(progress types.Progress) bool {
+	if w.writtenAt.IsZero() || progress.Stage != w.written.Stage || progress.StagePercent >= 100 {
+		return true
+	}
+	if time.Since(w.writtenAt) >= ProgressFlushInterval {
+		return true
+	}
+	step := progress.StagePercent - w.written.StagePercent
+	return step >= ProgressFlushStep || step <= -ProgressFlushStep
+}
+
+func (w *ProgressWriter) flush() error {
+	if err := w.db.UpdateJobProgress(w.jobID, *w.pending); err != nil {
+		return err
+	}
+	w.written = *w.pending
+	w.writtenAt = time.Now()
+	w.pending = nil
+	return nil
+}
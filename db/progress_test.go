@@ -0,0 +1,82 @@
+package db
+
+import (
+	"strings"
+	"time"
+
+	"github.com/flavioribeiro/gonfig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/snickers/snickers/types"
+)
+
+var _ = Describe("ProgressWriter", func() {
+	var (
+		dbInstance Storage
+		writer     *ProgressWriter
+	)
+
+	progressAt := func(stage types.JobStage, percent int64) types.Progress {
+		return types.NewProgress(stage, percent, 100, types.ProgressFrames, 0)
+	}
+
+	storedPercent := func() float64 {
+		job, _ := dbInstance.RetrieveJob("123")
+		return job.Progress.StagePercent
+	}
+
+	BeforeEach(func() {
+		cfg, _ := gonfig.FromJson(strings.NewReader(`{"DATABASE_DRIVER":"memory","PROGRESS_FLUSH_INTERVAL_MS":60000,"PROGRESS_FLUSH_STEP":10}`))
+		dbInstance, _ = GetDatabase(cfg)
+		dbInstance.ClearDatabase()
+		dbInstance.StoreJob(types.Job{ID: "123"})
+		writer = NewProgressWriter(dbInstance, "123")
+	})
+
+	AfterEach(func() {
+		ProgressFlushInterval = time.Second
+		ProgressFlushStep = 1
+	})
+
+	It("should read the thresholds from the config", func() {
+		Expect(ProgressFlushInterval).To(Equal(time.Minute))
+		Expect(ProgressFlushStep).To(Equal(float64(10)))
+	})
+
+	It("should only write once the progress moved by the step", func() {
+		Expect(writer.Update(progressAt(types.StageEncode, 1))).To(Succeed())
+		Expect(storedPercent()).To(Equal(float64(1)))
+
+		Expect(writer.Update(progressAt(types.StageEncode, 5))).To(Succeed())
+		Expect(storedPercent()).To(Equal(float64(1)))
+
+		Expect(writer.Update(progressAt(types.StageEncode, 11))).To(Succeed())
+		Expect(storedPercent()).To(Equal(float64(11)))
+	})
+
+	It("should write once the interval went by", func() {
+		ProgressFlushInterval = 10 * time.Millisecond
+		writer.Update(progressAt(types.StageEncode, 1))
+		time.Sleep(20 * time.Millisecond)
+
+		writer.Update(progressAt(types.StageEncode, 2))
+		Expect(storedPercent()).To(Equal(float64(2)))
+	})
+
+	It("should write stage changes and completions right away", func() {
+		writer.Update(progressAt(types.StageDownload, 95))
+		writer.Update(progressAt(types.StageDownload, 100))
+		Expect(storedPercent()).To(Equal(float64(100)))
+
+		writer.Update(progressAt(types.StageEncode, 0))
+		job, _ := dbInstance.RetrieveJob("123")
+		Expect(job.Progress.Stage).To(Equal(types.StageEncode))
+	})
+
+	It("should write the pending progress when flushed", func() {
+		writer.Update(progressAt(types.StageEncode, 1))
+		writer.Update(progressAt(types.StageEncode, 3))
+		Expect(writer.Flush()).To(Succeed())
+		Expect(storedPercent()).To(Equal(float64(3)))
+	})
+})
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/snickers/snickers/types"
+)
+
+// Limits applied to the page size of job queries
+const (
+	DefaultJobsLimit = 100
+	MaxJobsLimit     = 1000
+)
+
+// jobCursor is the position of the last job of a page. Pages
+// continue right after it on the query order.
+type jobCursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        string    `json:"i"`
+}
+
+func newJobCursor(job types.Job) string {
+	raw, _ := json.Marshal(jobCursor{CreatedAt: job.CreatedAt, ID: job.ID})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// normalizeJobQuery validates the query, filling in the default
+// sort and limit, and decodes its cursor if there is one
+func normalizeJobQuery(query types.JobQuery) (types.JobQuery, *jobCursor, error) {
+	switch query.Sort {
+	case "":
+		query.Sort = types.SortByCreatedAtDesc
+	case types.SortByCreatedAt, types.SortByCreatedAtDesc, types.SortByID, types.SortByIDDesc:
+	default:
+		return query, nil, fmt.Errorf("invalid sort %q", query.Sort)
+	}
+
+	if query.Limit < 0 {
+		return query, nil, errors.New("limit must not be negative")
+	} else if query.Limit == 0 {
+		query.Limit = DefaultJobsLimit
+	} else if query.Limit > MaxJobsLimit {
+		query.Limit = MaxJobsLimit
+	}
+
+	if query.Cursor == "" {
+		return query, nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+	if err != nil {
+		return query, nil, errors.New("invalid cursor")
+	}
+	cursor := &jobCursor{}
+	if err := json.Unmarshal(raw, cursor); err != nil {
+		return query, nil, errors.New("invalid cursor")
+	}
+	return query, cursor, nil
+}
+
+// matchesJobQuery tells if a job passes the query filters
+func matchesJobQuery(job types.Job, query types.JobQuery) bool {
+	if query.Owner != types.AnyOwner && job.Owner != query.Owner {
+		return false
+	}
+	if query.Status != "" && job.Status != query.Status {
+		return false
+	}
+	if query.PresetName != "" && job.Preset.Name != query.PresetName {
+		return false
+	}
+	if !query.CreatedAfter.IsZero() && !job.CreatedAt.After(query.CreatedAfter) {
+		return false
+	}
+	if !query.CreatedBefore.IsZero() && !job.CreatedAt.Before(query.CreatedBefore) {
+		return false
+	}
+	if query.Source != "" && !strings.Contains(job.Source, query.Source) {
+		return false
+	}
+	if query.Destination != "" && !strings.Contains(job.Destination, query.Destination) {
+		return false
+	}
+	return true
+}
+
+// visiblePreset tells if the presets of an owner include the preset
+func visiblePreset(preset types.Preset, owner string) bool {
+	return preset.Owner == owner || preset.Owner == types.SystemOwner
+}
+
+// jobLess tells if a comes before b on the given sort
+func jobLess(a types.Job, b types.Job, sort string) bool {
+	switch sort {
+	case types.SortByID:
+		return a.ID < b.ID
+	case types.SortByIDDesc:
+		return a.ID > b.ID
+	case types.SortByCreatedAt:
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	default:
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	}
+}
+
+// afterJobCursor tells if a job comes after the cursor on the
+// given sort, meaning it belongs to the following pages
+func afterJobCursor(job types.Job, cursor *jobCursor, sort string) bool {
+	if cursor == nil {
+		return true
+	}
+	return jobLess(types.Job{ID: cursor.ID, CreatedAt: cursor.CreatedAt}, job, sort)
+}
+
+// newJobPage builds a page from up to limit+1 jobs in query order,
+// the extra one only telling that there are more pages
+func newJobPage(jobs []types.Job, limit int) types.JobPage {
+	if len(jobs) <= limit {
+		return types.JobPage{Jobs: jobs}
+	}
+	jobs = jobs[:limit]
+	return types.JobPage{Jobs: jobs, NextCursor: newJobCursor(jobs[len(jobs)-1])}
+}
@@ -1,25 +1,82 @@
 package downloaders
 
 import (
+	"fmt"
+	"os"
 	"strings"
 
 	"code.cloudfoundry.org/lager"
 	"github.com/flavioribeiro/gonfig"
 	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/helpers"
 )
 
 // DownloadFunc is a function type for the multiple
 // possible ways to download the source file
 type DownloadFunc func(logger lager.Logger, config gonfig.Gonfig, dbInstance db.Storage, jobID string) error
 
+// SourceTooLargeError is returned when the source is bigger
+// than the MAX_SOURCE_SIZE setting
+type SourceTooLargeError struct {
+	Size  int64
+	Limit int64
+}
+
+func (e SourceTooLargeError) Error() string {
+	return fmt.Sprintf("source size of %d bytes exceeds the maximum of %d bytes", e.Size, e.Limit)
+}
+
 // GetDownloadFunc returns the download function
 // based on the job source.
 func GetDownloadFunc(jobSource string) DownloadFunc {
 	if strings.Contains(jobSource, "amazonaws") {
 		return S3Download
-	} else if strings.HasPrefix(jobSource, "ftp://") {
+	} else if strings.HasPrefix(jobSource, "ftp://") || strings.HasPrefix(jobSource, "ftps://") {
 		return FTPDownload
+	} else if strings.HasPrefix(jobSource, "file://") {
+		return FileDownload
 	}
 
 	return HTTPDownload
 }
+
+// VerifySourceChecksum checks the downloaded source against the
+// checksum informed on job creation. The local source is removed
+// on mismatch so a retry won't resume from a corrupted file.
+func VerifySourceChecksum(logger lager.Logger, dbInstance db.Storage, jobID string) error {
+	log := logger.Session("verify-source-checksum")
+	log.Info("start", lager.Data{"job": jobID})
+	defer log.Info("finished")
+
+	job, err := dbInstance.RetrieveJob(jobID)
+	if err != nil {
+		return err
+	}
+
+	if err := helpers.VerifyChecksum(job.LocalSource, job.SourceChecksum); err != nil {
+		log.Error("verifying-checksum-failed", err)
+		os.Remove(job.LocalSource)
+		return fmt.Errorf("source %s", err.Error())
+	}
+
+	return nil
+}
+
+// getMaxSourceSize returns the maximum source size in bytes
+// allowed by config. Zero means unlimited.
+func getMaxSourceSize(config gonfig.Gonfig) (int64, error) {
+	maxSize, err := config.GetInt("MAX_SOURCE_SIZE", 0)
+	if err != nil {
+		return 0, err
+	}
+	return int64(maxSize), nil
+}
+
+// checkSourceSize returns SourceTooLargeError if size is over
+// the limit. Unknown sizes and unlimited configs always pass.
+func checkSourceSize(size int64, limit int64) error {
+	if limit > 0 && size > limit {
+		return SourceTooLargeError{Size: size, Limit: limit}
+	}
+	return nil
+}
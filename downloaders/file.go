@@ -0,0 +1,62 @@
+package downloaders
+
+import (
+	"io"
+	"net/url"
+	"os"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/flavioribeiro/gonfig"
+	"github.com/snickers/snickers/db"
+)
+
+// FileDownload copies the source from the local filesystem, as
+// used by watch folders. Job Source should be in format:
+// file:///path/to/source
+func FileDownload(logger lager.Logger, config gonfig.Gonfig, dbInstance db.Storage, jobID string) error {
+	log := logger.Session("file-download")
+	log.Info("start", lager.Data{"job": jobID})
+	defer log.Info("finished")
+
+	job, err := dbInstance.RetrieveJob(jobID)
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(job.Source)
+	if err != nil {
+		return err
+	}
+
+	maxSize, err := getMaxSourceSize(config)
+	if err != nil {
+		return err
+	}
+
+	sourceFile, err := os.Open(u.Path)
+	if err != nil {
+		log.Error("opening-source-failed", err)
+		return err
+	}
+	defer sourceFile.Close()
+
+	info, err := sourceFile.Stat()
+	if err != nil {
+		return err
+	}
+	if err := checkSourceSize(info.Size(), maxSize); err != nil {
+		log.Error("source-too-large", err)
+		return err
+	}
+
+	outputFile, err := os.Create(job.LocalSource)
+	if err != nil {
+		log.Error("creating-local-source-failed", err)
+		return err
+	}
+	defer outputFile.Close()
+
+	_, err = io.Copy(outputFile, sourceFile)
+	return err
+}
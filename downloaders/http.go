@@ -1,17 +1,25 @@
 package downloaders
 
 import (
-	"strconv"
+	"time"
 
 	"code.cloudfoundry.org/lager"
 
 	"github.com/cavaliercoder/grab"
 	"github.com/flavioribeiro/gonfig"
 	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/events"
+	"github.com/snickers/snickers/types"
 )
 
+// retryDelay is how long the first retry of a download waits, the
+// next ones waiting longer each time
+var retryDelay = time.Second
+
 // HTTPDownload function downloads sources using
-// http protocol.
+// http protocol. Failed attempts are retried up to
+// DOWNLOAD_RETRIES times, resuming from the partial file
+// whenever the server supports range requests.
 func HTTPDownload(logger lager.Logger, config gonfig.Gonfig, dbInstance db.Storage, jobID string) error {
 	log := logger.Session("http-download")
 	log.Info("start", lager.Data{"job": jobID})
@@ -22,32 +30,88 @@ func HTTPDownload(logger lager.Logger, config gonfig.Gonfig, dbInstance db.Stora
 		return err
 	}
 
-	client := grab.NewClient()
-	req, err := grab.NewRequest(job.LocalSource, job.Source)
+	maxSize, err := getMaxSourceSize(config)
 	if err != nil {
-		return nil
+		return err
 	}
-	resp := client.Do(req)
-	if err := resp.Err(); err != nil {
-		return nil
+
+	retries, err := config.GetInt("DOWNLOAD_RETRIES", 3)
+	if err != nil {
+		return err
 	}
 
-	for !resp.IsComplete() {
-		job, err = dbInstance.RetrieveJob(jobID)
+	progress := db.NewProgressWriter(dbInstance, jobID)
+	client := grab.NewClient()
+	for attempt := 0; ; attempt++ {
+		req, err := grab.NewRequest(job.LocalSource, job.Source)
 		if err != nil {
+			log.Error("creating-request-failed", err)
+			return err
+		}
+
+		err = waitHTTPDownload(progress, &job, client.Do(req), maxSize)
+		if err == nil {
+			return progress.Flush()
+		}
+		if _, ok := err.(SourceTooLargeError); ok || attempt >= retries {
+			log.Error("download-failed", err, lager.Data{"attempt": attempt})
 			return err
 		}
 
-		percentage := strconv.FormatInt(int64(resp.BytesComplete()*100/resp.Size), 10)
-		if job.Progress != percentage {
-			job.Progress = percentage + "%"
-			dbInstance.UpdateJob(job.ID, job)
+		log.Info("retrying", lager.Data{"attempt": attempt, "error": err.Error()})
+		time.Sleep(time.Duration(attempt+1) * retryDelay)
+	}
+}
+
+// waitHTTPDownload follows a transfer until it is done, updating
+// the job progress and enforcing the maximum source size.
+func waitHTTPDownload(progress *db.ProgressWriter, job *types.Job, resp *grab.Response, maxSize int64) error {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := checkHTTPDownloadSize(resp, maxSize); err != nil {
+				resp.Cancel()
+				return err
+			}
+			if err := updateHTTPDownloadProgress(progress, job, resp); err != nil {
+				resp.Cancel()
+				return err
+			}
+		case <-resp.Done:
+			if err := resp.Err(); err != nil {
+				return err
+			}
+			if err := checkHTTPDownloadSize(resp, maxSize); err != nil {
+				return err
+			}
+			return updateHTTPDownloadProgress(progress, job, resp)
 		}
 	}
+}
+
+func checkHTTPDownloadSize(resp *grab.Response, maxSize int64) error {
+	if err := checkSourceSize(resp.Size, maxSize); err != nil {
+		return err
+	}
+	return checkSourceSize(resp.BytesComplete(), maxSize)
+}
 
-	if resp.Err() != nil {
-		return resp.Err()
+func updateHTTPDownloadProgress(progress *db.ProgressWriter, job *types.Job, resp *grab.Response) error {
+	// when the server doesn't tell the size the total stays
+	// unknown and only the bytes received are reported
+	total := resp.Size
+	if total < 0 {
+		total = 0
 	}
 
-	return nil
+	current := types.NewProgress(types.StageDownload, resp.BytesComplete(), total, types.ProgressBytes, resp.BytesPerSecond())
+	if job.Progress == current {
+		return nil
+	}
+	job.SetProgress(current)
+	events.PublishJob(events.JobProgressChanged, *job)
+	return progress.Update(current)
 }
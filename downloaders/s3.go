@@ -26,27 +26,45 @@ func S3Download(logger lager.Logger, config gonfig.Gonfig, dbInstance db.Storage
 		return err
 	}
 
-	file, err := os.Create(job.LocalDestination)
+	err = helpers.SetAWSCredentials(job.Source)
 	if err != nil {
 		return err
 	}
 
-	err = helpers.SetAWSCredentials(job.Source)
+	bucket, err := helpers.GetAWSBucket(job.Source)
 	if err != nil {
 		return err
 	}
 
-	bucket, err := helpers.GetAWSBucket(job.Source)
+	key, err := helpers.GetAWSKey(job.Source)
 	if err != nil {
 		return err
 	}
 
-	key, err := helpers.GetAWSKey(job.Source)
+	maxSize, err := getMaxSourceSize(config)
+	if err != nil {
+		return err
+	}
+
+	sess := session.New(&aws.Config{Region: aws.String("us-east-1")})
+	if maxSize > 0 {
+		head, err := s3.New(sess).HeadObject(&s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		if err != nil {
+			return err
+		}
+		if err := checkSourceSize(aws.Int64Value(head.ContentLength), maxSize); err != nil {
+			log.Error("source-too-large", err)
+			return err
+		}
+	}
+
+	file, err := os.Create(job.LocalSource)
 	if err != nil {
 		return err
 	}
+	defer file.Close()
 
-	downloader := s3manager.NewDownloader(session.New(&aws.Config{Region: aws.String("us-east-1")}))
+	downloader := s3manager.NewDownloader(sess)
 	objInput := s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
 
 	_, err = downloader.Download(file, &objInput)
@@ -0,0 +1,508 @@
+package encoders
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/3d0c/gmf"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/events"
+	"github.com/snickers/snickers/metrics"
+	"github.com/snickers/snickers/types"
+)
+
+// keyFramePacketFlag is AV_PKT_FLAG_KEY, which flags the packets
+// holding a keyframe
+const keyFramePacketFlag = 1
+
+// minChunkFrames keeps the chunks long enough to be worth the split
+var minChunkFrames = 250
+
+// chunk is a part of the source video, from the packet of a keyframe
+// up to the packet before End, counted in decoding order. The last
+// chunk goes to the end of the video.
+type chunk struct {
+	Start int
+	End   int
+}
+
+// ChunkedEncode encodes long videos faster by splitting them at
+// keyframes into the chunks of the preset and encoding these in
+// parallel. The encoded chunks are then joined without encoding
+// them again, while the audio is encoded at once from the source,
+// so the output lasts exactly as long as when encoded in one pass.
+// Only videos with a constant frame rate are split, as the chunks
+// are joined one frame duration after the other. Variable frame
+// rate videos and videos too short to be split are encoded by
+// FFMPEGEncode.
+func ChunkedEncode(logger lager.Logger, dbInstance db.Storage, jobID string) error {
+	log := logger.Session("chunked-encode")
+	log.Info("started", lager.Data{"job": jobID})
+	defer log.Info("finished")
+
+	gmf.LogSetLevel(gmf.AV_LOG_FATAL)
+	job, err := dbInstance.RetrieveJob(jobID)
+	if err != nil {
+		return err
+	}
+
+	keyframes, totalFrames, rate, err := findKeyframes(job.LocalSource)
+	if err != nil {
+		log.Error("finding-keyframes-failed", err)
+		return err
+	}
+	if rate.variable {
+		log.Info("encoding-variable-frame-rate-at-once")
+		return FFMPEGEncode(logger, dbInstance, jobID)
+	}
+	chunks := planChunks(keyframes, totalFrames, job.Preset.Video.Chunks)
+	if len(chunks) < 2 {
+		log.Info("encoding-at-once")
+		return FFMPEGEncode(logger, dbInstance, jobID)
+	}
+
+	job, err = db.ModifyJob(dbInstance, jobID, func(job *types.Job) error {
+		job.Status = types.JobEncoding
+		job.SetProgress(types.NewProgress(types.StageEncode, 0, 0, types.ProgressFrames, 0))
+		return nil
+	})
+	if err != nil {
+		log.Error("updating-job-failed", err)
+		return err
+	}
+	events.PublishJob(events.JobStatusChanged, job)
+
+	chunkDir, err := ioutil.TempDir(path.Dir(job.LocalDestination), "chunks-")
+	if err != nil {
+		log.Error("creating-chunk-directory-failed", err)
+		return err
+	}
+	defer os.RemoveAll(chunkDir)
+
+	progress := newChunkProgress(dbInstance, job, totalFrames)
+	chunkPaths := make([]string, len(chunks))
+	errs := make(chan error, len(chunks))
+	var wg sync.WaitGroup
+	for i, c := range chunks {
+		chunkPaths[i] = path.Join(chunkDir, fmt.Sprintf("%03d%s", i, path.Ext(job.LocalDestination)))
+		wg.Add(1)
+		go func(c chunk, last bool, chunkPath string) {
+			defer wg.Done()
+			errs <- encodeChunk(job, c, last, chunkPath, progress)
+		}(c, i == len(chunks)-1, chunkPaths[i])
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			log.Error("encoding-chunk-failed", err)
+			return err
+		}
+	}
+
+	log.Info("joining-chunks", lager.Data{"chunks": len(chunks)})
+	if err := joinChunks(job, chunkPaths, progress); err != nil {
+		log.Error("joining-chunks-failed", err)
+		return err
+	}
+	return progress.finish()
+}
+
+// findKeyframes lists the packets of the source video holding a
+// keyframe, in decoding order, along with how many packets it has
+// and whether they all last the same
+func findKeyframes(source string) ([]int, int, frameRate, error) {
+	var rate frameRate
+	inputCtx, err := gmf.NewInputCtx(source)
+	if err != nil {
+		return nil, 0, rate, err
+	}
+	defer inputCtx.CloseInputAndRelease()
+
+	videoStream, err := inputCtx.GetBestStream(gmf.AVMEDIA_TYPE_VIDEO)
+	if err != nil {
+		return nil, 0, rate, err
+	}
+
+	keyframes := []int{}
+	frames := 0
+	for packet := range inputCtx.GetNewPackets() {
+		if packet.StreamIndex() == videoStream.Index() {
+			if packet.Flags()&keyFramePacketFlag != 0 {
+				keyframes = append(keyframes, frames)
+			}
+			rate.add(int64(packet.Duration()))
+			frames++
+		}
+		gmf.Release(packet)
+	}
+	return keyframes, frames, rate, nil
+}
+
+// frameRate tells if the packets of a video all last the same,
+// leaving out those without a duration
+type frameRate struct {
+	duration int64
+	variable bool
+}
+
+func (r *frameRate) add(duration int64) {
+	if duration <= 0 {
+		return
+	}
+	if r.duration == 0 {
+		r.duration = duration
+	} else if duration != r.duration {
+		r.variable = true
+	}
+}
+
+// planChunks splits the video in up to n chunks of about the same
+// length, each one starting at a keyframe and lasting at least
+// minChunkFrames
+func planChunks(keyframes []int, totalFrames int, n int) []chunk {
+	if n > totalFrames/minChunkFrames {
+		n = totalFrames / minChunkFrames
+	}
+
+	chunks := []chunk{{Start: 0}}
+	k := 0
+	for i := 1; i < n; i++ {
+		target := totalFrames * i / n
+		for k < len(keyframes) && keyframes[k] < target {
+			k++
+		}
+		if k == len(keyframes) || totalFrames-keyframes[k] < minChunkFrames {
+			break
+		}
+		last := &chunks[len(chunks)-1]
+		if keyframes[k]-last.Start < minChunkFrames {
+			continue
+		}
+		last.End = keyframes[k]
+		chunks = append(chunks, chunk{Start: keyframes[k]})
+	}
+	chunks[len(chunks)-1].End = totalFrames
+	return chunks
+}
+
+// encodeChunk encodes the video frames of a chunk. The source is
+// decoded from its beginning, which is cheap next to encoding, so
+// the chunk starts exactly at its keyframe whatever the container.
+// The decoder gives frames in presentation order and holds some back,
+// so each frame goes to the chunk of the packet that let it out,
+// which splits them the same way on every chunk. The last chunk
+// takes the frames left in the decoder.
+func encodeChunk(job types.Job, c chunk, last bool, chunkPath string, progress *chunkProgress) error {
+	inputCtx, err := gmf.NewInputCtx(job.LocalSource)
+	if err != nil {
+		return err
+	}
+	defer inputCtx.CloseInputAndRelease()
+
+	outputCtx, err := gmf.NewOutputCtx(chunkPath)
+	if err != nil {
+		return err
+	}
+	defer outputCtx.CloseOutputAndRelease()
+
+	inputStream, err := inputCtx.GetBestStream(gmf.AVMEDIA_TYPE_VIDEO)
+	if err != nil {
+		return err
+	}
+	_, outputIndex, err := addStream(job, getVideoCodec(job), outputCtx, inputStream)
+	if err != nil {
+		return err
+	}
+	outputStream, err := getStream(outputCtx, outputIndex)
+	if err != nil {
+		return err
+	}
+	if err := outputCtx.WriteHeader(); err != nil {
+		return err
+	}
+
+	var lastDelta int64
+	encode := func(packet *gmf.Packet, frame *gmf.Frame) error {
+		if err := processFrame(inputStream, outputStream, packet, frame, outputCtx, &lastDelta); err != nil {
+			return err
+		}
+		outputStream.Pts++
+		progress.add(1)
+		return nil
+	}
+
+	packetIndex := 0
+	for packet := range inputCtx.GetNewPackets() {
+		if packet.StreamIndex() != inputStream.Index() || packetIndex >= c.End {
+			gmf.Release(packet)
+			continue
+		}
+		for frame := range packet.Frames(inputStream.CodecCtx()) {
+			if packetIndex >= c.Start {
+				if err := encode(packet, frame); err != nil {
+					return err
+				}
+			}
+		}
+		packetIndex++
+		gmf.Release(packet)
+	}
+	if last {
+		if err := drainDecoder(inputStream, encode); err != nil {
+			return err
+		}
+	}
+
+	return flushStream(outputCtx, outputStream)
+}
+
+// joinChunks writes the encoded chunks one after the other on the
+// job destination, shifting their timestamps so each one starts
+// where the one before it ends, and encodes the source audio in
+// between. The chunks are copied as they are, so the video stream
+// takes the codec parameters and extradata they were encoded with.
+func joinChunks(job types.Job, chunkPaths []string, progress *chunkProgress) error {
+	inputCtx, err := gmf.NewInputCtx(job.LocalSource)
+	if err != nil {
+		return err
+	}
+	defer inputCtx.CloseInputAndRelease()
+
+	firstCtx, err := gmf.NewInputCtx(chunkPaths[0])
+	if err != nil {
+		return err
+	}
+	defer firstCtx.CloseInputAndRelease()
+	firstStream, err := firstCtx.GetBestStream(gmf.AVMEDIA_TYPE_VIDEO)
+	if err != nil {
+		return err
+	}
+
+	outputCtx, err := gmf.NewOutputCtx(job.LocalDestination)
+	if err != nil {
+		return err
+	}
+	defer outputCtx.CloseOutputAndRelease()
+
+	videoStream, err := outputCtx.AddStreamWithCodeCtx(firstStream.CodecCtx())
+	if err != nil {
+		return err
+	}
+	srcAudioStream, err := inputCtx.GetBestStream(gmf.AVMEDIA_TYPE_AUDIO)
+	if err != nil {
+		return errors.New("unable to get the best audio stream inside the input context")
+	}
+	_, audioIndex, err := addStream(job, getAudioCodec(job), outputCtx, srcAudioStream)
+	if err != nil {
+		return err
+	}
+	if err := outputCtx.WriteHeader(); err != nil {
+		return err
+	}
+	// the muxer may change the time bases when writing the header
+	if videoStream, err = getStream(outputCtx, videoStream.Index()); err != nil {
+		return err
+	}
+	audioStream, err := getStream(outputCtx, audioIndex)
+	if err != nil {
+		return err
+	}
+
+	audio := &audioEncoder{
+		packets:      inputCtx.GetNewPackets(),
+		inputStream:  srcAudioStream,
+		outputStream: audioStream,
+		outputCtx:    outputCtx,
+		progress:     progress,
+	}
+
+	// the first chunk keeps its timestamps, the next ones start
+	// where the one before them ends
+	end := int64(gmf.AV_NOPTS_VALUE)
+	for _, chunkPath := range chunkPaths {
+		if end, err = copyChunk(chunkPath, outputCtx, videoStream, end, audio); err != nil {
+			return err
+		}
+	}
+
+	if err := audio.encodeUntil(-1); err != nil {
+		return err
+	}
+	return flushStream(outputCtx, audioStream)
+}
+
+// copyChunk writes the packets of an encoded chunk on the output
+// video stream, shifted to start at the given time, or where they
+// are when it's AV_NOPTS_VALUE. It returns when the chunk ends,
+// which is its last presentation time plus the duration of that
+// frame, in the time base of the output stream.
+func copyChunk(chunkPath string, outputCtx *gmf.FmtCtx, videoStream *gmf.Stream, start int64, audio *audioEncoder) (int64, error) {
+	chunkCtx, err := gmf.NewInputCtx(chunkPath)
+	if err != nil {
+		return 0, err
+	}
+	defer chunkCtx.CloseInputAndRelease()
+
+	chunkStream, err := chunkCtx.GetBestStream(gmf.AVMEDIA_TYPE_VIDEO)
+	if err != nil {
+		return 0, err
+	}
+	rescale := func(ts int64) int64 {
+		return gmf.RescaleQ(ts, chunkStream.TimeBase(), videoStream.TimeBase())
+	}
+	// frames without a duration last one tick of the encoder
+	frameDuration := gmf.RescaleQ(1, chunkStream.CodecCtx().TimeBase(), videoStream.TimeBase())
+
+	var shift int64
+	shifted := false
+	end := start
+	for packet := range chunkCtx.GetNewPackets() {
+		// the keyframe starting the chunk is shown first
+		if !shifted && packet.Pts() != gmf.AV_NOPTS_VALUE {
+			if start != gmf.AV_NOPTS_VALUE {
+				shift = start - rescale(packet.Pts())
+			}
+			shifted = true
+		}
+
+		if packet.Pts() != gmf.AV_NOPTS_VALUE {
+			pts := rescale(packet.Pts()) + shift
+			packet.SetPts(pts)
+
+			duration := rescale(int64(packet.Duration()))
+			if duration <= 0 {
+				duration = frameDuration
+			}
+			if end == gmf.AV_NOPTS_VALUE || pts+duration > end {
+				end = pts + duration
+			}
+			if err := audio.encodeUntil(toMilliseconds(pts, videoStream.TimeBase())); err != nil {
+				return 0, err
+			}
+		}
+		if packet.Dts() != gmf.AV_NOPTS_VALUE {
+			packet.SetDts(rescale(packet.Dts()) + shift)
+		}
+		packet.SetStreamIndex(videoStream.Index())
+		if err := outputCtx.WritePacket(packet); err != nil {
+			return 0, err
+		}
+		gmf.Release(packet)
+	}
+	return end, nil
+}
+
+// audioEncoder encodes the source audio as the joined video goes,
+// so both streams are written interleaved
+type audioEncoder struct {
+	packets      chan *gmf.Packet
+	inputStream  *gmf.Stream
+	outputStream *gmf.Stream
+	outputCtx    *gmf.FmtCtx
+	progress     *chunkProgress
+	lastDelta    int64
+	done         bool
+}
+
+// encodeUntil encodes the audio up to the given time in
+// milliseconds, or all of it when negative
+func (a *audioEncoder) encodeUntil(until int64) error {
+	for !a.done {
+		packet, ok := <-a.packets
+		if !ok {
+			a.done = true
+			return nil
+		}
+		if packet.StreamIndex() != a.inputStream.Index() {
+			gmf.Release(packet)
+			continue
+		}
+
+		for frame := range packet.Frames(a.inputStream.CodecCtx()) {
+			if err := processFrame(a.inputStream, a.outputStream, packet, frame, a.outputCtx, &a.lastDelta); err != nil {
+				return err
+			}
+			a.outputStream.Pts++
+			a.progress.add(1)
+		}
+		reached := until >= 0 && toMilliseconds(packet.Pts(), a.inputStream.TimeBase()) >= until
+		gmf.Release(packet)
+		if reached {
+			return nil
+		}
+	}
+	return nil
+}
+
+func toMilliseconds(ts int64, timeBase gmf.AVRational) int64 {
+	return gmf.RescaleQ(ts, timeBase, gmf.AVR{Num: 1, Den: 1000}.AVRational())
+}
+
+// chunkProgress adds up the frames encoded by every chunk and the
+// audio into the progress of the job
+type chunkProgress struct {
+	mtx     sync.Mutex
+	writer  *db.ProgressWriter
+	job     types.Job
+	total   int64
+	done    int64
+	started time.Time
+}
+
+func newChunkProgress(dbInstance db.Storage, job types.Job, videoFrames int) *chunkProgress {
+	total := int64(videoFrames)
+	if inputCtx, err := gmf.NewInputCtx(job.LocalSource); err == nil {
+		if audioStream, err := inputCtx.GetBestStream(gmf.AVMEDIA_TYPE_AUDIO); err == nil {
+			total += int64(audioStream.NbFrames())
+		}
+		inputCtx.CloseInputAndRelease()
+	}
+	return &chunkProgress{
+		writer:  db.NewProgressWriter(dbInstance, job.ID),
+		job:     job,
+		total:   total,
+		started: time.Now(),
+	}
+}
+
+func (p *chunkProgress) add(frames int64) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.done += frames
+	speed := float64(p.done) / time.Since(p.started).Seconds()
+	progress := types.NewProgress(types.StageEncode, p.done, p.total, types.ProgressFrames, speed)
+	if fmt.Sprintf("%.2f", progress.StagePercent) != fmt.Sprintf("%.2f", p.job.Progress.StagePercent) {
+		p.job.SetProgress(progress)
+		p.writer.Update(progress)
+		events.PublishJob(events.JobProgressChanged, p.job)
+	}
+}
+
+// finish records the encoding speed and completes the progress
+func (p *chunkProgress) finish() error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if elapsed := time.Since(p.started).Seconds(); p.done > 0 && elapsed > 0 {
+		metrics.EncodeFPS.Observe(float64(p.done) / elapsed)
+	}
+	if err := p.writer.Flush(); err != nil {
+		return err
+	}
+	if p.job.Progress.StagePercent != 100 {
+		p.job.SetProgress(types.CompletedProgress(types.StageEncode))
+		p.writer.Update(p.job.Progress)
+		events.PublishJob(events.JobProgressChanged, p.job)
+		return p.writer.Flush()
+	}
+	return nil
+}
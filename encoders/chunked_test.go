@@ -0,0 +1,139 @@
+package encoders
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/dchest/uniuri"
+	"github.com/flavioribeiro/gonfig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/types"
+)
+
+var _ = Describe("Chunked encoding", func() {
+	everyHundredFrames := func(total int) []int {
+		keyframes := []int{}
+		for frame := 0; frame < total; frame += 100 {
+			keyframes = append(keyframes, frame)
+		}
+		return keyframes
+	}
+
+	Context("planChunks", func() {
+		It("should split the video at the keyframes closest to even parts", func() {
+			chunks := planChunks(everyHundredFrames(3000), 3000, 4)
+			Expect(chunks).To(Equal([]chunk{{0, 800}, {800, 1500}, {1500, 2300}, {2300, 3000}}))
+		})
+
+		It("should cover every frame once", func() {
+			chunks := planChunks(everyHundredFrames(10000), 9950, 7)
+			Expect(chunks[0].Start).To(Equal(0))
+			for i := 1; i < len(chunks); i++ {
+				Expect(chunks[i].Start).To(Equal(chunks[i-1].End))
+			}
+			Expect(chunks[len(chunks)-1].End).To(Equal(9950))
+		})
+
+		It("should keep the chunks long enough", func() {
+			chunks := planChunks(everyHundredFrames(600), 600, 8)
+			Expect(chunks).To(Equal([]chunk{{0, 300}, {300, 600}}))
+		})
+
+		It("should not split videos without keyframes to split at", func() {
+			Expect(planChunks([]int{0}, 3000, 4)).To(Equal([]chunk{{0, 3000}}))
+			Expect(planChunks(everyHundredFrames(200), 200, 4)).To(Equal([]chunk{{0, 200}}))
+		})
+	})
+
+	Context("frameRate", func() {
+		durations := func(values ...int64) frameRate {
+			var rate frameRate
+			for _, duration := range values {
+				rate.add(duration)
+			}
+			return rate
+		}
+
+		It("should take videos whose frames all last the same as constant", func() {
+			Expect(durations(512, 512, 512).variable).To(BeFalse())
+		})
+
+		It("should leave out the frames without a duration", func() {
+			Expect(durations(0, 512, 0, 512).variable).To(BeFalse())
+		})
+
+		It("should find videos whose frames last differently", func() {
+			Expect(durations(512, 512, 1024, 512).variable).To(BeTrue())
+		})
+	})
+
+	Context("when encoding a video in chunks", func() {
+		var dbInstance db.Storage
+
+		BeforeEach(func() {
+			currentDir, _ := os.Getwd()
+			cfg, _ := gonfig.FromJsonFile(currentDir + "/../fixtures/config.json")
+			dbInstance, _ = db.GetDatabase(cfg)
+			dbInstance.ClearDatabase()
+			// nyt.mp4 has 122 frames with a keyframe on the 91st
+			minChunkFrames = 30
+		})
+
+		AfterEach(func() {
+			minChunkFrames = 250
+		})
+
+		encode := func(id string, chunks int) string {
+			currentDir, _ := os.Getwd()
+			destinationFile := "/tmp/" + uniuri.New() + ".mp4"
+			dbInstance.StoreJob(types.Job{
+				ID: id,
+				Preset: types.Preset{
+					Container: "mp4",
+					Video: types.VideoPreset{
+						Height:  "240",
+						Width:   "426",
+						Codec:   "h264",
+						Bitrate: "400000",
+						Profile: "main",
+						Chunks:  chunks,
+					},
+					Audio: types.AudioPreset{
+						Codec:   "aac",
+						Bitrate: "64000",
+					},
+				},
+				Status:           types.JobCreated,
+				LocalSource:      currentDir + "/../fixtures/videos/nyt.mp4",
+				LocalDestination: destinationFile,
+			})
+			return destinationFile
+		}
+
+		mediainfo := func(inform string, file string) string {
+			out, _ := exec.Command("mediainfo", "--Inform="+inform, file).Output()
+			return strings.TrimSpace(string(out))
+		}
+
+		It("should last as long as when encoded at once", func() {
+			logger := lagertest.NewTestLogger("chunked-encoder")
+			atOnce := encode("at-once", 0)
+			defer os.Remove(atOnce)
+			Expect(FFMPEGEncode(logger, dbInstance, "at-once")).To(Succeed())
+
+			chunked := encode("chunked", 2)
+			defer os.Remove(chunked)
+			Expect(ChunkedEncode(logger, dbInstance, "chunked")).To(Succeed())
+
+			for _, inform := range []string{"Video;%FrameCount%;", "Video;%Duration%;", "Audio;%Duration%;"} {
+				expected := mediainfo(inform, atOnce)
+				Expect(expected).NotTo(BeEmpty())
+				Expect(mediainfo(inform, chunked)).To(Equal(expected), inform)
+			}
+		})
+	})
+})
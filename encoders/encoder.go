@@ -2,6 +2,7 @@ package encoders
 
 import (
 	"code.cloudfoundry.org/lager"
+	"github.com/3d0c/gmf"
 	"github.com/snickers/snickers/db"
 	"github.com/snickers/snickers/types"
 )
@@ -16,5 +17,23 @@ func GetEncodeFunc(job types.Job) EncodeFunc {
 	if job.Preset.Container == "m3u8" {
 		return HLSEncode
 	}
+	if job.Preset.Video.Chunks > 1 {
+		return ChunkedEncode
+	}
 	return FFMPEGEncode
 }
+
+// defaultEncoders are the encoders used by presets that don't
+// name their codecs
+var defaultEncoders = []string{"libx264", "aac"}
+
+// CheckEncoders tells if the encoding libraries Snickers was
+// built against provide the default encoders
+func CheckEncoders() error {
+	for _, name := range defaultEncoders {
+		if _, err := gmf.FindEncoder(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -36,5 +36,16 @@ var _ = Describe("Encoders", func() {
 			funcName := runtime.FuncForPC(reflect.ValueOf(encodeFunc).Pointer()).Name()
 			Expect(funcName).To(Equal("github.com/snickers/snickers/encoders.FFMPEGEncode"))
 		})
+
+		It("should return ChunkedEncode if the preset has chunks", func() {
+			job := types.Job{
+				ID:     "123",
+				Preset: types.Preset{Name: "240p", Container: "mp4", Video: types.VideoPreset{Chunks: 4}},
+				Status: types.JobCreated,
+			}
+			encodeFunc := GetEncodeFunc(job)
+			funcName := runtime.FuncForPC(reflect.ValueOf(encodeFunc).Pointer()).Name()
+			Expect(funcName).To(Equal("github.com/snickers/snickers/encoders.ChunkedEncode"))
+		})
 	})
 })
@@ -4,11 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
 	"code.cloudfoundry.org/lager"
 
 	"github.com/3d0c/gmf"
 	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/events"
+	"github.com/snickers/snickers/metrics"
 	"github.com/snickers/snickers/types"
 )
 
@@ -37,9 +40,16 @@ func FFMPEGEncode(logger lager.Logger, dbInstance db.Storage, jobID string) erro
 	}
 	defer outputCtx.CloseOutputAndRelease()
 
-	job.Status = types.JobEncoding
-	job.Progress = "0%"
-	dbInstance.UpdateJob(job.ID, job)
+	job, err = db.ModifyJob(dbInstance, jobID, func(job *types.Job) error {
+		job.Status = types.JobEncoding
+		job.SetProgress(types.NewProgress(types.StageEncode, 0, 0, types.ProgressFrames, 0))
+		return nil
+	})
+	if err != nil {
+		log.Error("updating-job-failed", err)
+		return err
+	}
+	events.PublishJob(events.JobStatusChanged, job)
 
 	//get audio and video stream and the streaMap
 	streamMap, srcVideoStream, srcAudioStream, err := getAudioVideoStreamSource(inputCtx, outputCtx, job)
@@ -59,9 +69,10 @@ func FFMPEGEncode(logger lager.Logger, dbInstance db.Storage, jobID string) erro
 		return err
 	}
 
-	if job.Progress != "100%" {
-		job.Progress = "100%"
-		dbInstance.UpdateJob(job.ID, job)
+	if job.Progress.StagePercent != 100 {
+		job.SetProgress(types.CompletedProgress(types.StageEncode))
+		dbInstance.UpdateJobProgress(job.ID, job.Progress)
+		events.PublishJob(events.JobProgressChanged, job)
 	}
 
 	return nil
@@ -78,30 +89,55 @@ func processNewFrames(inputCtx *gmf.FmtCtx, outputCtx *gmf.FmtCtx, streamMap map
 			return err
 		}
 
-		frame := gmf.NewFrame()
-
-		for {
-			if p, ready, _ := frame.FlushNewPacket(outputStream.CodecCtx()); ready {
-				configurePacket(p, outputStream, frame)
-				if err := outputCtx.WritePacket(p); err != nil {
-					return err
-				}
-				gmf.Release(p)
-			} else {
-				break
-			}
-			outputStream.Pts++
+		if err := flushStream(outputCtx, outputStream); err != nil {
+			return err
 		}
-
-		gmf.Release(frame)
 	}
 
 	return nil
 }
 
+// flushStream writes the packets the encoder of the stream still holds
+func flushStream(outputCtx *gmf.FmtCtx, outputStream *gmf.Stream) error {
+	frame := gmf.NewFrame()
+	defer gmf.Release(frame)
+
+	for {
+		p, ready, _ := frame.FlushNewPacket(outputStream.CodecCtx())
+		if !ready {
+			return nil
+		}
+		configurePacket(p, outputStream, frame)
+		if err := outputCtx.WritePacket(p); err != nil {
+			return err
+		}
+		gmf.Release(p)
+		outputStream.Pts++
+	}
+}
+
 func processAllFramesAndUpdateJobProgress(inputCtx *gmf.FmtCtx, outputCtx *gmf.FmtCtx, streamMap map[int]int, job types.Job, dbInstance db.Storage, totalFrames float64) error {
+	writer := db.NewProgressWriter(dbInstance, job.ID)
 	var lastDelta int64
 	framesCount := float64(0)
+	started := time.Now()
+	encode := func(inputStream *gmf.Stream, outputStream *gmf.Stream, packet *gmf.Packet, frame *gmf.Frame) error {
+		if err := processFrame(inputStream, outputStream, packet, frame, outputCtx, &lastDelta); err != nil {
+			return err
+		}
+
+		outputStream.Pts++
+		framesCount++
+		speed := framesCount / time.Since(started).Seconds()
+		progress := types.NewProgress(types.StageEncode, int64(framesCount), int64(totalFrames), types.ProgressFrames, speed)
+		if fmt.Sprintf("%.2f", progress.StagePercent) != fmt.Sprintf("%.2f", job.Progress.StagePercent) {
+			job.SetProgress(progress)
+			writer.Update(progress)
+			events.PublishJob(events.JobProgressChanged, job)
+		}
+		return nil
+	}
+
 	for packet := range inputCtx.GetNewPackets() {
 		inputStream, err := getStream(inputCtx, packet.StreamIndex())
 		if err != nil {
@@ -113,23 +149,54 @@ func processAllFramesAndUpdateJobProgress(inputCtx *gmf.FmtCtx, outputCtx *gmf.F
 		}
 
 		for frame := range packet.Frames(inputStream.CodecCtx()) {
-			err := processFrame(inputStream, outputStream, packet, frame, outputCtx, &lastDelta)
-			if err != nil {
+			if err := encode(inputStream, outputStream, packet, frame); err != nil {
 				return err
 			}
+		}
 
-			outputStream.Pts++
-			framesCount++
-			percentage := fmt.Sprintf("%.2f", framesCount/totalFrames*100) + "%"
-			if percentage != job.Progress {
-				job.Progress = percentage
-				dbInstance.UpdateJob(job.ID, job)
+		gmf.Release(packet)
+	}
+
+	videoStream, err := inputCtx.GetBestStream(gmf.AVMEDIA_TYPE_VIDEO)
+	if err != nil {
+		return err
+	}
+	outputStream, err := getStream(outputCtx, streamMap[videoStream.Index()])
+	if err != nil {
+		return err
+	}
+	err = drainDecoder(videoStream, func(packet *gmf.Packet, frame *gmf.Frame) error {
+		return encode(videoStream, outputStream, packet, frame)
+	})
+	if err != nil {
+		return err
+	}
+
+	if elapsed := time.Since(started).Seconds(); framesCount > 0 && elapsed > 0 {
+		metrics.EncodeFPS.Observe(framesCount / elapsed)
+	}
+	return writer.Flush()
+}
+
+// drainDecoder hands the frames the decoder of the stream still
+// holds once every packet was read, as the video decoder keeps
+// back the frames it reorders
+func drainDecoder(inputStream *gmf.Stream, handle func(*gmf.Packet, *gmf.Frame) error) error {
+	for {
+		packet := gmf.NewPacket()
+		decoded := 0
+		for frame := range packet.Frames(inputStream.CodecCtx()) {
+			decoded++
+			if err := handle(packet, frame); err != nil {
+				gmf.Release(packet)
+				return err
 			}
 		}
-
 		gmf.Release(packet)
+		if decoded == 0 {
+			return nil
+		}
 	}
-	return nil
 }
 
 func getStream(context *gmf.FmtCtx, streamIndex int) (*gmf.Stream, error) {
@@ -107,7 +107,9 @@ var _ = Describe("FFmpeg Encoder", func() {
 			FFMPEGEncode(logger, dbInstance, exampleJob.ID)
 			changedJob, _ := dbInstance.RetrieveJob("123")
 
-			Expect(changedJob.Progress).To(Equal("100%"))
+			Expect(changedJob.Progress.Stage).To(Equal(types.StageEncode))
+			Expect(changedJob.Progress.StagePercent).To(Equal(float64(100)))
+			Expect(changedJob.ProgressText).To(Equal("90.00%"))
 			Expect(changedJob.Status).To(Equal(types.JobEncoding))
 		})
 	})
@@ -140,7 +142,6 @@ var _ = Describe("FFmpeg Encoder", func() {
 					},
 				},
 				Status:           types.JobCreated,
-				Progress:         "0%",
 				LocalSource:      currentDir + "/../fixtures/videos/nyt.mp4",
 				LocalDestination: destinationFile,
 			}
@@ -209,7 +210,6 @@ var _ = Describe("FFmpeg Encoder", func() {
 					},
 				},
 				Status:           types.JobCreated,
-				Progress:         "0%",
 				LocalSource:      currentDir + "/../fixtures/videos/nyt.mp4",
 				LocalDestination: destinationFile,
 			}
@@ -266,7 +266,6 @@ var _ = Describe("FFmpeg Encoder", func() {
 					},
 				},
 				Status:           types.JobCreated,
-				Progress:         "0%",
 				LocalSource:      currentDir + "/../fixtures/videos/nyt.mp4",
 				LocalDestination: destinationFile,
 			}
@@ -323,7 +322,6 @@ var _ = Describe("FFmpeg Encoder", func() {
 					},
 				},
 				Status:           types.JobCreated,
-				Progress:         "0%",
 				LocalSource:      currentDir + "/../fixtures/videos/nyt.mp4",
 				LocalDestination: destinationFile,
 			}
@@ -7,6 +7,7 @@ import (
 	"code.cloudfoundry.org/lager"
 	"github.com/snickers/hls/segmenter"
 	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/events"
 	"github.com/snickers/snickers/types"
 )
 
@@ -16,14 +17,15 @@ func HLSEncode(logger lager.Logger, dbInstance db.Storage, jobID string) error {
 	log.Info("started", lager.Data{"job": jobID})
 	defer log.Info("finished")
 
-	job, err := dbInstance.RetrieveJob(jobID)
+	job, err := db.ModifyJob(dbInstance, jobID, func(job *types.Job) error {
+		job.SetProgress(types.NewProgress(types.StageEncode, 0, 0, types.ProgressFrames, 0))
+		job.Status = types.JobEncoding
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-
-	job.Progress = "0%"
-	job.Status = types.JobEncoding
-	dbInstance.UpdateJob(job.ID, job)
+	events.PublishJob(events.JobStatusChanged, job)
 
 	err = encodeInH264(logger, dbInstance, jobID)
 	if err != nil {
@@ -34,8 +36,7 @@ func HLSEncode(logger lager.Logger, dbInstance db.Storage, jobID string) error {
 	if err != nil {
 		return err
 	}
-	job.Progress = "100%"
-	return nil
+	return dbInstance.UpdateJobProgress(jobID, types.CompletedProgress(types.StageEncode))
 }
 
 func encodeInH264(logger lager.Logger, dbInstance db.Storage, jobID string) error {
@@ -43,14 +44,12 @@ func encodeInH264(logger lager.Logger, dbInstance db.Storage, jobID string) erro
 	os.Create(h264Filename)
 	defer os.Remove(h264Filename)
 
-	job, err := dbInstance.RetrieveJob(jobID)
-	if err != nil {
-		return err
-	}
-
-	oldLocalDestination := job.LocalDestination
-	job.LocalDestination = h264Filename
-	_, err = dbInstance.UpdateJob(jobID, job)
+	var oldLocalDestination string
+	_, err := db.ModifyJob(dbInstance, jobID, func(job *types.Job) error {
+		oldLocalDestination = job.LocalDestination
+		job.LocalDestination = h264Filename
+		return nil
+	})
 	if err != nil {
 		return err
 	}
@@ -60,13 +59,12 @@ func encodeInH264(logger lager.Logger, dbInstance db.Storage, jobID string) erro
 		return err
 	}
 
-	job.LocalDestination = oldLocalDestination
-	job.LocalSource = h264Filename
-	_, err = dbInstance.UpdateJob(jobID, job)
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err = db.ModifyJob(dbInstance, jobID, func(job *types.Job) error {
+		job.LocalDestination = oldLocalDestination
+		job.LocalSource = h264Filename
+		return nil
+	})
+	return err
 }
 
 func buildHLSConfig(job types.Job) segmenter.HLSConfig {
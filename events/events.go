@@ -0,0 +1,151 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/snickers/snickers/types"
+)
+
+// These constants are used on the type field of Event
+const (
+	JobStatusChanged   = "status"
+	JobProgressChanged = "progress"
+)
+
+// subscriptionBuffer is how many events a slow subscriber may
+// lag behind before its oldest events are dropped
+const subscriptionBuffer = 64
+
+// Event is a change on a job, as published by the pipeline stages
+type Event struct {
+	Type         string          `json:"type"`
+	JobID        string          `json:"jobId"`
+	Status       types.JobStatus `json:"status"`
+	Details      string          `json:"details,omitempty"`
+	Progress     types.Progress  `json:"progressDetails"`
+	ProgressText string          `json:"progress"`
+	Time         time.Time       `json:"time"`
+
+	// Owner is the tenant of the job, for subscriptions of a tenant
+	Owner string `json:"-"`
+}
+
+// NewJobEvent builds an event from the current state of a job
+func NewJobEvent(eventType string, job types.Job) Event {
+	return Event{
+		Type:         eventType,
+		JobID:        job.ID,
+		Status:       job.Status,
+		Details:      job.Details,
+		Progress:     job.Progress,
+		ProgressText: job.ProgressText,
+		Time:         time.Now().UTC(),
+		Owner:        job.Owner,
+	}
+}
+
+// Bus delivers the published events to its subscribers. Publishing
+// never blocks: subscribers that fall behind lose their oldest
+// events, so the latest state of a job is always delivered.
+type Bus struct {
+	mtx         sync.RWMutex
+	subscribers map[*Subscription]struct{}
+}
+
+// Subscription receives the events of one job, or of every
+// job of its Owner when its JobID is empty
+type Subscription struct {
+	JobID  string
+	Owner  string
+	Events chan Event
+
+	bus       *Bus
+	closeOnce sync.Once
+}
+
+// DefaultBus is the bus used by the pipeline stages
+var DefaultBus = NewBus()
+
+// NewBus returns a bus without subscribers
+func NewBus() *Bus {
+	return &Bus{subscribers: map[*Subscription]struct{}{}}
+}
+
+// Publish sends an event to the DefaultBus
+func Publish(event Event) {
+	DefaultBus.Publish(event)
+}
+
+// PublishJob sends the current state of a job to the DefaultBus
+func PublishJob(eventType string, job types.Job) {
+	DefaultBus.Publish(NewJobEvent(eventType, job))
+}
+
+// Subscribe starts receiving the events of a job, or of
+// every job if jobID is empty
+func (b *Bus) Subscribe(jobID string) *Subscription {
+	return b.subscribe(jobID, types.AnyOwner)
+}
+
+// SubscribeOwner starts receiving the events of every job
+// of a tenant
+func (b *Bus) SubscribeOwner(owner string) *Subscription {
+	return b.subscribe("", owner)
+}
+
+func (b *Bus) subscribe(jobID string, owner string) *Subscription {
+	s := &Subscription{
+		JobID:  jobID,
+		Owner:  owner,
+		Events: make(chan Event, subscriptionBuffer),
+		bus:    b,
+	}
+
+	b.mtx.Lock()
+	b.subscribers[s] = struct{}{}
+	b.mtx.Unlock()
+	return s
+}
+
+// Publish delivers an event to the subscribers interested in it
+func (b *Bus) Publish(event Event) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	for s := range b.subscribers {
+		if s.JobID != "" && s.JobID != event.JobID {
+			continue
+		}
+		if s.Owner != types.AnyOwner && s.Owner != event.Owner {
+			continue
+		}
+		s.deliver(event)
+	}
+}
+
+func (s *Subscription) deliver(event Event) {
+	for {
+		select {
+		case s.Events <- event:
+			return
+		default:
+		}
+
+		// drop the oldest event to make room
+		select {
+		case <-s.Events:
+		default:
+		}
+	}
+}
+
+// Close stops the subscription and closes its channel
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		s.bus.mtx.Lock()
+		delete(s.bus.subscribers, s)
+		s.bus.mtx.Unlock()
+		close(s.Events)
+	})
+}
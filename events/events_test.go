@@ -0,0 +1,80 @@
+package events
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/snickers/snickers/types"
+)
+
+var _ = Describe("Bus", func() {
+	var bus *Bus
+
+	BeforeEach(func() {
+		bus = NewBus()
+	})
+
+	It("should deliver the events of a job to its subscribers", func() {
+		subscription := bus.Subscribe("123")
+		defer subscription.Close()
+
+		bus.Publish(NewJobEvent(JobStatusChanged, types.Job{ID: "123", Status: types.JobEncoding}))
+		bus.Publish(NewJobEvent(JobStatusChanged, types.Job{ID: "321", Status: types.JobFinished}))
+
+		var event Event
+		Expect(subscription.Events).To(Receive(&event))
+		Expect(event.JobID).To(Equal("123"))
+		Expect(event.Status).To(Equal(types.JobEncoding))
+		Expect(subscription.Events).NotTo(Receive())
+	})
+
+	It("should deliver every event to subscribers without a job", func() {
+		subscription := bus.Subscribe("")
+		defer subscription.Close()
+
+		bus.Publish(NewJobEvent(JobStatusChanged, types.Job{ID: "123"}))
+		bus.Publish(NewJobEvent(JobProgressChanged, types.Job{ID: "321"}))
+
+		Expect(subscription.Events).To(HaveLen(2))
+	})
+
+	It("should deliver the events of the jobs of a tenant to its subscribers", func() {
+		subscription := bus.SubscribeOwner("team-a")
+		defer subscription.Close()
+
+		bus.Publish(NewJobEvent(JobStatusChanged, types.Job{ID: "123", Owner: "team-a"}))
+		bus.Publish(NewJobEvent(JobStatusChanged, types.Job{ID: "321", Owner: "team-b"}))
+		bus.Publish(NewJobEvent(JobStatusChanged, types.Job{ID: "456"}))
+
+		var event Event
+		Expect(subscription.Events).To(Receive(&event))
+		Expect(event.JobID).To(Equal("123"))
+		Expect(subscription.Events).NotTo(Receive())
+	})
+
+	It("should drop the oldest events of slow subscribers", func() {
+		subscription := bus.Subscribe("123")
+		defer subscription.Close()
+
+		for i := 0; i < subscriptionBuffer; i++ {
+			bus.Publish(NewJobEvent(JobProgressChanged, types.Job{ID: "123"}))
+		}
+		bus.Publish(NewJobEvent(JobStatusChanged, types.Job{ID: "123", Status: types.JobFinished}))
+
+		Expect(subscription.Events).To(HaveLen(subscriptionBuffer))
+		var event Event
+		for i := 0; i < subscriptionBuffer; i++ {
+			Expect(subscription.Events).To(Receive(&event))
+		}
+		Expect(event.Type).To(Equal(JobStatusChanged))
+		Expect(event.Status).To(Equal(types.JobFinished))
+	})
+
+	It("should stop delivering events once closed", func() {
+		subscription := bus.Subscribe("123")
+		subscription.Close()
+		subscription.Close()
+
+		bus.Publish(NewJobEvent(JobStatusChanged, types.Job{ID: "123"}))
+		Eventually(subscription.Events).Should(BeClosed())
+	})
+})
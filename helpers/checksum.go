@@ -0,0 +1,120 @@
+package helpers
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// ParseChecksum splits a checksum given as "algorithm:hexdigest"
+// into its algorithm and digest. Bare digests are accepted as well
+// and the algorithm is inferred from their length.
+func ParseChecksum(checksum string) (string, string, error) {
+	algorithm := ""
+	digest := checksum
+	if i := strings.Index(checksum, ":"); i >= 0 {
+		algorithm = strings.ToLower(checksum[:i])
+		digest = checksum[i+1:]
+	}
+	digest = strings.ToLower(digest)
+
+	if algorithm == "" {
+		switch len(digest) {
+		case md5.Size * 2:
+			algorithm = "md5"
+		case sha256.Size * 2:
+			algorithm = "sha256"
+		default:
+			return "", "", errors.New("unable to infer checksum algorithm from " + checksum)
+		}
+	}
+
+	if _, err := NewHash(algorithm); err != nil {
+		return "", "", err
+	}
+	if _, err := hex.DecodeString(digest); err != nil {
+		return "", "", errors.New("invalid checksum digest " + digest)
+	}
+
+	return algorithm, digest, nil
+}
+
+// NewHash returns a hash for the given algorithm name
+func NewHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "md5":
+		return md5.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	}
+	return nil, errors.New("unsupported checksum algorithm " + algorithm)
+}
+
+// FileChecksum computes the hex digest of a file using
+// the given algorithm
+func FileChecksum(filePath string, algorithm string) (string, error) {
+	h, err := NewHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// FileDigests computes the md5 and sha256 hex digests of a file
+// along with its size, reading it only once
+func FileDigests(filePath string) (string, string, int64, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", "", 0, err
+	}
+	defer f.Close()
+
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(md5Hash, sha256Hash), f)
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	return hex.EncodeToString(md5Hash.Sum(nil)), hex.EncodeToString(sha256Hash.Sum(nil)), size, nil
+}
+
+// VerifyChecksum checks the file against the expected checksum.
+// An empty checksum means there is nothing to verify.
+func VerifyChecksum(filePath string, checksum string) error {
+	if checksum == "" {
+		return nil
+	}
+
+	algorithm, expected, err := ParseChecksum(checksum)
+	if err != nil {
+		return err
+	}
+
+	actual, err := FileChecksum(filePath, algorithm)
+	if err != nil {
+		return err
+	}
+
+	if actual != expected {
+		return fmt.Errorf("checksum mismatch: expected %s %s, got %s", algorithm, expected, actual)
+	}
+	return nil
+}
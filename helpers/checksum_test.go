@@ -0,0 +1,66 @@
+package helpers
+
+import (
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Checksum", func() {
+	var filePath string
+
+	BeforeEach(func() {
+		f, _ := ioutil.TempFile(os.TempDir(), "checksum")
+		f.WriteString("snickers")
+		f.Close()
+		filePath = f.Name()
+	})
+
+	AfterEach(func() {
+		os.Remove(filePath)
+	})
+
+	It("should parse checksums prefixed with the algorithm", func() {
+		algorithm, digest, err := ParseChecksum("MD5:CE922D89A6C244FB0C5AFF66BC46E9BE")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(algorithm).To(Equal("md5"))
+		Expect(digest).To(Equal("ce922d89a6c244fb0c5aff66bc46e9be"))
+	})
+
+	It("should infer the algorithm from the digest length", func() {
+		algorithm, _, err := ParseChecksum("62708057fa8cb45202db7af23362156934cbc08237057fcfac8d4cad610f5c8e")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(algorithm).To(Equal("sha256"))
+	})
+
+	It("should refuse unsupported algorithms", func() {
+		_, _, err := ParseChecksum("crc32:deadbeef")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should compute md5 and sha256 digests of a file", func() {
+		Expect(FileChecksum(filePath, "md5")).To(Equal("ce922d89a6c244fb0c5aff66bc46e9be"))
+		Expect(FileChecksum(filePath, "sha256")).To(Equal("62708057fa8cb45202db7af23362156934cbc08237057fcfac8d4cad610f5c8e"))
+	})
+
+	It("should compute all digests and the size in one pass", func() {
+		md5sum, sha256sum, size, err := FileDigests(filePath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(md5sum).To(Equal("ce922d89a6c244fb0c5aff66bc46e9be"))
+		Expect(sha256sum).To(Equal("62708057fa8cb45202db7af23362156934cbc08237057fcfac8d4cad610f5c8e"))
+		Expect(size).To(Equal(int64(8)))
+	})
+
+	It("should verify a matching checksum", func() {
+		Expect(VerifyChecksum(filePath, "sha256:62708057fa8cb45202db7af23362156934cbc08237057fcfac8d4cad610f5c8e")).To(Succeed())
+		Expect(VerifyChecksum(filePath, "")).To(Succeed())
+	})
+
+	It("should return an error on checksum mismatch", func() {
+		err := VerifyChecksum(filePath, "md5:cbd55ccfd5fba124b533d160661a88a3")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("checksum mismatch"))
+	})
+})
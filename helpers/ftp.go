@@ -0,0 +1,137 @@
+package helpers
+
+import (
+	"crypto/tls"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/flavioribeiro/gonfig"
+	"github.com/secsy/goftp"
+)
+
+// GetFTPClient connects to the server of a ftp:// or ftps:// URL.
+// Timeouts, active/passive mode and the TLS mode used for ftps://
+// come from the FTP_* settings on config.
+func GetFTPClient(logger lager.Logger, config gonfig.Gonfig, u *url.URL) (*goftp.Client, error) {
+	ftpConfig, err := getFTPConfig(logger, config, u)
+	if err != nil {
+		return nil, err
+	}
+
+	return goftp.DialConfig(ftpConfig, getFTPAddress(u, ftpConfig))
+}
+
+// FTPMkdirAll creates a remote directory along with any
+// missing parents
+func FTPMkdirAll(client *goftp.Client, dir string) error {
+	current := ""
+	if strings.HasPrefix(dir, "/") {
+		current = "/"
+	}
+
+	for _, part := range strings.Split(dir, "/") {
+		if part == "" || part == "." {
+			continue
+		}
+		current = path.Join(current, part)
+		if current == "." || current == ".." {
+			continue
+		}
+
+		if _, err := client.Stat(current); err == nil {
+			continue
+		}
+		if _, err := client.Mkdir(current); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getFTPConfig(logger lager.Logger, config gonfig.Gonfig, u *url.URL) (goftp.Config, error) {
+	timeout, err := config.GetInt("FTP_TIMEOUT", 10)
+	if err != nil {
+		return goftp.Config{}, err
+	}
+
+	activeMode, err := config.GetBool("FTP_ACTIVE_MODE", false)
+	if err != nil {
+		return goftp.Config{}, err
+	}
+
+	debug, err := config.GetBool("FTP_DEBUG", false)
+	if err != nil {
+		return goftp.Config{}, err
+	}
+
+	pw, _ := u.User.Password()
+	ftpConfig := goftp.Config{
+		User:               u.User.Username(),
+		Password:           pw,
+		ConnectionsPerHost: 10,
+		Timeout:            time.Duration(timeout) * time.Second,
+		ActiveTransfers:    activeMode,
+	}
+
+	if debug {
+		ftpConfig.Logger = ftpLogWriter{logger.Session("ftp")}
+	}
+
+	if u.Scheme == "ftps" {
+		tlsMode, err := config.GetString("FTP_TLS_MODE", "explicit")
+		if err != nil {
+			return goftp.Config{}, err
+		}
+
+		insecure, err := config.GetBool("FTP_TLS_INSECURE_SKIP_VERIFY", false)
+		if err != nil {
+			return goftp.Config{}, err
+		}
+
+		ftpConfig.TLSConfig = &tls.Config{
+			ServerName:         getFTPHostname(u),
+			InsecureSkipVerify: insecure,
+		}
+		ftpConfig.TLSMode = goftp.TLSExplicit
+		if tlsMode == "implicit" {
+			ftpConfig.TLSMode = goftp.TLSImplicit
+		}
+	}
+
+	return ftpConfig, nil
+}
+
+// getFTPAddress returns the host:port to dial, keeping the port
+// from the URL if there is one
+func getFTPAddress(u *url.URL, ftpConfig goftp.Config) string {
+	if _, _, err := net.SplitHostPort(u.Host); err == nil {
+		return u.Host
+	}
+
+	if ftpConfig.TLSConfig != nil && ftpConfig.TLSMode == goftp.TLSImplicit {
+		return net.JoinHostPort(u.Host, "990")
+	}
+	return net.JoinHostPort(u.Host, "21")
+}
+
+func getFTPHostname(u *url.URL) string {
+	if host, _, err := net.SplitHostPort(u.Host); err == nil {
+		return host
+	}
+	return u.Host
+}
+
+// ftpLogWriter sends the FTP protocol log to lager instead
+// of stderr
+type ftpLogWriter struct {
+	log lager.Logger
+}
+
+func (w ftpLogWriter) Write(p []byte) (int, error) {
+	w.log.Debug("message", lager.Data{"line": strings.TrimSpace(string(p))})
+	return len(p), nil
+}
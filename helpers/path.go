@@ -59,6 +59,23 @@ func GetOutputFilename(dbInstance db.Storage, jobID string) (string, error) {
 	return strings.Split(path.Base(job.Source), ".")[0] + "_" + job.Preset.Name + "." + job.Preset.Container, nil
 }
 
+// GetLocalOutputDirectory returns the directory keeping the
+// outputs of jobs with local:// destinations
+func GetLocalOutputDirectory(config gonfig.Gonfig) (string, error) {
+	swapDir, err := config.GetString("SWAP_DIRECTORY", "")
+	if err != nil {
+		return "", err
+	}
+
+	return config.GetString("LOCAL_OUTPUT_DIRECTORY", path.Join(swapDir, "outputs"))
+}
+
+// GetJobSwapDirectory returns the directory keeping the source
+// and the encoded outputs of a job while it runs
+func GetJobSwapDirectory(config gonfig.Gonfig, jobID string) (string, error) {
+	return getBaseDir(config, jobID)
+}
+
 func getBaseDir(config gonfig.Gonfig, jobID string) (string, error) {
 	swapDir, err := config.GetString("SWAP_DIRECTORY", "")
 	if err != nil {
@@ -59,6 +59,10 @@ var _ = Describe("Helpers", func() {
 			Expect(GetLocalDestination(cfg, dbInstance, exampleJob.ID)).To(Equal("/tmp/123/dst/KailuaBeach_640x360.webm"))
 		})
 
+		It("GetLocalOutputDirectory should default to a folder on the swap directory", func() {
+			Expect(GetLocalOutputDirectory(cfg)).To(Equal("/tmp/outputs"))
+		})
+
 		It("GetOutputFilename should build output filename based on job and preset", func() {
 			exampleJob := types.Job{
 				ID:          "123",
@@ -2,14 +2,29 @@ package main
 
 import (
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"code.cloudfoundry.org/lager"
 	"github.com/flavioribeiro/gonfig"
+	"github.com/snickers/snickers/cli"
 	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/pipeline"
 	"github.com/snickers/snickers/server"
+	"github.com/snickers/snickers/uploaders"
+	"github.com/snickers/snickers/watcher"
 )
 
 func main() {
+	command := "server"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+	if command != "server" && command != "worker" {
+		os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
 	currentDir, err := os.Getwd()
 	if err != nil {
 		panic(err)
@@ -29,13 +44,74 @@ func main() {
 		panic(err)
 	}
 
+	if err := pipeline.ConfigureScheduler(config); err != nil {
+		panic(err)
+	}
+
+	shutdownTimeout, err := config.GetInt("SHUTDOWN_TIMEOUT", 300)
+	if err != nil {
+		panic(err)
+	}
+
+	if command == "worker" {
+		runWorker(log, config, db, time.Duration(shutdownTimeout)*time.Second)
+		return
+	}
+
 	port, err := config.GetString("PORT", "8000")
 	if err != nil {
 		panic(err)
 	}
 
+	if err := uploaders.StartLocalRetention(log, config); err != nil {
+		panic(err)
+	}
+
+	if err := pipeline.RecoverJobs(log, config, db); err != nil {
+		panic(err)
+	}
+
+	if err := pipeline.StartScheduledJobs(log, config, db); err != nil {
+		panic(err)
+	}
+
+	if _, err := watcher.StartAll(log, config, db); err != nil {
+		panic(err)
+	}
+
 	snickersServer := server.New(log, config, "tcp", ":"+port, db)
-	snickersServer.Start(true)
+	if err := snickersServer.Start(false); err != nil {
+		panic(err)
+	}
+
+	waitForSignal(log)
+	if err := snickersServer.Shutdown(time.Duration(shutdownTimeout) * time.Second); err != nil {
+		log.Error("shutdown-failed", err)
+		os.Exit(1)
+	}
+}
+
+// runWorker runs the jobs queued by the API nodes until told to
+// stop, leaving the jobs still running after the timeout to be
+// taken over by the other workers
+func runWorker(log lager.Logger, config gonfig.Gonfig, dbInstance db.Storage, shutdownTimeout time.Duration) {
+	worker, err := pipeline.NewWorker(log, config, dbInstance)
+	if err != nil {
+		panic(err)
+	}
+	go worker.Run()
+
+	waitForSignal(log)
+	if unfinished := pipeline.Jobs.Drain(shutdownTimeout); len(unfinished) > 0 {
+		log.Info("left-for-other-workers", lager.Data{"jobs": unfinished})
+	}
+}
+
+func waitForSignal(log lager.Logger) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-signals
+	log.Info("received-signal", lager.Data{"signal": sig.String()})
 }
 
 func setupLogger(config gonfig.Gonfig) (lager.Logger, error) {
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/types"
+)
+
+// Namespace prefixes the name of every Snickers metric
+const Namespace = "snickers"
+
+// These are updated by the pipeline as jobs go through it
+var (
+	StageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "stage_duration_seconds",
+		Help:      "How long the download, encode and upload stages of jobs took.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 14),
+	}, []string{"stage"})
+
+	DownloadedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "downloaded_bytes_total",
+		Help:      "Bytes of sources downloaded.",
+	})
+
+	UploadedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "uploaded_bytes_total",
+		Help:      "Bytes of outputs uploaded.",
+	})
+
+	EncodeFPS = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "encode_frames_per_second",
+		Help:      "Frames encoded per second by each encode.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	})
+
+	QueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "queue_depth",
+		Help:      "Jobs waiting to start running.",
+	})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of the API requests by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "code"})
+)
+
+func init() {
+	prometheus.MustRegister(StageDuration, DownloadedBytes, UploadedBytes, EncodeFPS, QueueDepth, HTTPRequestDuration)
+}
+
+// jobsCollector reports how many jobs are on each status, as
+// counted by the storage at scrape time
+type jobsCollector struct {
+	db   db.Storage
+	desc *prometheus.Desc
+}
+
+// NewJobsCollector returns a collector of the jobs by status
+func NewJobsCollector(dbInstance db.Storage) prometheus.Collector {
+	return &jobsCollector{
+		db: dbInstance,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "", "jobs"),
+			"Jobs on each status.",
+			[]string{"status"}, nil,
+		),
+	}
+}
+
+func (c *jobsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *jobsCollector) Collect(ch chan<- prometheus.Metric) {
+	counts, err := c.db.CountJobsByStatus()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+
+	statuses := []types.JobStatus{types.JobCreated, types.JobScheduled, types.JobQueued, types.JobDownloading, types.JobEncoding, types.JobUploading, types.JobFinished, types.JobError, types.JobCanceled}
+	for _, status := range statuses {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(counts[status]), string(status))
+	}
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"strings"
+
+	"github.com/flavioribeiro/gonfig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/types"
+)
+
+var _ = Describe("Metrics", func() {
+	var dbInstance db.Storage
+
+	BeforeEach(func() {
+		cfg, _ := gonfig.FromJson(strings.NewReader(`{"DATABASE_DRIVER":"memory"}`))
+		dbInstance, _ = db.GetDatabase(cfg)
+		dbInstance.ClearDatabase()
+	})
+
+	AfterEach(func() {
+		dbInstance.ClearDatabase()
+	})
+
+	Describe("NewJobsCollector", func() {
+		It("should report the jobs on every status", func() {
+			dbInstance.StoreJob(types.Job{ID: "123", Status: types.JobDownloading})
+			dbInstance.StoreJob(types.Job{ID: "456", Status: types.JobError})
+			dbInstance.StoreJob(types.Job{ID: "789", Status: types.JobError})
+
+			expected := `
+# HELP snickers_jobs Jobs on each status.
+# TYPE snickers_jobs gauge
+snickers_jobs{status="canceled"} 0
+snickers_jobs{status="created"} 0
+snickers_jobs{status="downloading"} 1
+snickers_jobs{status="encoding"} 0
+snickers_jobs{status="error"} 2
+snickers_jobs{status="finished"} 0
+snickers_jobs{status="queued"} 0
+snickers_jobs{status="scheduled"} 0
+snickers_jobs{status="uploading"} 0
+`
+			err := testutil.CollectAndCompare(NewJobsCollector(dbInstance), strings.NewReader(expected))
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/flavioribeiro/gonfig"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/events"
+	"github.com/snickers/snickers/types"
+)
+
+// ErrNotScheduled is returned when starting a scheduled job that
+// was started in the meantime
+var ErrNotScheduled = errors.New("job is not scheduled")
+
+// StartScheduledJobs checks every SCHEDULED_START_INTERVAL seconds
+// (defaults to 10) for the scheduled jobs due to start. As they
+// are kept on the database, they survive restarts.
+func StartScheduledJobs(logger lager.Logger, config gonfig.Gonfig, dbInstance db.Storage) error {
+	seconds, err := config.GetInt("SCHEDULED_START_INTERVAL", 10)
+	if err != nil {
+		return err
+	}
+
+	interval := time.Duration(seconds) * time.Second
+	go func() {
+		for {
+			if !Jobs.Draining() {
+				StartDueJobs(logger, config, dbInstance, now())
+			}
+			time.Sleep(interval)
+		}
+	}()
+	return nil
+}
+
+// StartDueJobs starts the scheduled jobs that may start at the
+// given time, leaving scheduled those of tenants over their quota
+func StartDueJobs(logger lager.Logger, config gonfig.Gonfig, dbInstance db.Storage, at time.Time) error {
+	log := logger.Session("start-due-jobs")
+
+	jobs, err := findJobs(dbInstance, types.JobScheduled)
+	if err != nil {
+		log.Error("finding-scheduled-jobs-failed", err)
+		return err
+	}
+
+	for _, job := range jobs {
+		if !job.StartDue(at) {
+			continue
+		}
+		if err := checkScheduledQuota(config, dbInstance, job); err != nil {
+			// the job stays scheduled until a later check finds room
+			if _, ok := err.(QuotaExceededError); ok {
+				log.Info("over-quota", lager.Data{"id": job.ID, "reason": err.Error()})
+			} else {
+				log.Error("checking-quota-failed", err, lager.Data{"id": job.ID})
+			}
+			continue
+		}
+		if _, err := StartScheduledJob(logger, config, dbInstance, job.ID); err != nil && err != ErrNotScheduled {
+			log.Error("starting-job-failed", err, lager.Data{"id": job.ID})
+		}
+	}
+	return nil
+}
+
+// StartScheduledJob starts a scheduled job right away, unless it
+// was already started by someone else, and returns it as queued
+func StartScheduledJob(logger lager.Logger, config gonfig.Gonfig, dbInstance db.Storage, jobID string) (types.Job, error) {
+	job, err := db.ModifyJob(dbInstance, jobID, func(job *types.Job) error {
+		if job.Status != types.JobScheduled {
+			return ErrNotScheduled
+		}
+		job.Status = types.JobQueued
+		return nil
+	})
+	if err != nil {
+		return job, err
+	}
+	events.PublishJob(events.JobStatusChanged, job)
+
+	go StartQueuedJob(logger, config, dbInstance, job)
+	return job, nil
+}
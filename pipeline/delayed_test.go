@@ -0,0 +1,99 @@
+package pipeline
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/flavioribeiro/gonfig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/types"
+)
+
+var _ = Describe("Scheduled start", func() {
+	var (
+		cfg        gonfig.Gonfig
+		dbInstance db.Storage
+		at         time.Time
+	)
+
+	BeforeEach(func() {
+		currentDir, _ := os.Getwd()
+		cfg, _ = gonfig.FromJsonFile(currentDir + "/../fixtures/config.json")
+		dbInstance, _ = db.GetDatabase(cfg)
+		dbInstance.ClearDatabase()
+		dbInstance.StorePreset(types.Preset{Name: "240p", Container: "mp4"})
+		at = time.Now()
+	})
+
+	It("should schedule jobs created with a start time", func() {
+		startAt := at.Add(time.Hour)
+		job, err := CreateJob(dbInstance, types.JobInput{PresetName: "240p", StartAt: &startAt})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.Status).To(Equal(types.JobScheduled))
+		Expect(job.StartAt.Equal(startAt)).To(BeTrue())
+	})
+
+	It("should schedule jobs created with auto start to start right away", func() {
+		job, err := CreateJob(dbInstance, types.JobInput{PresetName: "240p", AutoStart: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.Status).To(Equal(types.JobScheduled))
+		Expect(job.StartAt.Equal(job.CreatedAt)).To(BeTrue())
+		Expect(job.StartDue(at)).To(BeTrue())
+	})
+
+	It("should only start the jobs that are due", func() {
+		past, future := at.Add(-time.Minute), at.Add(time.Minute)
+		dbInstance.StoreJob(types.Job{ID: "due", Status: types.JobScheduled, StartAt: &past})
+		dbInstance.StoreJob(types.Job{ID: "later", Status: types.JobScheduled, StartAt: &future})
+		dbInstance.StoreJob(types.Job{ID: "uploading", Status: types.JobScheduled, StartAt: &past,
+			Upload: &types.SourceUpload{Filename: "source.mp4", Length: 10, Offset: 4}})
+		dbInstance.StoreJob(types.Job{ID: "created", Status: types.JobCreated})
+
+		Expect(StartDueJobs(lagertest.NewTestLogger("start"), cfg, dbInstance, at)).To(Succeed())
+
+		Eventually(func() types.JobStatus {
+			job, _ := dbInstance.RetrieveJob("due")
+			return job.Status
+		}).ShouldNot(Equal(types.JobScheduled))
+		for id, status := range map[string]types.JobStatus{"later": types.JobScheduled, "uploading": types.JobScheduled, "created": types.JobCreated} {
+			job, _ := dbInstance.RetrieveJob(id)
+			Expect(job.Status).To(Equal(status))
+		}
+	})
+
+	It("should leave due jobs scheduled while their tenant is over quota", func() {
+		cfg, _ = gonfig.FromJson(strings.NewReader(`{
+			"DATABASE_DRIVER": "memory",
+			"SWAP_DIRECTORY": "/tmp/",
+			"TENANT_QUOTAS": {"*": {"maxRunningJobs": 1}}
+		}`))
+		dbInstance, _ = db.GetDatabase(cfg)
+		dbInstance.ClearDatabase()
+		past := at.Add(-time.Minute)
+		dbInstance.StoreJob(types.Job{ID: "running", Owner: "team-a", Status: types.JobEncoding})
+		dbInstance.StoreJob(types.Job{ID: "due-a", Owner: "team-a", Status: types.JobScheduled, StartAt: &past})
+		dbInstance.StoreJob(types.Job{ID: "due-b", Owner: "team-b", Status: types.JobScheduled, StartAt: &past})
+		dbInstance.StoreJob(types.Job{ID: "due-c", Owner: "team-b", Status: types.JobScheduled, StartAt: &past})
+
+		Expect(StartDueJobs(lagertest.NewTestLogger("start"), cfg, dbInstance, at)).To(Succeed())
+
+		statuses := map[string]types.JobStatus{}
+		for _, id := range []string{"due-a", "due-b", "due-c"} {
+			job, _ := dbInstance.RetrieveJob(id)
+			statuses[id] = job.Status
+		}
+		Expect(statuses["due-a"]).To(Equal(types.JobScheduled))
+		Expect(statuses["due-b"]).NotTo(Equal(types.JobScheduled))
+		Expect(statuses["due-c"]).To(Equal(types.JobScheduled))
+	})
+
+	It("should not start a job twice", func() {
+		dbInstance.StoreJob(types.Job{ID: "123", Status: types.JobQueued})
+		_, err := StartScheduledJob(lagertest.NewTestLogger("start"), cfg, dbInstance, "123")
+		Expect(err).To(Equal(ErrNotScheduled))
+	})
+})
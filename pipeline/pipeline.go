@@ -1,75 +1,282 @@
 package pipeline
 
 import (
+	"errors"
 	"net/url"
 	"os"
 	"path"
+	"time"
 
 	"code.cloudfoundry.org/lager"
+	"github.com/dchest/uniuri"
 	"github.com/flavioribeiro/gonfig"
 	"github.com/snickers/snickers/db"
 	"github.com/snickers/snickers/downloaders"
 	"github.com/snickers/snickers/encoders"
+	"github.com/snickers/snickers/events"
 	"github.com/snickers/snickers/helpers"
+	"github.com/snickers/snickers/metrics"
 	"github.com/snickers/snickers/types"
 	"github.com/snickers/snickers/uploaders"
 )
 
-// StartJob starts the job
+// CreateJob stores a new job for the given input, using the
+// preset it names among the presets of its owner. Jobs with a start
+// time or auto start are scheduled to start by themselves.
+func CreateJob(dbInstance db.Storage, jobInput types.JobInput) (types.Job, error) {
+	if jobInput.SourceChecksum != "" {
+		if _, _, err := helpers.ParseChecksum(jobInput.SourceChecksum); err != nil {
+			return types.Job{}, err
+		}
+	}
+
+	preset, err := dbInstance.RetrievePreset(jobInput.Owner, jobInput.PresetName)
+	if err != nil {
+		return types.Job{}, err
+	}
+
+	var job types.Job
+
+	job.ID = uniuri.New()
+	job.Owner = jobInput.Owner
+	job.Source = jobInput.Source
+	job.Destination = jobInput.Destination
+	job.Preset = preset
+	job.SourceChecksum = jobInput.SourceChecksum
+	job.Manifest = jobInput.Manifest
+	job.Priority = jobInput.Priority
+	job.Status = types.JobCreated
+	job.CreatedAt = now()
+	if jobInput.AutoStart || jobInput.StartAt != nil {
+		job.Status = types.JobScheduled
+		job.StartAt = jobInput.StartAt
+		if job.StartAt == nil {
+			job.StartAt = &job.CreatedAt
+		}
+	}
+	return dbInstance.StoreJob(job)
+}
+
+// StartJob queues the job and runs it once the scheduler picks it,
+// unless Snickers is shutting down by then. It returns when the job
+// is done. With distributed workers, it waits for one of them to
+// run the job instead. Only created and scheduled jobs are started.
 func StartJob(logger lager.Logger, config gonfig.Gonfig, dbInstance db.Storage, job types.Job) {
+	log := logger.Session("queue-job", lager.Data{"id": job.ID})
+	if Jobs.Draining() {
+		log.Error("not-started", ErrDraining)
+		return
+	}
+
+	job, err := QueueJob(dbInstance, job.ID)
+	if err != nil {
+		log.Error("failed", err)
+		return
+	}
+	StartQueuedJob(logger, config, dbInstance, job)
+}
+
+// StartQueuedJob runs a job that was already queued once the
+// scheduler picks it, or waits for a worker to run it
+func StartQueuedJob(logger lager.Logger, config gonfig.Gonfig, dbInstance db.Storage, job types.Job) {
 	log := logger.Session("start-job", lager.Data{
 		"id":          job.ID,
 		"status":      job.Status,
 		"source":      job.Source,
 		"destination": job.Destination,
+		"priority":    job.Priority,
 	})
 	defer log.Info("finished")
 
+	if Queue.Remote() {
+		log.Info("queued-for-workers")
+		followJob(log, dbInstance, job)
+		return
+	}
+
+	log.Info("queued")
+	release := Queue.Wait(job)
+	defer release()
+
+	if err := Jobs.Acquire(job.ID); err != nil {
+		log.Error("not-started", err)
+		return
+	}
+	defer Jobs.Release(job.ID)
+
 	log.Info("setup")
 	newJob, err := SetupJob(job.ID, dbInstance, config)
-	job = *newJob
-	if err != nil {
+	if err == ErrNotStartable {
+		log.Info("no-longer-queued")
+		return
+	} else if err != nil {
 		log.Error("setup-job failed", err)
 		return
 	}
 
-	log.Info("downloading")
-	downloadFunc := downloaders.GetDownloadFunc(job.Source)
-	if err := downloadFunc(log, config, dbInstance, job.ID); err != nil {
-		log.Error("download failed", err)
-		job.Status = types.JobError
-		job.Details = err.Error()
-		dbInstance.UpdateJob(job.ID, job)
-		return
+	runJob(log, logger, config, dbInstance, *newJob, types.StageDownload, nil)
+}
+
+// runJob goes through the stages of a job that was already set
+// up, starting from the given one. Once stop is closed, the job is
+// left as it is after the stage running by then.
+func runJob(log lager.Logger, logger lager.Logger, config gonfig.Gonfig, dbInstance db.Storage, job types.Job, from types.JobStage, stop <-chan struct{}) {
+	if from == types.StageDownload {
+		if job.Upload != nil {
+			log.Info("skipping download of uploaded source")
+			if !job.Upload.Complete {
+				failJob(log, dbInstance, job.ID, errors.New("source upload is not complete"))
+				return
+			}
+		} else {
+			log.Info("downloading")
+			startStage(dbInstance, job.ID, types.StageDownload)
+			downloadFunc := downloaders.GetDownloadFunc(job.Source)
+			if err := downloadFunc(log, config, dbInstance, job.ID); err != nil {
+				log.Error("download failed", err)
+				failJob(log, dbInstance, job.ID, err)
+				return
+			}
+			if info, err := os.Stat(job.LocalSource); err == nil {
+				metrics.DownloadedBytes.Add(float64(info.Size()))
+			}
+		}
+
+		if err := downloaders.VerifySourceChecksum(log, dbInstance, job.ID); err != nil {
+			failJob(log, dbInstance, job.ID, err)
+			return
+		}
 	}
 
-	log.Info("encoding")
-	encodeFunc := encoders.GetEncodeFunc(job)
-	if err := encodeFunc(logger, dbInstance, job.ID); err != nil {
-		log.Error("encode failed", err)
-		job.Status = types.JobError
-		job.Details = err.Error()
-		dbInstance.UpdateJob(job.ID, job)
+	if stopped(log, stop) {
 		return
 	}
+	if from != types.StageUpload {
+		log.Info("encoding")
+		startStage(dbInstance, job.ID, types.StageEncode)
+		encodeFunc := encoders.GetEncodeFunc(job)
+		if err := encodeFunc(logger, dbInstance, job.ID); err != nil {
+			log.Error("encode failed", err)
+			failJob(log, dbInstance, job.ID, err)
+			return
+		}
+	}
 
+	if stopped(log, stop) {
+		return
+	}
 	log.Info("uploading")
+	startStage(dbInstance, job.ID, types.StageUpload)
 	uploadFunc := uploaders.GetUploadFunc(job.Destination)
-	if err := uploadFunc(logger, dbInstance, job.ID); err != nil {
+	if err := uploadFunc(logger, config, dbInstance, job.ID); err != nil {
 		log.Error("upload failed", err)
-		job.Status = types.JobError
-		job.Details = err.Error()
-		dbInstance.UpdateJob(job.ID, job)
+		failJob(log, dbInstance, job.ID, err)
 		return
 	}
+	if uploaded, err := dbInstance.RetrieveJob(job.ID); err == nil {
+		for _, output := range uploaded.Outputs {
+			metrics.UploadedBytes.Add(float64(output.Size))
+		}
+	}
 
+	if stopped(log, stop) {
+		return
+	}
 	log.Info("erasing temporary files")
 	if err := CleanSwap(dbInstance, job.ID); err != nil {
 		log.Error("erasing temporary files failed", err)
 	}
 
-	job.Status = types.JobFinished
-	dbInstance.UpdateJob(job.ID, job)
+	finishJob(log, dbInstance, job.ID, types.JobFinished, "")
+}
+
+// stopped tells if the job was stopped between its stages
+func stopped(log lager.Logger, stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		log.Info("stopped")
+		return true
+	default:
+		return false
+	}
+}
+
+// failJob marks the job as failed with the error on its details
+func failJob(log lager.Logger, dbInstance db.Storage, jobID string, err error) {
+	finishJob(log, dbInstance, jobID, types.JobError, err.Error())
+}
+
+// finishJob sets the final status of the job, closing the timing
+// of the stage that was running and of the job itself. Only these
+// fields are changed so what the stages stored on it is kept.
+func finishJob(log lager.Logger, dbInstance db.Storage, jobID string, status types.JobStatus, details string) {
+	finishedAt := now()
+	var closed *types.StageTiming
+	job, err := db.ModifyJob(dbInstance, jobID, func(job *types.Job) error {
+		closed = closeStage(job, finishedAt)
+		job.Status = status
+		if status == types.JobFinished {
+			job.SetProgress(types.CompletedProgress(types.StageUpload))
+		}
+		if details != "" {
+			job.Details = details
+		}
+		job.FinishedAt = &finishedAt
+		if job.StartedAt != nil {
+			job.Duration = finishedAt.Sub(*job.StartedAt).Seconds()
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error("updating job failed", err)
+		return
+	}
+	observeStage(closed)
+	events.PublishJob(events.JobStatusChanged, job)
+}
+
+// startStage records the start of a stage, closing the
+// previous one
+func startStage(dbInstance db.Storage, jobID string, stage types.JobStage) error {
+	startedAt := now()
+	var closed *types.StageTiming
+	job, err := db.ModifyJob(dbInstance, jobID, func(job *types.Job) error {
+		closed = closeStage(job, startedAt)
+		job.Stages = append(job.Stages, types.StageTiming{Stage: stage, StartedAt: startedAt})
+		job.SetProgress(types.NewProgress(stage, 0, 0, "", 0))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	observeStage(closed)
+	events.PublishJob(events.JobProgressChanged, job)
+	return nil
+}
+
+// closeStage finishes the stage running now, returning a copy
+// of its timing if there was one
+func closeStage(job *types.Job, finishedAt time.Time) *types.StageTiming {
+	stage := job.CurrentStage()
+	if stage == nil {
+		return nil
+	}
+	stage.FinishedAt = &finishedAt
+	stage.Duration = finishedAt.Sub(stage.StartedAt).Seconds()
+	closed := *stage
+	return &closed
+}
+
+func observeStage(stage *types.StageTiming) {
+	if stage != nil {
+		metrics.StageDuration.WithLabelValues(string(stage.Stage)).Observe(stage.Duration)
+	}
+}
+
+// now returns the current time with the millisecond precision
+// kept by the storage drivers
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
 }
 
 // CleanSwap removes LocalSource and LocalDestination
@@ -89,9 +296,77 @@ func CleanSwap(dbInstance db.Storage, jobID string) error {
 	return err
 }
 
+// followJob publishes the changes the workers make to the job
+// until it's done, as their events don't reach this process
+func followJob(log lager.Logger, dbInstance db.Storage, job types.Job) {
+	for job.Status != types.JobFinished && job.Status != types.JobError && job.Status != types.JobCanceled {
+		time.Sleep(Queue.workerPollInterval())
+		current, err := dbInstance.RetrieveJob(job.ID)
+		if err != nil {
+			log.Error("following-job-failed", err)
+			return
+		}
+		if current.Status != job.Status {
+			events.PublishJob(events.JobStatusChanged, current)
+		} else if current.Progress != job.Progress {
+			events.PublishJob(events.JobProgressChanged, current)
+		}
+		job = current
+	}
+}
+
+// ErrNotCancelable is returned when canceling a job that already
+// started running or is done
+var ErrNotCancelable = errors.New("only jobs that didn't start running can be canceled")
+
+// CancelJob cancels a job that is waiting to start
+func CancelJob(dbInstance db.Storage, jobID string) (types.Job, error) {
+	job, err := db.ModifyJob(dbInstance, jobID, func(job *types.Job) error {
+		switch job.Status {
+		case types.JobCreated, types.JobScheduled, types.JobQueued:
+		default:
+			return ErrNotCancelable
+		}
+		if job.Lease != nil {
+			return ErrNotCancelable
+		}
+		finishedAt := now()
+		job.Status = types.JobCanceled
+		job.FinishedAt = &finishedAt
+		return nil
+	})
+	if err != nil {
+		return job, err
+	}
+	events.PublishJob(events.JobStatusChanged, job)
+	return job, nil
+}
+
+// ErrNotStartable is returned when starting a job that was already
+// started, or is done, and when setting up a job no longer queued
+var ErrNotStartable = errors.New("only created or scheduled jobs can be started")
+
+// QueueJob marks a created or scheduled job as waiting for the
+// scheduler, failing with ErrNotStartable for the other jobs
+func QueueJob(dbInstance db.Storage, jobID string) (types.Job, error) {
+	job, err := db.ModifyJob(dbInstance, jobID, func(job *types.Job) error {
+		if job.Status != types.JobCreated && job.Status != types.JobScheduled {
+			return ErrNotStartable
+		}
+		job.Status = types.JobQueued
+		return nil
+	})
+	if err != nil {
+		return job, err
+	}
+	events.PublishJob(events.JobStatusChanged, job)
+	return job, nil
+}
+
 // SetupJob is responsible for set the initial state for a given
 // job before starting. It sets local source and destination
-// paths and the final destination as well.
+// paths and the final destination as well. Jobs no longer queued,
+// such as the ones canceled meanwhile, fail with ErrNotStartable.
 func SetupJob(jobID string, dbInstance db.Storage, config gonfig.Gonfig) (*types.Job, error) {
 	job, err := dbInstance.RetrieveJob(jobID)
 	if err != nil {
@@ -102,9 +377,7 @@ func SetupJob(jobID string, dbInstance db.Storage, config gonfig.Gonfig) (*types
 	if err != nil {
 		return nil, err
 	}
-	job.LocalSource = localSource + path.Base(job.Source)
-
-	job.LocalDestination, err = helpers.GetLocalDestination(config, dbInstance, jobID)
+	localDestination, err := helpers.GetLocalDestination(config, dbInstance, jobID)
 	if err != nil {
 		return nil, err
 	}
@@ -118,14 +391,28 @@ func SetupJob(jobID string, dbInstance db.Storage, config gonfig.Gonfig) (*types
 		return nil, err
 	}
 	u.Path = path.Join(u.Path, outputFilename)
-	job.Destination = u.String()
 
-	job.Status = types.JobDownloading
-	job.Progress = "0%"
-	job, err = dbInstance.UpdateJob(job.ID, job)
+	startedAt := now()
+	job, err = db.ModifyJob(dbInstance, jobID, func(job *types.Job) error {
+		// the job may have been canceled since it was picked
+		if job.Status != types.JobQueued {
+			return ErrNotStartable
+		}
+		job.LocalSource = localSource + path.Base(job.Source)
+		job.LocalDestination = localDestination
+		job.Destination = u.String()
+		job.Status = types.JobDownloading
+		job.SetProgress(types.Progress{})
+		job.StartedAt = &startedAt
+		job.FinishedAt = nil
+		job.Duration = 0
+		job.Stages = nil
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	events.PublishJob(events.JobStatusChanged, job)
 
 	return &job, nil
 }
@@ -4,6 +4,7 @@ import (
 	"io"
 	"os"
 	"reflect"
+	"time"
 
 	"code.cloudfoundry.org/lager/lagertest"
 	"github.com/flavioribeiro/gonfig"
@@ -44,6 +45,32 @@ var _ = Describe("Pipeline", func() {
 		dbInstance.ClearDatabase()
 	})
 
+	Context("CreateJob function", func() {
+		It("should store a job with the given preset", func() {
+			dbInstance.StorePreset(types.Preset{Name: "240p", Container: "mp4"})
+			job, err := CreateJob(dbInstance, types.JobInput{
+				Source:      "http://flv.io/source_here.mp4",
+				Destination: "s3://user@pass:/bucket/",
+				PresetName:  "240p",
+				Priority:    5,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(job.ID).NotTo(BeEmpty())
+			Expect(job.Priority).To(Equal(5))
+			Expect(job.Status).To(Equal(types.JobCreated))
+			Expect(job.CreatedAt).To(BeTemporally("~", time.Now(), time.Second))
+
+			storedJob, err := dbInstance.RetrieveJob(job.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(storedJob.Preset.Name).To(Equal("240p"))
+		})
+
+		It("should return an error if the preset doesn't exist", func() {
+			_, err := CreateJob(dbInstance, types.JobInput{PresetName: "invalid-preset"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
 	Context("SetupJob function", func() {
 		It("Should set the local source and local destination on Job", func() {
 			exampleJob := types.Job{
@@ -51,7 +78,7 @@ var _ = Describe("Pipeline", func() {
 				Source:      "http://flv.io/source_here.mp4",
 				Destination: "s3://user@pass:/bucket/",
 				Preset:      types.Preset{Name: "240p", Container: "mp4"},
-				Status:      types.JobCreated,
+				Status:      types.JobQueued,
 				Details:     "",
 			}
 
@@ -69,6 +96,31 @@ var _ = Describe("Pipeline", func() {
 		})
 	})
 
+	Context("when a job is canceled after the scheduler picked it", func() {
+		BeforeEach(func() {
+			dbInstance.StoreJob(types.Job{ID: "123", Source: "http://flv.io/source_here.mp4", Status: types.JobQueued})
+			_, err := CancelJob(dbInstance, "123")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should not set it up", func() {
+			_, err := SetupJob("123", dbInstance, cfg)
+			Expect(err).To(Equal(ErrNotStartable))
+
+			job, _ := dbInstance.RetrieveJob("123")
+			Expect(job.Status).To(Equal(types.JobCanceled))
+			Expect(job.StartedAt).To(BeNil())
+		})
+
+		It("should not run it", func() {
+			StartQueuedJob(lagertest.NewTestLogger("start"), cfg, dbInstance, types.Job{ID: "123", Status: types.JobQueued})
+
+			job, _ := dbInstance.RetrieveJob("123")
+			Expect(job.Status).To(Equal(types.JobCanceled))
+			Expect(job.Stages).To(BeEmpty())
+		})
+	})
+
 	Context("Pipeline", func() {
 		It("Should get the HTTPDownload function if source is HTTP", func() {
 			jobSource := "http://flv.io/KailuaBeach.mp4"
@@ -124,6 +176,7 @@ var _ = Describe("Pipeline", func() {
 		It("should set error message to Details if errors occur", func() {
 			exampleJob := types.Job{
 				ID:      "123",
+				Status:  types.JobCreated,
 				Source:  "http://source.here.mp4",
 				Details: "",
 			}
@@ -135,5 +188,92 @@ var _ = Describe("Pipeline", func() {
 			changedJob, _ := dbInstance.RetrieveJob("123")
 			Expect(changedJob.Details).To(ContainSubstring("no such host"))
 		})
+
+		It("should not start a job whose source upload is not complete", func() {
+			exampleJob := types.Job{
+				ID:          "123",
+				Status:      types.JobCreated,
+				Source:      "upload://source_here.mp4",
+				Destination: "s3://user@pass:/bucket/",
+				Preset:      types.Preset{Name: "240p", Container: "mp4"},
+				Upload:      &types.SourceUpload{Filename: "source_here.mp4", Length: 10, Offset: 4},
+			}
+
+			dbInstance.StoreJob(exampleJob)
+			logger := lagertest.NewTestLogger("StartJob")
+			StartJob(logger, cfg, dbInstance, exampleJob)
+
+			changedJob, _ := dbInstance.RetrieveJob("123")
+			Expect(changedJob.Status).To(Equal(types.JobError))
+			Expect(changedJob.Details).To(Equal("source upload is not complete"))
+			Expect(changedJob.StartedAt).NotTo(BeNil())
+			Expect(changedJob.FinishedAt).NotTo(BeNil())
+			Expect(*changedJob.FinishedAt).To(BeTemporally(">=", *changedJob.StartedAt))
+		})
+	})
+
+	Context("stage timing", func() {
+		BeforeEach(func() {
+			startedAt := time.Now().Add(-time.Minute)
+			dbInstance.StoreJob(types.Job{ID: "123", StartedAt: &startedAt, Outputs: []types.OutputFile{{Path: "/out.mp4"}}})
+		})
+
+		It("should close the previous stage when a new one starts", func() {
+			Expect(startStage(dbInstance, "123", types.StageDownload)).To(Succeed())
+			Expect(startStage(dbInstance, "123", types.StageEncode)).To(Succeed())
+
+			job, _ := dbInstance.RetrieveJob("123")
+			Expect(job.Stages).To(HaveLen(2))
+			Expect(job.Stages[0].Stage).To(Equal(types.StageDownload))
+			Expect(job.Stages[0].FinishedAt).NotTo(BeNil())
+			Expect(job.Stages[1].Stage).To(Equal(types.StageEncode))
+			Expect(job.CurrentStage().Stage).To(Equal(types.StageEncode))
+		})
+
+		It("should record the job duration and keep what the stages stored", func() {
+			startStage(dbInstance, "123", types.StageUpload)
+			finishJob(lagertest.NewTestLogger("finish-job"), dbInstance, "123", types.JobFinished, "")
+
+			job, _ := dbInstance.RetrieveJob("123")
+			Expect(job.Status).To(Equal(types.JobFinished))
+			Expect(job.CurrentStage()).To(BeNil())
+			Expect(job.Duration).To(BeNumerically("~", 60, 1))
+			Expect(job.Outputs).To(HaveLen(1))
+			Expect(job.Progress.Percent).To(Equal(float64(100)))
+			Expect(job.ProgressText).To(Equal("100.00%"))
+		})
+
+		It("should estimate the time remaining from the stage progress", func() {
+			startStage(dbInstance, "123", types.StageEncode)
+			job, _ := dbInstance.RetrieveJob("123")
+			job.SetProgress(types.NewProgress(types.StageEncode, 25, 100, types.ProgressFrames, 0))
+
+			remaining, ok := job.EstimateTimeRemaining(job.Stages[0].StartedAt.Add(time.Minute))
+			Expect(ok).To(BeTrue())
+			Expect(remaining).To(Equal(3 * time.Minute))
+
+			job.SetProgress(types.NewProgress(types.StageEncode, 0, 100, types.ProgressFrames, 0))
+			_, ok = job.EstimateTimeRemaining(time.Now())
+			Expect(ok).To(BeFalse())
+
+			job.SetProgress(types.NewProgress(types.StageEncode, 40, 100, types.ProgressFrames, 20))
+			remaining, ok = job.EstimateTimeRemaining(time.Now())
+			Expect(ok).To(BeTrue())
+			Expect(remaining).To(Equal(3 * time.Second))
+		})
+
+		It("should keep the overall progress of the stages already done", func() {
+			startStage(dbInstance, "123", types.StageDownload)
+			startStage(dbInstance, "123", types.StageEncode)
+
+			job, _ := dbInstance.RetrieveJob("123")
+			Expect(job.Progress.Stage).To(Equal(types.StageEncode))
+			Expect(job.Progress.StagePercent).To(Equal(float64(0)))
+			Expect(job.Progress.Percent).To(Equal(float64(10)))
+			Expect(job.ProgressText).To(Equal("10.00%"))
+
+			job.SetProgress(types.NewProgress(types.StageEncode, 50, 100, types.ProgressFrames, 0))
+			Expect(job.Progress.Percent).To(Equal(float64(50)))
+		})
 	})
 })
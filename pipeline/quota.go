@@ -0,0 +1,155 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/flavioribeiro/gonfig"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/helpers"
+	"github.com/snickers/snickers/types"
+)
+
+// QuotaExceededError is returned when a tenant goes over its quota
+type QuotaExceededError string
+
+func (e QuotaExceededError) Error() string {
+	return "quota exceeded: " + string(e)
+}
+
+// startedStatuses are the statuses of the jobs taking a running slot
+var startedStatuses = []types.JobStatus{types.JobQueued, types.JobDownloading, types.JobEncoding, types.JobUploading}
+
+// TenantQuota returns the quota of a tenant on TENANT_QUOTAS, whose
+// "*" entry applies to the tenants without one of their own
+func TenantQuota(config gonfig.Gonfig, tenant string) (types.Quota, error) {
+	quotas := map[string]types.Quota{}
+	if err := config.GetAs("TENANT_QUOTAS", &quotas); err != nil {
+		return types.Quota{}, err
+	}
+	if quota, ok := quotas[tenant]; ok {
+		return quota, nil
+	}
+	return quotas["*"], nil
+}
+
+// CheckRunningQuota fails if the tenant already has as many jobs
+// running, queued or due to start as its quota allows. The job being
+// started, if any, is left out of the count.
+func CheckRunningQuota(config gonfig.Gonfig, dbInstance db.Storage, tenant string, jobID string) error {
+	statuses := append([]types.JobStatus{types.JobScheduled}, startedStatuses...)
+	return checkRunningQuota(config, dbInstance, tenant, jobID, statuses)
+}
+
+// CheckStorageQuota fails if the files the tenant keeps on the swap
+// directory, plus the incoming bytes, go over its quota
+func CheckStorageQuota(config gonfig.Gonfig, dbInstance db.Storage, tenant string, incoming int64) error {
+	quota, err := TenantQuota(config, tenant)
+	if err != nil || quota.MaxStorageBytes <= 0 {
+		return err
+	}
+
+	used, err := storageUsage(config, dbInstance, tenant)
+	if err != nil {
+		return err
+	}
+	if used+incoming > quota.MaxStorageBytes || used >= quota.MaxStorageBytes {
+		return QuotaExceededError(fmt.Sprintf("%d bytes used of %d", used, quota.MaxStorageBytes))
+	}
+	return nil
+}
+
+// checkScheduledQuota fails if a due job would take the tenant over
+// its quota. The other due jobs wait for the same slots, so only the
+// started ones are counted.
+func checkScheduledQuota(config gonfig.Gonfig, dbInstance db.Storage, job types.Job) error {
+	if err := checkRunningQuota(config, dbInstance, job.Owner, job.ID, startedStatuses); err != nil {
+		return err
+	}
+	return CheckStorageQuota(config, dbInstance, job.Owner, 0)
+}
+
+func checkRunningQuota(config gonfig.Gonfig, dbInstance db.Storage, tenant string, jobID string, statuses []types.JobStatus) error {
+	quota, err := TenantQuota(config, tenant)
+	if err != nil || quota.MaxRunningJobs <= 0 {
+		return err
+	}
+
+	running, err := countRunningJobs(dbInstance, tenant, jobID, statuses, quota.MaxRunningJobs)
+	if err != nil {
+		return err
+	}
+	if running >= quota.MaxRunningJobs {
+		return QuotaExceededError(fmt.Sprintf("%d jobs running of %d", running, quota.MaxRunningJobs))
+	}
+	return nil
+}
+
+// countRunningJobs counts, up to max, the jobs of the tenant on the
+// given statuses, taking only the scheduled ones whose start is due
+func countRunningJobs(dbInstance db.Storage, tenant string, except string, statuses []types.JobStatus, max int) (int, error) {
+	at := now()
+	running := 0
+	for _, status := range statuses {
+		query := types.JobQuery{Owner: tenant, Status: status, Sort: types.SortByID, Limit: db.MaxJobsLimit}
+		for running < max {
+			page, err := dbInstance.QueryJobs(query)
+			if err != nil {
+				return 0, err
+			}
+			for _, job := range page.Jobs {
+				if job.ID != except && (status != types.JobScheduled || job.StartDue(at)) {
+					running++
+				}
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			query.Cursor = page.NextCursor
+		}
+	}
+	return running, nil
+}
+
+// storageUsage adds up the swap directories and local outputs
+// of every job of the tenant
+func storageUsage(config gonfig.Gonfig, dbInstance db.Storage, tenant string) (int64, error) {
+	outputDir, err := helpers.GetLocalOutputDirectory(config)
+	if err != nil {
+		return 0, err
+	}
+
+	var used int64
+	query := types.JobQuery{Owner: tenant, Sort: types.SortByID, Limit: db.MaxJobsLimit}
+	for {
+		page, err := dbInstance.QueryJobs(query)
+		if err != nil {
+			return 0, err
+		}
+		for _, job := range page.Jobs {
+			swapDir, err := helpers.GetJobSwapDirectory(config, job.ID)
+			if err != nil {
+				return 0, err
+			}
+			used += directorySize(swapDir) + directorySize(filepath.Join(outputDir, job.ID))
+		}
+		if page.NextCursor == "" {
+			return used, nil
+		}
+		query.Cursor = page.NextCursor
+	}
+}
+
+// directorySize adds up the files under a directory, which is
+// empty if it doesn't exist
+func directorySize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,134 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/flavioribeiro/gonfig"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/helpers"
+	"github.com/snickers/snickers/types"
+)
+
+// runningStatuses are the statuses of jobs that are going
+// through the pipeline
+var runningStatuses = []types.JobStatus{types.JobDownloading, types.JobEncoding, types.JobUploading}
+
+// RecoverJobs picks up the jobs left running by a previous process.
+// Each one resumes from the last stage whose artifacts are still on
+// the swap directory, or fails if its source is gone for good. Jobs
+// left queued go back to the scheduler. With distributed workers,
+// the workers take over the jobs of the workers that died instead.
+func RecoverJobs(logger lager.Logger, config gonfig.Gonfig, dbInstance db.Storage) error {
+	log := logger.Session("recover-jobs")
+	log.Info("started")
+	defer log.Info("finished")
+
+	if Queue.Remote() {
+		log.Info("left-for-workers")
+		return nil
+	}
+
+	jobs, err := findRunningJobs(dbInstance)
+	if err != nil {
+		log.Error("finding-running-jobs-failed", err)
+		return err
+	}
+
+	for _, job := range jobs {
+		jobLog := log.Session("recover-job", lager.Data{"id": job.ID, "status": job.Status})
+
+		stage, recovered, err := prepareRecovery(config, dbInstance, job)
+		if err != nil {
+			jobLog.Error("failed", err)
+			failJob(jobLog, dbInstance, job.ID, err)
+			continue
+		}
+
+		if err := Jobs.Acquire(job.ID); err != nil {
+			return err
+		}
+		jobLog.Info("resuming", lager.Data{"stage": stage})
+		release := Queue.Take(recovered)
+		go func(job types.Job, stage types.JobStage) {
+			defer release()
+			defer Jobs.Release(job.ID)
+			runJob(jobLog, logger, config, dbInstance, job, stage, nil)
+		}(recovered, stage)
+	}
+
+	queued, err := findJobs(dbInstance, types.JobQueued)
+	if err != nil {
+		log.Error("finding-queued-jobs-failed", err)
+		return err
+	}
+	for _, job := range queued {
+		log.Info("requeuing", lager.Data{"id": job.ID, "priority": job.Priority})
+		go StartQueuedJob(logger, config, dbInstance, job)
+	}
+	return nil
+}
+
+// findRunningJobs lists every job on a running status
+func findRunningJobs(dbInstance db.Storage) ([]types.Job, error) {
+	return findJobs(dbInstance, runningStatuses...)
+}
+
+// findJobs lists every job on the given statuses
+func findJobs(dbInstance db.Storage, statuses ...types.JobStatus) ([]types.Job, error) {
+	jobs := []types.Job{}
+	for _, status := range statuses {
+		query := types.JobQuery{Owner: types.AnyOwner, Status: status, Sort: types.SortByCreatedAt, Limit: db.MaxJobsLimit}
+		for {
+			page, err := dbInstance.QueryJobs(query)
+			if err != nil {
+				return nil, err
+			}
+			jobs = append(jobs, page.Jobs...)
+			if page.NextCursor == "" {
+				break
+			}
+			query.Cursor = page.NextCursor
+		}
+	}
+	return jobs, nil
+}
+
+// prepareRecovery finds the stage a job resumes from and restores
+// the local paths set up when it started, which stages like the
+// HLS encoding change while they run
+func prepareRecovery(config gonfig.Gonfig, dbInstance db.Storage, job types.Job) (types.JobStage, types.Job, error) {
+	sourceDir, err := helpers.GetLocalSourcePath(config, job.ID)
+	if err != nil {
+		return "", job, err
+	}
+	localSource := sourceDir + path.Base(job.Source)
+	localDestination, err := helpers.GetLocalDestination(config, dbInstance, job.ID)
+	if err != nil {
+		return "", job, err
+	}
+
+	stage := types.StageDownload
+	switch {
+	case job.Status == types.JobUploading && exists(localDestination):
+		stage = types.StageUpload
+	case job.Status != types.JobDownloading && exists(localSource):
+		stage = types.StageEncode
+	case job.Upload != nil && !exists(localSource):
+		return "", job, fmt.Errorf("interrupted while %s and the uploaded source is gone", job.Status)
+	}
+
+	job, err = db.ModifyJob(dbInstance, job.ID, func(job *types.Job) error {
+		job.LocalSource = localSource
+		job.LocalDestination = localDestination
+		return nil
+	})
+	return stage, job, err
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
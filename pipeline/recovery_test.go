@@ -0,0 +1,101 @@
+package pipeline
+
+import (
+	"io/ioutil"
+	"os"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/flavioribeiro/gonfig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/types"
+)
+
+var _ = Describe("Recovery", func() {
+	var (
+		cfg        gonfig.Gonfig
+		dbInstance db.Storage
+		job        types.Job
+	)
+
+	const (
+		localSource      = "/tmp/recover-123/src/source_here.mp4"
+		localDestination = "/tmp/recover-123/dst/source_here_240p.mp4"
+	)
+
+	BeforeEach(func() {
+		currentDir, _ := os.Getwd()
+		cfg, _ = gonfig.FromJsonFile(currentDir + "/../fixtures/config.json")
+		dbInstance, _ = db.GetDatabase(cfg)
+		dbInstance.ClearDatabase()
+
+		job = types.Job{
+			ID:               "recover-123",
+			Source:           "http://source.here/source_here.mp4",
+			Destination:      "s3://user@pass:/bucket/source_here_240p.mp4",
+			Preset:           types.Preset{Name: "240p", Container: "mp4"},
+			Status:           types.JobEncoding,
+			LocalSource:      "/tmp/h264.mp4",
+			LocalDestination: "/tmp/elsewhere.mp4",
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll("/tmp/recover-123")
+	})
+
+	It("should find the jobs on every running status", func() {
+		for i, status := range []types.JobStatus{types.JobCreated, types.JobDownloading, types.JobEncoding, types.JobUploading, types.JobFinished} {
+			dbInstance.StoreJob(types.Job{ID: string('a' + rune(i)), Status: status})
+		}
+
+		jobs, err := findRunningJobs(dbInstance)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(jobs).To(HaveLen(3))
+	})
+
+	It("should resume uploading jobs whose output is still there", func() {
+		job.Status = types.JobUploading
+		dbInstance.StoreJob(job)
+		os.MkdirAll("/tmp/recover-123/dst", 0700)
+		ioutil.WriteFile(localDestination, []byte("output"), 0600)
+
+		stage, recovered, err := prepareRecovery(cfg, dbInstance, job)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stage).To(Equal(types.StageUpload))
+		Expect(recovered.LocalSource).To(Equal(localSource))
+		Expect(recovered.LocalDestination).To(Equal(localDestination))
+	})
+
+	It("should encode again when only the source is there", func() {
+		job.Status = types.JobUploading
+		dbInstance.StoreJob(job)
+		os.MkdirAll("/tmp/recover-123/src", 0700)
+		ioutil.WriteFile(localSource, []byte("source"), 0600)
+
+		stage, _, err := prepareRecovery(cfg, dbInstance, job)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stage).To(Equal(types.StageEncode))
+	})
+
+	It("should download again when the source is gone", func() {
+		dbInstance.StoreJob(job)
+
+		stage, _, err := prepareRecovery(cfg, dbInstance, job)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stage).To(Equal(types.StageDownload))
+	})
+
+	It("should fail jobs whose uploaded source is gone", func() {
+		job.Source = "upload://source_here.mp4"
+		job.Upload = &types.SourceUpload{Filename: "source_here.mp4", Length: 6, Offset: 6, Complete: true}
+		dbInstance.StoreJob(job)
+
+		Expect(RecoverJobs(lagertest.NewTestLogger("recover"), cfg, dbInstance)).To(Succeed())
+
+		failed, _ := dbInstance.RetrieveJob(job.ID)
+		Expect(failed.Status).To(Equal(types.JobError))
+		Expect(failed.Details).To(Equal("interrupted while encoding and the uploaded source is gone"))
+	})
+})
@@ -0,0 +1,244 @@
+package pipeline
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/flavioribeiro/gonfig"
+	"github.com/snickers/snickers/metrics"
+	"github.com/snickers/snickers/types"
+)
+
+// Scheduler decides which of the queued jobs runs next. Jobs go by
+// their priority plus the aging rate for every minute they waited,
+// so low priority jobs don't starve. With fair-share weights, the next
+// job comes from the owner running the fewest jobs for its weight.
+type Scheduler struct {
+	mtx        sync.Mutex
+	maxRunning int
+	agingRate  float64
+	weights    map[string]float64
+	queue      []*queuedJob
+	running    map[string]int
+	total      int
+	seq        uint64
+	now        func() time.Time
+
+	// remote hands the jobs over to the workers instead of running
+	// them, checking on them every pollInterval
+	remote       bool
+	pollInterval time.Duration
+}
+
+// queuedJob is a job waiting on the scheduler
+type queuedJob struct {
+	job      types.Job
+	queuedAt time.Time
+	seq      uint64
+	picked   chan struct{}
+}
+
+// Queue schedules the jobs started by StartJob
+var Queue = NewScheduler(runtime.NumCPU(), 1, nil)
+
+// NewScheduler returns a scheduler running up to maxRunning jobs at
+// once, or any number of them when it's zero
+func NewScheduler(maxRunning int, agingRate float64, weights map[string]float64) *Scheduler {
+	return &Scheduler{
+		maxRunning:   maxRunning,
+		agingRate:    agingRate,
+		weights:      weights,
+		running:      map[string]int{},
+		now:          time.Now,
+		pollInterval: 5 * time.Second,
+	}
+}
+
+// ConfigureScheduler sets up Queue from MAX_CONCURRENT_JOBS,
+// PRIORITY_AGING_PER_MINUTE and FAIR_SHARE_WEIGHTS. The weights are
+// keyed by owner, "*" being the weight of the owners not listed.
+// With DISTRIBUTED_WORKERS, jobs are left for the workers and
+// checked on every WORKER_POLL_INTERVAL seconds.
+func ConfigureScheduler(config gonfig.Gonfig) error {
+	maxRunning, err := config.GetInt("MAX_CONCURRENT_JOBS", runtime.NumCPU())
+	if err != nil {
+		return err
+	}
+	agingRate, err := config.GetFloat("PRIORITY_AGING_PER_MINUTE", 1)
+	if err != nil {
+		return err
+	}
+	weights := map[string]float64{}
+	if err := config.GetAs("FAIR_SHARE_WEIGHTS", &weights); err != nil {
+		return err
+	}
+	remote, err := config.GetBool("DISTRIBUTED_WORKERS", false)
+	if err != nil {
+		return err
+	}
+	pollInterval, err := config.GetInt("WORKER_POLL_INTERVAL", 5)
+	if err != nil {
+		return err
+	}
+
+	Queue.mtx.Lock()
+	defer Queue.mtx.Unlock()
+	Queue.maxRunning = maxRunning
+	Queue.agingRate = agingRate
+	Queue.weights = weights
+	Queue.remote = remote
+	Queue.pollInterval = time.Duration(pollInterval) * time.Second
+	Queue.dispatch()
+	return nil
+}
+
+// Remote tells whether the jobs are run by workers
+func (s *Scheduler) Remote() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.remote
+}
+
+// workerPollInterval is how often the workers look for jobs
+func (s *Scheduler) workerPollInterval() time.Duration {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.pollInterval
+}
+
+// Wait queues the job and blocks until it's picked to run. The
+// returned func frees its slot once the job is done.
+func (s *Scheduler) Wait(job types.Job) func() {
+	s.mtx.Lock()
+	s.seq++
+	entry := &queuedJob{job: job, queuedAt: s.now(), seq: s.seq, picked: make(chan struct{})}
+	s.queue = append(s.queue, entry)
+	s.dispatch()
+	s.mtx.Unlock()
+
+	<-entry.picked
+	return s.releaseFunc(job.Owner)
+}
+
+// Take counts the job as running without queueing it, for the jobs
+// resumed by RecoverJobs. The returned func frees its slot.
+func (s *Scheduler) Take(job types.Job) func() {
+	s.mtx.Lock()
+	s.running[job.Owner]++
+	s.total++
+	s.mtx.Unlock()
+	return s.releaseFunc(job.Owner)
+}
+
+// Queued returns how many jobs are waiting to run
+func (s *Scheduler) Queued() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return len(s.queue)
+}
+
+func (s *Scheduler) releaseFunc(owner string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mtx.Lock()
+			defer s.mtx.Unlock()
+			s.running[owner]--
+			if s.running[owner] <= 0 {
+				delete(s.running, owner)
+			}
+			s.total--
+			s.dispatch()
+		})
+	}
+}
+
+// Order sorts the jobs queued on the database the way the scheduler
+// picks them, for the workers. They are aged since they were created
+// and shared among owners by the jobs the workers are running.
+func (s *Scheduler) Order(queued []types.Job, running []types.Job) []types.Job {
+	s.mtx.Lock()
+	agingRate, weights := s.agingRate, s.weights
+	s.mtx.Unlock()
+
+	ordering := NewScheduler(0, agingRate, weights)
+	for _, job := range running {
+		ordering.running[job.Owner]++
+	}
+	entries := make([]*queuedJob, len(queued))
+	for i, job := range queued {
+		entries[i] = &queuedJob{job: job, queuedAt: job.CreatedAt, seq: uint64(i)}
+	}
+	now := s.now()
+	sort.Slice(entries, func(i, j int) bool {
+		return ordering.before(entries[i], entries[j], now)
+	})
+
+	jobs := make([]types.Job, len(entries))
+	for i, entry := range entries {
+		jobs[i] = entry.job
+	}
+	return jobs
+}
+
+// dispatch picks queued jobs while there are free slots. It must be
+// called with the lock held.
+func (s *Scheduler) dispatch() {
+	for len(s.queue) > 0 && (s.maxRunning <= 0 || s.total < s.maxRunning) {
+		i := s.next()
+		entry := s.queue[i]
+		s.queue = append(s.queue[:i], s.queue[i+1:]...)
+		s.running[entry.job.Owner]++
+		s.total++
+		close(entry.picked)
+	}
+	metrics.QueueDepth.Set(float64(len(s.queue)))
+}
+
+// next returns the index of the queued job to run next
+func (s *Scheduler) next() int {
+	now := s.now()
+	best := 0
+	for i := 1; i < len(s.queue); i++ {
+		if s.before(s.queue[i], s.queue[best], now) {
+			best = i
+		}
+	}
+	return best
+}
+
+// before tells whether a runs before b. Under fair share the owner
+// with the lowest share goes first, then the highest effective
+// priority and then the oldest job.
+func (s *Scheduler) before(a, b *queuedJob, now time.Time) bool {
+	if len(s.weights) > 0 && a.job.Owner != b.job.Owner {
+		shareA, shareB := s.share(a.job.Owner), s.share(b.job.Owner)
+		if shareA != shareB {
+			return shareA < shareB
+		}
+	}
+	priorityA, priorityB := s.priority(a, now), s.priority(b, now)
+	if priorityA != priorityB {
+		return priorityA > priorityB
+	}
+	return a.seq < b.seq
+}
+
+// priority is the priority of a queued job after aging
+func (s *Scheduler) priority(entry *queuedJob, now time.Time) float64 {
+	return float64(entry.job.Priority) + s.agingRate*now.Sub(entry.queuedAt).Minutes()
+}
+
+// share is how many jobs the owner runs for its weight
+func (s *Scheduler) share(owner string) float64 {
+	weight := s.weights[owner]
+	if weight <= 0 {
+		weight = s.weights["*"]
+	}
+	if weight <= 0 {
+		weight = 1
+	}
+	return float64(s.running[owner]) / weight
+}
@@ -0,0 +1,119 @@
+package pipeline
+
+import (
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/flavioribeiro/gonfig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/snickers/snickers/types"
+)
+
+var _ = Describe("Scheduler", func() {
+	var (
+		scheduler *Scheduler
+		clock     time.Time
+		picked    chan string
+		releases  map[string]func()
+	)
+
+	queue := func(id string, owner string, priority int) {
+		job := types.Job{ID: id, Owner: owner, Priority: priority}
+		queued := scheduler.Queued()
+		go func() {
+			release := scheduler.Wait(job)
+			scheduler.mtx.Lock()
+			releases[id] = release
+			scheduler.mtx.Unlock()
+			picked <- id
+		}()
+		Eventually(scheduler.Queued).Should(Equal(queued + 1))
+	}
+
+	release := func(id string) {
+		scheduler.mtx.Lock()
+		release := releases[id]
+		scheduler.mtx.Unlock()
+		release()
+	}
+
+	BeforeEach(func() {
+		clock = time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+		scheduler = NewScheduler(1, 1, nil)
+		scheduler.now = func() time.Time { return clock }
+		picked = make(chan string, 10)
+		releases = map[string]func(){}
+	})
+
+	It("should run jobs right away while there are free slots", func() {
+		scheduler.maxRunning = 2
+		scheduler.Wait(types.Job{ID: "a"})
+		release := scheduler.Wait(types.Job{ID: "b"})
+		Expect(scheduler.Queued()).To(Equal(0))
+
+		queue("c", "", 0)
+		release()
+		Eventually(picked).Should(Receive(Equal("c")))
+	})
+
+	It("should pick the highest priority job first", func() {
+		busy := scheduler.Take(types.Job{ID: "busy"})
+		queue("low", "", 1)
+		queue("high", "", 10)
+		queue("mid", "", 5)
+
+		busy()
+		Eventually(picked).Should(Receive(Equal("high")))
+		release("high")
+		Eventually(picked).Should(Receive(Equal("mid")))
+		release("mid")
+		Eventually(picked).Should(Receive(Equal("low")))
+	})
+
+	It("should keep the arrival order among jobs of the same priority", func() {
+		busy := scheduler.Take(types.Job{ID: "busy"})
+		queue("first", "", 0)
+		queue("second", "", 0)
+
+		busy()
+		Eventually(picked).Should(Receive(Equal("first")))
+	})
+
+	It("should age the jobs waiting in the queue", func() {
+		busy := scheduler.Take(types.Job{ID: "busy"})
+		queue("old", "", 0)
+		clock = clock.Add(10 * time.Minute)
+		queue("new", "", 5)
+
+		busy()
+		Eventually(picked).Should(Receive(Equal("old")))
+	})
+
+	It("should share the slots between owners by their weights", func() {
+		scheduler.maxRunning = 3
+		scheduler.weights = map[string]float64{"news": 2, "*": 1}
+		scheduler.Take(types.Job{ID: "news-1", Owner: "news"})
+		busy := scheduler.Take(types.Job{ID: "archive-1", Owner: "archive"})
+		scheduler.Take(types.Job{ID: "archive-2", Owner: "archive"})
+		queue("archive-3", "archive", 10)
+		queue("news-2", "news", 0)
+
+		busy()
+		Eventually(picked).Should(Receive(Equal("news-2")))
+	})
+
+	It("should configure the queue from the config", func() {
+		cfg, _ := gonfig.FromJson(strings.NewReader(`{"MAX_CONCURRENT_JOBS": 3, "PRIORITY_AGING_PER_MINUTE": 0.5, "FAIR_SHARE_WEIGHTS": {"news": 2}}`))
+		Expect(ConfigureScheduler(cfg)).To(Succeed())
+		Expect(Queue.maxRunning).To(Equal(3))
+		Expect(Queue.agingRate).To(Equal(0.5))
+		Expect(Queue.weights).To(Equal(map[string]float64{"news": 2}))
+
+		defaults, _ := gonfig.FromJson(strings.NewReader(`{}`))
+		Expect(ConfigureScheduler(defaults)).To(Succeed())
+		Expect(Queue.maxRunning).To(Equal(runtime.NumCPU()))
+		Expect(Queue.weights).To(BeEmpty())
+	})
+})
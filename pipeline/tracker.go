@@ -0,0 +1,97 @@
+package pipeline
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrDraining is returned when jobs are started while Snickers
+// is shutting down
+var ErrDraining = errors.New("snickers is shutting down")
+
+// JobTracker keeps the jobs running on this process so that
+// shutting down can wait for them
+type JobTracker struct {
+	mtx      sync.Mutex
+	running  map[string]struct{}
+	draining bool
+	idle     chan struct{}
+}
+
+// Jobs tracks the jobs started by StartJob and RecoverJobs
+var Jobs = NewJobTracker()
+
+// NewJobTracker returns a tracker without running jobs
+func NewJobTracker() *JobTracker {
+	return &JobTracker{running: map[string]struct{}{}}
+}
+
+// Acquire records a job as running, unless the tracker is draining
+func (t *JobTracker) Acquire(jobID string) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.draining {
+		return ErrDraining
+	}
+	t.running[jobID] = struct{}{}
+	return nil
+}
+
+// Release records that a job is no longer running
+func (t *JobTracker) Release(jobID string) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	delete(t.running, jobID)
+	if t.draining && len(t.running) == 0 && t.idle != nil {
+		close(t.idle)
+		t.idle = nil
+	}
+}
+
+// Running lists the IDs of the running jobs
+func (t *JobTracker) Running() []string {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	ids := make([]string, 0, len(t.running))
+	for id := range t.running {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Draining tells if the tracker stopped accepting jobs
+func (t *JobTracker) Draining() bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	return t.draining
+}
+
+// Drain stops accepting jobs and waits up to timeout for the
+// running ones to end. It returns the jobs still running by then.
+func (t *JobTracker) Drain(timeout time.Duration) []string {
+	t.mtx.Lock()
+	t.draining = true
+	var idle chan struct{}
+	if len(t.running) > 0 {
+		if t.idle == nil {
+			t.idle = make(chan struct{})
+		}
+		idle = t.idle
+	}
+	t.mtx.Unlock()
+
+	if idle != nil {
+		select {
+		case <-idle:
+		case <-time.After(timeout):
+		}
+	}
+	return t.Running()
+}
@@ -0,0 +1,46 @@
+package pipeline
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JobTracker", func() {
+	var tracker *JobTracker
+
+	BeforeEach(func() {
+		tracker = NewJobTracker()
+	})
+
+	It("should list the running jobs", func() {
+		Expect(tracker.Acquire("b")).To(Succeed())
+		Expect(tracker.Acquire("a")).To(Succeed())
+		tracker.Release("b")
+		Expect(tracker.Running()).To(Equal([]string{"a"}))
+	})
+
+	It("should refuse jobs once draining", func() {
+		Expect(tracker.Drain(time.Second)).To(BeEmpty())
+		Expect(tracker.Draining()).To(BeTrue())
+		Expect(tracker.Acquire("a")).To(Equal(ErrDraining))
+	})
+
+	It("should wait for the running jobs to end", func() {
+		tracker.Acquire("a")
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			tracker.Release("a")
+		}()
+
+		started := time.Now()
+		Expect(tracker.Drain(time.Minute)).To(BeEmpty())
+		Expect(time.Since(started)).To(BeNumerically("<", time.Minute))
+	})
+
+	It("should return the jobs still running after the timeout", func() {
+		tracker.Acquire("a")
+		Expect(tracker.Drain(10 * time.Millisecond)).To(Equal([]string{"a"}))
+	})
+})
@@ -0,0 +1,236 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/flavioribeiro/gonfig"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/types"
+)
+
+// Worker runs the jobs the API nodes queued on the database. It
+// leases every job it runs and renews the lease until the job is
+// done, so the jobs of workers that died are taken over by the
+// others once their lease expires.
+type Worker struct {
+	ID string
+
+	logger       lager.Logger
+	config       gonfig.Gonfig
+	db           db.Storage
+	leaseTTL     time.Duration
+	pollInterval time.Duration
+	slots        chan struct{}
+}
+
+// NewWorker sets up a worker from WORKER_ID (the hostname and pid
+// by default), WORKER_LEASE_SECONDS (defaults to 30),
+// WORKER_POLL_INTERVAL and MAX_CONCURRENT_JOBS
+func NewWorker(logger lager.Logger, config gonfig.Gonfig, dbInstance db.Storage) (*Worker, error) {
+	hostname, _ := os.Hostname()
+	id, err := config.GetString("WORKER_ID", fmt.Sprintf("%s-%d", hostname, os.Getpid()))
+	if err != nil {
+		return nil, err
+	}
+	leaseSeconds, err := config.GetInt("WORKER_LEASE_SECONDS", 30)
+	if err != nil {
+		return nil, err
+	}
+	pollInterval, err := config.GetInt("WORKER_POLL_INTERVAL", 5)
+	if err != nil {
+		return nil, err
+	}
+	maxRunning, err := config.GetInt("MAX_CONCURRENT_JOBS", runtime.NumCPU())
+	if err != nil {
+		return nil, err
+	}
+	if maxRunning <= 0 {
+		maxRunning = runtime.NumCPU()
+	}
+
+	return &Worker{
+		ID:           id,
+		logger:       logger.Session("worker", lager.Data{"worker": id}),
+		config:       config,
+		db:           dbInstance,
+		leaseTTL:     time.Duration(leaseSeconds) * time.Second,
+		pollInterval: time.Duration(pollInterval) * time.Second,
+		slots:        make(chan struct{}, maxRunning),
+	}, nil
+}
+
+// Run claims jobs until Snickers is shutting down
+func (w *Worker) Run() {
+	w.logger.Info("started")
+	defer w.logger.Info("stopped")
+
+	for !Jobs.Draining() {
+		if !w.claimNext() {
+			time.Sleep(w.pollInterval)
+		}
+	}
+}
+
+// claimNext leases the next job there is for a free slot and starts
+// running it. It returns false if there was none.
+func (w *Worker) claimNext() bool {
+	select {
+	case w.slots <- struct{}{}:
+	default:
+		return false
+	}
+
+	jobs, err := w.candidates()
+	if err != nil {
+		w.logger.Error("finding-jobs-failed", err)
+		<-w.slots
+		return false
+	}
+
+	for _, job := range jobs {
+		claimed, err := db.AcquireLease(w.db, job.ID, w.ID, w.leaseTTL)
+		if err == db.ErrLeaseHeld {
+			continue
+		} else if err != nil {
+			w.logger.Error("claiming-job-failed", err, lager.Data{"id": job.ID})
+			continue
+		}
+		// someone else may have run the job since it was listed
+		if claimed.Status != job.Status {
+			w.release(w.logger, job.ID)
+			continue
+		}
+
+		go w.run(claimed)
+		return true
+	}
+
+	<-w.slots
+	return false
+}
+
+// candidates lists the jobs the worker may claim: the queued ones
+// in the order the scheduler picks them, then the running ones whose
+// lease expired
+func (w *Worker) candidates() ([]types.Job, error) {
+	queued, err := findJobs(w.db, types.JobQueued)
+	if err != nil {
+		return nil, err
+	}
+	running, err := findRunningJobs(w.db)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	mine := map[string]bool{}
+	for _, id := range Jobs.Running() {
+		mine[id] = true
+	}
+
+	leased, expired := []types.Job{}, []types.Job{}
+	for _, job := range running {
+		if job.Lease != nil && job.Lease.ExpiresAt.After(now) {
+			leased = append(leased, job)
+		} else if !mine[job.ID] {
+			expired = append(expired, job)
+		}
+	}
+
+	available := []types.Job{}
+	for _, job := range queued {
+		if !mine[job.ID] && (job.Lease == nil || !job.Lease.ExpiresAt.After(now)) {
+			available = append(available, job)
+		}
+	}
+	return append(Queue.Order(available, leased), expired...), nil
+}
+
+// run goes through the stages of a claimed job, starting over if it
+// was queued or resuming it like RecoverJobs otherwise
+func (w *Worker) run(job types.Job) {
+	defer func() { <-w.slots }()
+	log := w.logger.Session("run-job", lager.Data{"id": job.ID, "status": job.Status})
+	defer log.Info("finished")
+
+	if err := Jobs.Acquire(job.ID); err != nil {
+		log.Error("not-started", err)
+		w.release(log, job.ID)
+		return
+	}
+	defer Jobs.Release(job.ID)
+
+	// the stages only write the job while the lease is held, and
+	// stop once it's taken over by another worker
+	leased := db.WithLease(w.db, job.ID, w.ID)
+	lost, stop := w.heartbeat(log, job.ID)
+	defer func() {
+		stop()
+		select {
+		case <-lost:
+		default:
+			w.release(log, job.ID)
+		}
+	}()
+
+	if job.Status == types.JobQueued {
+		log.Info("setup")
+		newJob, err := SetupJob(job.ID, leased, w.config)
+		if err == ErrNotStartable {
+			log.Info("no-longer-queued")
+			return
+		} else if err != nil {
+			log.Error("setup-job failed", err)
+			failJob(log, leased, job.ID, err)
+			return
+		}
+		runJob(log, w.logger, w.config, leased, *newJob, types.StageDownload, lost)
+		return
+	}
+
+	stage, recovered, err := prepareRecovery(w.config, leased, job)
+	if err != nil {
+		log.Error("recovery-failed", err)
+		failJob(log, leased, job.ID, err)
+		return
+	}
+	log.Info("resuming", lager.Data{"stage": stage})
+	runJob(log, w.logger, w.config, leased, recovered, stage, lost)
+}
+
+// heartbeat renews the lease on the job every third of its ttl,
+// until the returned func is called. The returned channel is closed
+// when the lease was taken over by another worker.
+func (w *Worker) heartbeat(log lager.Logger, jobID string) (<-chan struct{}, func()) {
+	done, lost := make(chan struct{}), make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(w.leaseTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				_, err := db.AcquireLease(w.db, jobID, w.ID, w.leaseTTL)
+				if err == db.ErrLeaseHeld {
+					log.Error("lost-lease", err)
+					close(lost)
+					return
+				} else if err != nil {
+					log.Error("renewing-lease-failed", err)
+				}
+			}
+		}
+	}()
+	return lost, func() { close(done) }
+}
+
+func (w *Worker) release(log lager.Logger, jobID string) {
+	if err := db.ReleaseLease(w.db, jobID, w.ID); err != nil {
+		log.Error("releasing-lease-failed", err)
+	}
+}
@@ -0,0 +1,158 @@
+package pipeline
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/flavioribeiro/gonfig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/events"
+	"github.com/snickers/snickers/types"
+)
+
+var _ = Describe("Worker", func() {
+	var (
+		cfg        gonfig.Gonfig
+		dbInstance db.Storage
+		worker     *Worker
+	)
+
+	lease := func(worker string, ttl time.Duration) *types.JobLease {
+		return &types.JobLease{Worker: worker, ExpiresAt: time.Now().Add(ttl)}
+	}
+
+	ids := func(jobs []types.Job) []string {
+		result := []string{}
+		for _, job := range jobs {
+			result = append(result, job.ID)
+		}
+		return result
+	}
+
+	BeforeEach(func() {
+		currentDir, _ := os.Getwd()
+		cfg, _ = gonfig.FromJsonFile(currentDir + "/../fixtures/config.json")
+		dbInstance, _ = db.GetDatabase(cfg)
+		dbInstance.ClearDatabase()
+
+		workerCfg, _ := gonfig.FromJson(strings.NewReader(`{"WORKER_ID": "worker-1", "MAX_CONCURRENT_JOBS": 1, "SWAP_DIRECTORY": "/tmp/"}`))
+		worker, _ = NewWorker(lagertest.NewTestLogger("worker"), workerCfg, dbInstance)
+	})
+
+	It("should list the queued jobs by priority and then the expired ones", func() {
+		created := time.Now()
+		dbInstance.StoreJob(types.Job{ID: "low", Status: types.JobQueued, CreatedAt: created})
+		dbInstance.StoreJob(types.Job{ID: "high", Status: types.JobQueued, Priority: 5, CreatedAt: created})
+		dbInstance.StoreJob(types.Job{ID: "claimed", Status: types.JobQueued, Priority: 9, Lease: lease("worker-2", time.Minute)})
+		dbInstance.StoreJob(types.Job{ID: "running", Status: types.JobEncoding, Lease: lease("worker-2", time.Minute)})
+		dbInstance.StoreJob(types.Job{ID: "abandoned", Status: types.JobEncoding, Lease: lease("worker-2", -time.Minute)})
+
+		jobs, err := worker.candidates()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ids(jobs)).To(Equal([]string{"high", "low", "abandoned"}))
+	})
+
+	It("should run a claimed job and release it when done", func() {
+		dbInstance.StoreJob(types.Job{
+			ID:     "123",
+			Status: types.JobQueued,
+			Source: "upload://source_here.mp4",
+			Upload: &types.SourceUpload{Filename: "source_here.mp4", Length: 10, Offset: 4},
+		})
+
+		Expect(worker.claimNext()).To(BeTrue())
+		Eventually(func() *types.JobLease {
+			job, _ := dbInstance.RetrieveJob("123")
+			return job.Lease
+		}).Should(BeNil())
+
+		job, _ := dbInstance.RetrieveJob("123")
+		Expect(job.Status).To(Equal(types.JobError))
+		Expect(job.Details).To(Equal("source upload is not complete"))
+	})
+
+	It("should not claim more jobs than its slots", func() {
+		worker.slots <- struct{}{}
+		dbInstance.StoreJob(types.Job{ID: "123", Status: types.JobQueued})
+
+		Expect(worker.claimNext()).To(BeFalse())
+		job, _ := dbInstance.RetrieveJob("123")
+		Expect(job.Lease).To(BeNil())
+	})
+
+	Context("when the lease is taken over by another worker", func() {
+		BeforeEach(func() {
+			worker.leaseTTL = 30 * time.Millisecond
+			dbInstance.StoreJob(types.Job{ID: "123", Status: types.JobEncoding, Lease: lease("worker-1", time.Minute)})
+		})
+
+		It("should tell the job to stop", func() {
+			lost, stop := worker.heartbeat(lagertest.NewTestLogger("heartbeat"), "123")
+			defer stop()
+			Consistently(lost, 50*time.Millisecond).ShouldNot(BeClosed())
+
+			db.ModifyJob(dbInstance, "123", func(job *types.Job) error {
+				job.Lease = lease("worker-2", time.Minute)
+				return nil
+			})
+			Eventually(lost).Should(BeClosed())
+		})
+
+		It("should stop between stages without writing the job", func() {
+			db.ModifyJob(dbInstance, "123", func(job *types.Job) error {
+				job.Upload = &types.SourceUpload{Filename: "source_here.mp4", Complete: true}
+				return nil
+			})
+			job, _ := dbInstance.RetrieveJob("123")
+			stop := make(chan struct{})
+			close(stop)
+
+			runJob(worker.logger, worker.logger, cfg, db.WithLease(dbInstance, "123", "worker-1"), job, types.StageDownload, stop)
+
+			current, _ := dbInstance.RetrieveJob("123")
+			Expect(current.Version).To(Equal(job.Version))
+			Expect(current.Stages).To(BeEmpty())
+		})
+	})
+
+	Context("when jobs are run by workers", func() {
+		BeforeEach(func() {
+			Queue.mtx.Lock()
+			Queue.remote, Queue.pollInterval = true, 10*time.Millisecond
+			Queue.mtx.Unlock()
+		})
+
+		AfterEach(func() {
+			Queue.mtx.Lock()
+			Queue.remote, Queue.pollInterval = false, 5*time.Second
+			Queue.mtx.Unlock()
+		})
+
+		It("should leave started jobs queued for them and report their changes", func() {
+			dbInstance.StoreJob(types.Job{ID: "123", Status: types.JobCreated})
+			subscription := events.DefaultBus.Subscribe("123")
+			defer subscription.Close()
+
+			done := make(chan struct{})
+			go func() {
+				StartJob(lagertest.NewTestLogger("start"), cfg, dbInstance, types.Job{ID: "123"})
+				close(done)
+			}()
+
+			var event events.Event
+			Eventually(subscription.Events).Should(Receive(&event))
+			Expect(event.Status).To(Equal(types.JobQueued))
+			db.ModifyJob(dbInstance, "123", func(job *types.Job) error {
+				job.Status = types.JobFinished
+				return nil
+			})
+			Eventually(subscription.Events).Should(Receive(&event))
+			Expect(event.Status).To(Equal(types.JobFinished))
+			Eventually(done).Should(BeClosed())
+		})
+	})
+})
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/dchest/uniuri"
+	"github.com/gorilla/mux"
+	"github.com/snickers/snickers/types"
+)
+
+// CreateAPIKey creates an API key with the given name and scopes.
+// The key is only on this response, only its hash is stored.
+func (sn *SnickersServer) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	log := sn.logger.Session("create-api-key")
+	log.Debug("started")
+	defer log.Debug("finished")
+
+	var key types.APIKey
+	if err := json.NewDecoder(r.Body).Decode(&key); err != nil {
+		log.Error("failed-unpacking-api-key", err)
+		HTTPError(w, http.StatusBadRequest, "unpacking api key", err)
+		return
+	}
+	if len(key.Scopes) == 0 {
+		HTTPError(w, http.StatusBadRequest, "validating api key", errors.New("at least one scope is required"))
+		return
+	}
+	if !types.ValidTenant(key.Tenant) {
+		HTTPError(w, http.StatusBadRequest, "validating api key", fmt.Errorf("invalid tenant %q", key.Tenant))
+		return
+	}
+	for _, scope := range key.Scopes {
+		if !types.ValidScope(scope) {
+			HTTPError(w, http.StatusBadRequest, "validating api key", fmt.Errorf("unknown scope %q", scope))
+			return
+		}
+	}
+
+	key.ID = uniuri.New()
+	key.Key = newAPIKeySecret(key.ID)
+	key.Hash = hashAPIKey(key.Key)
+	key.CreatedAt = time.Now().UTC()
+
+	stored := key
+	stored.Key = ""
+	if _, err := sn.db.StoreAPIKey(stored); err != nil {
+		log.Error("failed-storing-api-key", err)
+		HTTPError(w, http.StatusInternalServerError, "storing api key", err)
+		return
+	}
+
+	key.Hash = ""
+	result, err := json.Marshal(key)
+	if err != nil {
+		log.Error("failed-packaging-api-key", err)
+		HTTPError(w, http.StatusInternalServerError, "packing api key", err)
+		return
+	}
+	log.Info("created", lager.Data{"id": key.ID, "tenant": key.Tenant, "scopes": key.Scopes})
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, "%s", result)
+}
+
+// ListAPIKeys lists the API keys, without their hashes
+func (sn *SnickersServer) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	log := sn.logger.Session("list-api-keys")
+	log.Debug("started")
+	defer log.Debug("finished")
+
+	keys, err := sn.db.GetAPIKeys()
+	if err != nil {
+		log.Error("failed-getting-api-keys", err)
+		HTTPError(w, http.StatusInternalServerError, "getting api keys", err)
+		return
+	}
+	for i := range keys {
+		keys[i].Hash = ""
+	}
+
+	result, err := json.Marshal(keys)
+	if err != nil {
+		log.Error("failed-packaging-api-keys", err)
+		HTTPError(w, http.StatusInternalServerError, "packing api keys", err)
+		return
+	}
+	fmt.Fprintf(w, "%s", result)
+}
+
+// RevokeAPIKey deletes an API key, so requests made with it
+// are no longer authenticated
+func (sn *SnickersServer) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	log := sn.logger.Session("revoke-api-key")
+	log.Debug("started")
+	defer log.Debug("finished")
+
+	key, err := sn.db.DeleteAPIKey(mux.Vars(r)["keyID"])
+	if err != nil {
+		log.Error("failed-revoking-api-key", err)
+		HTTPError(w, http.StatusNotFound, "revoking api key", err)
+		return
+	}
+
+	log.Info("revoked", lager.Data{"id": key.ID})
+	w.WriteHeader(http.StatusOK)
+}
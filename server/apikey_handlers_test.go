@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/flavioribeiro/gonfig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/types"
+)
+
+var _ = Describe("API key handlers", func() {
+	var (
+		sn         *SnickersServer
+		dbInstance db.Storage
+	)
+
+	request := func(method, path, key string, body []byte) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(body))
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		sn.Handler().ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	BeforeEach(func() {
+		cfg, _ := gonfig.FromJson(strings.NewReader(`{"DATABASE_DRIVER": "memory", "SWAP_DIRECTORY": "/tmp/", "ADMIN_API_KEY": "admin-secret"}`))
+		dbInstance, _ = db.GetDatabase(cfg)
+		dbInstance.ClearDatabase()
+		sn = New(lagertest.NewTestLogger("api-key-handlers"), cfg, "tcp", ":8000", dbInstance)
+	})
+
+	AfterEach(func() {
+		dbInstance.ClearDatabase()
+	})
+
+	Describe("CreateAPIKey", func() {
+		It("should hand out the key only once and store its hash", func() {
+			recorder := request(http.MethodPost, "/apikeys", "admin-secret", []byte(`{"name": "encoder", "scopes": ["jobs:read", "jobs:write"]}`))
+			Expect(recorder.Code).To(Equal(http.StatusCreated))
+
+			var key types.APIKey
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &key)).To(Succeed())
+			Expect(key.Name).To(Equal("encoder"))
+			Expect(key.Key).To(HavePrefix(key.ID + "."))
+			Expect(key.Hash).To(BeEmpty())
+
+			stored, err := dbInstance.RetrieveAPIKey(key.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.Key).To(BeEmpty())
+			Expect(stored.Hash).To(Equal(hashAPIKey(key.Key)))
+			Expect(stored.Scopes).To(Equal([]types.APIScope{types.ScopeReadJobs, types.ScopeWriteJobs}))
+		})
+
+		It("should refuse keys without scopes", func() {
+			recorder := request(http.MethodPost, "/apikeys", "admin-secret", []byte(`{"name": "encoder"}`))
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("should refuse unknown scopes", func() {
+			recorder := request(http.MethodPost, "/apikeys", "admin-secret", []byte(`{"name": "encoder", "scopes": ["everything"]}`))
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(recorder.Body.String()).To(ContainSubstring("unknown scope"))
+		})
+	})
+
+	Describe("ListAPIKeys", func() {
+		It("should list the keys without their hashes", func() {
+			dbInstance.StoreAPIKey(types.APIKey{ID: "123", Name: "encoder", Hash: "abc", Scopes: []types.APIScope{types.ScopeReadJobs}})
+
+			recorder := request(http.MethodGet, "/apikeys", "admin-secret", nil)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+
+			var keys []types.APIKey
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &keys)).To(Succeed())
+			Expect(keys).To(HaveLen(1))
+			Expect(keys[0].ID).To(Equal("123"))
+			Expect(keys[0].Hash).To(BeEmpty())
+		})
+	})
+
+	Describe("RevokeAPIKey", func() {
+		It("should stop authenticating the revoked key", func() {
+			recorder := request(http.MethodPost, "/apikeys", "admin-secret", []byte(`{"name": "reader", "scopes": ["jobs:read"]}`))
+			var key types.APIKey
+			json.Unmarshal(recorder.Body.Bytes(), &key)
+			Expect(request(http.MethodGet, "/jobs", key.Key, nil).Code).To(Equal(http.StatusOK))
+
+			Expect(request(http.MethodDelete, "/apikeys/"+key.ID, "admin-secret", nil).Code).To(Equal(http.StatusOK))
+			Expect(request(http.MethodGet, "/jobs", key.Key, nil).Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should return not found for a key that does not exist", func() {
+			recorder := request(http.MethodDelete, "/apikeys/missing", "admin-secret", nil)
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+})
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/dchest/uniuri"
+	"github.com/snickers/snickers/types"
+)
+
+// apiKeySecretLength is the length of the random part of API keys
+const apiKeySecretLength = 32
+
+// apiKeyContextKey keeps the API key of a request on its context
+type apiKeyContextKey struct{}
+
+// authenticate only lets through the requests made with an API key
+// granted the scope. Keys are sent as "Authorization: Bearer <key>".
+// Authentication is on once ADMIN_API_KEY is set, which is the key
+// used to create the others; routes without a scope are public.
+func (sn *SnickersServer) authenticate(scope types.APIScope, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminKey, err := sn.config.GetString("ADMIN_API_KEY", "")
+		if err != nil {
+			HTTPError(w, http.StatusInternalServerError, "reading admin api key", err)
+			return
+		}
+		if scope == "" || adminKey == "" {
+			handler(w, r)
+			return
+		}
+
+		key, err := sn.apiKey(r, adminKey)
+		if err != nil {
+			sn.logger.Info("unauthorized", lager.Data{"method": r.Method, "path": r.URL.Path, "error": err.Error()})
+			w.Header().Set("WWW-Authenticate", `Bearer realm="snickers"`)
+			HTTPError(w, http.StatusUnauthorized, "authenticating", err)
+			return
+		}
+		if !key.Allows(scope) {
+			HTTPError(w, http.StatusForbidden, "authorizing", errors.New("api key lacks the "+string(scope)+" scope"))
+			return
+		}
+		handler(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+	}
+}
+
+// callerKey returns the API key a request was authenticated with,
+// if authentication is on
+func callerKey(r *http.Request) (types.APIKey, bool) {
+	key, ok := r.Context().Value(apiKeyContextKey{}).(types.APIKey)
+	return key, ok
+}
+
+// tenant returns the tenant a request acts on behalf of, which is
+// the default one when authentication is off
+func tenant(r *http.Request) string {
+	key, _ := callerKey(r)
+	return key.Tenant
+}
+
+// presetOwner returns the owner of the presets a request changes.
+// Admin callers change the system presets with "?system=true".
+func presetOwner(r *http.Request) (string, error) {
+	if r.URL.Query().Get("system") != "true" {
+		return tenant(r), nil
+	}
+	if key, ok := callerKey(r); ok && !key.Allows(types.ScopeAdmin) {
+		return "", errors.New("only admin api keys change system presets")
+	}
+	return types.SystemOwner, nil
+}
+
+// apiKey finds the API key a request was made with
+func (sn *SnickersServer) apiKey(r *http.Request, adminKey string) (types.APIKey, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return types.APIKey{}, errors.New("missing api key")
+	}
+	secret := strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(adminKey)) == 1 {
+		return types.APIKey{ID: "admin", Scopes: []types.APIScope{types.ScopeAdmin}}, nil
+	}
+
+	keyID := strings.SplitN(secret, ".", 2)[0]
+	key, err := sn.db.RetrieveAPIKey(keyID)
+	if err != nil || subtle.ConstantTimeCompare([]byte(hashAPIKey(secret)), []byte(key.Hash)) != 1 {
+		return types.APIKey{}, errors.New("invalid api key")
+	}
+	return key, nil
+}
+
+// newAPIKeySecret returns a new key for the API key of the given
+// id. The id prefixes the key so it can be looked up.
+func newAPIKeySecret(keyID string) string {
+	return keyID + "." + uniuri.NewLen(apiKeySecretLength)
+}
+
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/flavioribeiro/gonfig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/types"
+)
+
+var _ = Describe("Authentication", func() {
+	var (
+		sn         *SnickersServer
+		dbInstance db.Storage
+	)
+
+	request := func(method, path, authorization string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		sn.Handler().ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	storeKey := func(id string, scopes ...types.APIScope) string {
+		secret := newAPIKeySecret(id)
+		dbInstance.StoreAPIKey(types.APIKey{ID: id, Hash: hashAPIKey(secret), Scopes: scopes})
+		return secret
+	}
+
+	newServer := func(config string) {
+		cfg, _ := gonfig.FromJson(strings.NewReader(config))
+		dbInstance, _ = db.GetDatabase(cfg)
+		dbInstance.ClearDatabase()
+		sn = New(lagertest.NewTestLogger("authentication"), cfg, "tcp", ":8000", dbInstance)
+	}
+
+	BeforeEach(func() {
+		newServer(`{"DATABASE_DRIVER": "memory", "SWAP_DIRECTORY": "/tmp/", "ADMIN_API_KEY": "admin-secret"}`)
+	})
+
+	AfterEach(func() {
+		dbInstance.ClearDatabase()
+	})
+
+	It("should refuse requests without a key", func() {
+		recorder := request(http.MethodGet, "/jobs", "")
+		Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		Expect(recorder.Header().Get("WWW-Authenticate")).To(ContainSubstring("Bearer"))
+	})
+
+	It("should refuse unknown keys", func() {
+		Expect(request(http.MethodGet, "/jobs", "Bearer 123.wrong").Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("should refuse keys with a wrong secret", func() {
+		storeKey("123", types.ScopeReadJobs)
+		Expect(request(http.MethodGet, "/jobs", "Bearer 123.wrong").Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("should let through keys granted the scope of the route", func() {
+		key := storeKey("123", types.ScopeReadJobs)
+		Expect(request(http.MethodGet, "/jobs", "Bearer "+key).Code).To(Equal(http.StatusOK))
+	})
+
+	It("should forbid keys without the scope of the route", func() {
+		key := storeKey("123", types.ScopeReadJobs)
+		Expect(request(http.MethodDelete, "/presets/examplePreset", "Bearer "+key).Code).To(Equal(http.StatusForbidden))
+		Expect(request(http.MethodGet, "/apikeys", "Bearer "+key).Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("should let admin keys through every route", func() {
+		key := storeKey("123", types.ScopeAdmin)
+		Expect(request(http.MethodGet, "/apikeys", "Bearer "+key).Code).To(Equal(http.StatusOK))
+		Expect(request(http.MethodGet, "/presets", "Bearer admin-secret").Code).To(Equal(http.StatusOK))
+	})
+
+	It("should keep the health endpoint public", func() {
+		Expect(request(http.MethodGet, "/healthz", "").Code).NotTo(Equal(http.StatusUnauthorized))
+	})
+
+	It("should not authenticate without an admin key", func() {
+		newServer(`{"DATABASE_DRIVER": "memory", "SWAP_DIRECTORY": "/tmp/"}`)
+		Expect(request(http.MethodGet, "/jobs", "").Code).To(Equal(http.StatusOK))
+	})
+})
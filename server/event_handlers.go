@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/snickers/snickers/events"
+)
+
+// eventsKeepAlive is how often a comment is sent on idle event
+// streams, so proxies don't close them
+const eventsKeepAlive = 15 * time.Second
+
+// StreamJobEvents streams the status and progress changes of a
+// job as Server-Sent Events, starting with its current state
+func (sn *SnickersServer) StreamJobEvents(w http.ResponseWriter, r *http.Request) {
+	log := sn.logger.Session("stream-job-events")
+	log.Debug("started")
+	defer log.Debug("finished")
+
+	// subscribe before reading the job, so no event published in
+	// between is lost
+	jobID := mux.Vars(r)["jobID"]
+	subscription := sn.events.Subscribe(jobID)
+	defer subscription.Close()
+
+	job, err := sn.retrieveJob(r, jobID)
+	if err != nil {
+		log.Error("failed-retrieving-job", err)
+		HTTPError(w, http.StatusNotFound, "retrieving job", err)
+		return
+	}
+
+	sn.streamEvents(w, r, subscription, events.NewJobEvent(events.JobStatusChanged, job))
+}
+
+// StreamEvents streams the status and progress changes of
+// every job of the caller as Server-Sent Events
+func (sn *SnickersServer) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	log := sn.logger.Session("stream-events")
+	log.Debug("started")
+	defer log.Debug("finished")
+
+	subscription := sn.events.SubscribeOwner(tenant(r))
+	defer subscription.Close()
+
+	sn.streamEvents(w, r, subscription)
+}
+
+// streamEvents writes the initial events and then everything the
+// subscription receives until the client goes away
+func (sn *SnickersServer) streamEvents(w http.ResponseWriter, r *http.Request, subscription *events.Subscription, initial ...events.Event) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		HTTPError(w, http.StatusInternalServerError, "streaming events", errors.New("streaming is not supported"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for _, event := range initial {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sn.done:
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-subscription.Events:
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/flavioribeiro/gonfig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/events"
+	"github.com/snickers/snickers/types"
+)
+
+var _ = Describe("Event handlers", func() {
+	var (
+		dbInstance db.Storage
+		sn         *SnickersServer
+		testServer *httptest.Server
+	)
+
+	BeforeEach(func() {
+		currentDir, _ := os.Getwd()
+		cfg, _ := gonfig.FromJsonFile(currentDir + "/../fixtures/config.json")
+		dbInstance, _ = db.GetDatabase(cfg)
+		dbInstance.ClearDatabase()
+		sn = New(lagertest.NewTestLogger("event-handlers"), cfg, "tcp", ":8000", dbInstance)
+		sn.events = events.NewBus()
+		testServer = httptest.NewServer(sn.Handler())
+
+		dbInstance.StoreJob(types.Job{ID: "123", Status: types.JobCreated})
+	})
+
+	AfterEach(func() {
+		testServer.CloseClientConnections()
+		testServer.Close()
+	})
+
+	// readEvent reads the next event of a stream, skipping comments
+	readEvent := func(reader *bufio.Reader) (string, events.Event) {
+		var eventType string
+		var event events.Event
+		for {
+			line, err := reader.ReadString('\n')
+			Expect(err).NotTo(HaveOccurred())
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				eventType = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				Expect(json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event)).To(Succeed())
+			case line == "" && eventType != "":
+				return eventType, event
+			}
+		}
+	}
+
+	It("should stream the changes of a job starting with its current state", func() {
+		resp, err := http.Get(testServer.URL + "/jobs/123/events")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+
+		reader := bufio.NewReader(resp.Body)
+		eventType, event := readEvent(reader)
+		Expect(eventType).To(Equal(events.JobStatusChanged))
+		Expect(event.Status).To(Equal(types.JobCreated))
+
+		job := types.Job{ID: "123", Status: types.JobEncoding}
+		job.SetProgress(types.NewProgress(types.StageEncode, 10, 100, types.ProgressFrames, 0))
+		sn.events.Publish(events.NewJobEvent(events.JobProgressChanged, types.Job{ID: "321"}))
+		sn.events.Publish(events.NewJobEvent(events.JobProgressChanged, job))
+
+		eventType, event = readEvent(reader)
+		Expect(eventType).To(Equal(events.JobProgressChanged))
+		Expect(event.JobID).To(Equal("123"))
+		Expect(event.Progress.StagePercent).To(Equal(float64(10)))
+	})
+
+	It("should return not found for the events of a missing job", func() {
+		resp, err := http.Get(testServer.URL + "/jobs/missing/events")
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+	It("should stream the changes of every job", func() {
+		resp, err := http.Get(testServer.URL + "/events")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		// the subscription is made once the headers are sent
+		sn.events.Publish(events.NewJobEvent(events.JobStatusChanged, types.Job{ID: "321", Status: types.JobFinished}))
+
+		eventType, event := readEvent(bufio.NewReader(resp.Body))
+		Expect(eventType).To(Equal(events.JobStatusChanged))
+		Expect(event.JobID).To(Equal("321"))
+	})
+})
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"syscall"
+
+	"github.com/snickers/snickers/encoders"
+	"github.com/snickers/snickers/pipeline"
+)
+
+// defaultMinFreeSwapSpace is the free space, in bytes, the swap
+// directory needs when MIN_FREE_SWAP_SPACE is not set
+const defaultMinFreeSwapSpace = 1 << 30
+
+// healthCheck tells if something Snickers depends on is available
+type healthCheck func(sn *SnickersServer) error
+
+// healthChecks are run by the health endpoint, by name
+var healthChecks = map[string]healthCheck{
+	"storage":   checkStorage,
+	"swapSpace": checkSwapSpace,
+	"encoders":  checkEncoders,
+}
+
+// healthStatus is the body of the health endpoint
+type healthStatus struct {
+	Status      string            `json:"status"`
+	Checks      map[string]string `json:"checks"`
+	RunningJobs []string          `json:"runningJobs"`
+}
+
+// Health tells if Snickers takes jobs. It answers 503 when any of
+// the health checks fails, and while shutting down along with the
+// jobs that are still draining.
+func (sn *SnickersServer) Health(w http.ResponseWriter, r *http.Request) {
+	log := sn.logger.Session("health")
+	log.Debug("started")
+	defer log.Debug("finished")
+
+	status := healthStatus{Status: "ok", Checks: map[string]string{}, RunningJobs: pipeline.Jobs.Running()}
+	code := http.StatusOK
+	for name, check := range healthChecks {
+		status.Checks[name] = "ok"
+		if err := check(sn); err != nil {
+			log.Error("failed-"+name+"-check", err)
+			status.Checks[name] = err.Error()
+			status.Status = "unhealthy"
+			code = http.StatusServiceUnavailable
+		}
+	}
+	if pipeline.Jobs.Draining() {
+		status.Status = "draining"
+		code = http.StatusServiceUnavailable
+	}
+
+	result, err := json.Marshal(status)
+	if err != nil {
+		HTTPError(w, http.StatusInternalServerError, "packing health status", err)
+		return
+	}
+
+	w.WriteHeader(code)
+	fmt.Fprintf(w, "%s", result)
+}
+
+func checkStorage(sn *SnickersServer) error {
+	return sn.db.Ping()
+}
+
+// checkSwapSpace tells if the swap directory has at least
+// MIN_FREE_SWAP_SPACE bytes free for sources and outputs
+func checkSwapSpace(sn *SnickersServer) error {
+	swapDir, err := sn.config.GetString("SWAP_DIRECTORY", "")
+	if err != nil {
+		return err
+	}
+	minFree, err := sn.config.GetInt("MIN_FREE_SWAP_SPACE", defaultMinFreeSwapSpace)
+	if err != nil {
+		return err
+	}
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(swapDir, &stat); err != nil {
+		return err
+	}
+	free := uint64(stat.Bavail) * uint64(stat.Bsize)
+	if free < uint64(minFree) {
+		return fmt.Errorf("%d bytes free on %s, %d needed", free, swapDir, minFree)
+	}
+	return nil
+}
+
+func checkEncoders(sn *SnickersServer) error {
+	return encoders.CheckEncoders()
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/flavioribeiro/gonfig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/pipeline"
+	"github.com/snickers/snickers/types"
+)
+
+var _ = Describe("Health handler", func() {
+	var (
+		sn     *SnickersServer
+		health healthStatus
+	)
+
+	getHealth := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/healthz", nil)
+		sn.Handler().ServeHTTP(recorder, req)
+		json.Unmarshal(recorder.Body.Bytes(), &health)
+		return recorder
+	}
+
+	BeforeEach(func() {
+		currentDir, _ := os.Getwd()
+		cfg, _ := gonfig.FromJsonFile(currentDir + "/../fixtures/config.json")
+		dbInstance, _ := db.GetDatabase(cfg)
+		sn = New(lagertest.NewTestLogger("health-handler"), cfg, "tcp", ":8000", dbInstance)
+		sn.config, _ = gonfig.FromJson(strings.NewReader(`{"SWAP_DIRECTORY": "/tmp/", "MIN_FREE_SWAP_SPACE": 0}`))
+		pipeline.Jobs = pipeline.NewJobTracker()
+	})
+
+	AfterEach(func() {
+		pipeline.Jobs = pipeline.NewJobTracker()
+	})
+
+	It("should report a healthy server with its running jobs", func() {
+		pipeline.Jobs.Acquire("123")
+
+		recorder := getHealth()
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(health.Status).To(Equal("ok"))
+		Expect(health.Checks).To(Equal(map[string]string{"storage": "ok", "swapSpace": "ok", "encoders": "ok"}))
+		Expect(health.RunningJobs).To(Equal([]string{"123"}))
+	})
+
+	It("should report a swap directory without enough free space", func() {
+		sn.config, _ = gonfig.FromJson(strings.NewReader(`{"SWAP_DIRECTORY": "/tmp/", "MIN_FREE_SWAP_SPACE": 9223372036854775807}`))
+
+		recorder := getHealth()
+		Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(health.Status).To(Equal("unhealthy"))
+		Expect(health.Checks["swapSpace"]).To(ContainSubstring("bytes free on /tmp/"))
+		Expect(health.Checks["storage"]).To(Equal("ok"))
+	})
+
+	It("should report a swap directory that does not exist", func() {
+		sn.config, _ = gonfig.FromJson(strings.NewReader(`{"SWAP_DIRECTORY": "/nonexistent/swap/", "MIN_FREE_SWAP_SPACE": 0}`))
+
+		recorder := getHealth()
+		Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(health.Checks["swapSpace"]).NotTo(Equal("ok"))
+	})
+
+	It("should report the drain while shutting down", func() {
+		pipeline.Jobs.Acquire("123")
+		pipeline.Jobs.Drain(0)
+
+		recorder := getHealth()
+		Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(health.Status).To(Equal("draining"))
+		Expect(health.RunningJobs).To(Equal([]string{"123"}))
+	})
+
+	It("should not start jobs while shutting down", func() {
+		pipeline.Jobs.Drain(0)
+
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/jobs/123/start", nil)
+		sn.db.StoreJob(types.Job{ID: "123"})
+		sn.Handler().ServeHTTP(recorder, req)
+		Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+	})
+})
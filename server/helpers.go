@@ -1,15 +1,20 @@
 package server
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/types"
 )
 
 // HTTPError is a helper to return errors on handlers
 func HTTPError(w http.ResponseWriter, httpErr int, msg string, err error) {
-	msg = fmt.Sprintf(`{"error": "%s: %s"}`, msg, err.Error())
-	http.Error(w, msg, httpErr)
-	return
+	body, _ := json.Marshal(map[string]string{"error": msg + ": " + err.Error()})
+	http.Error(w, string(body), httpErr)
 }
 
 // JSONHandler adds json headers
@@ -19,3 +24,50 @@ func JSONHandler(actual http.Handler) http.HandlerFunc {
 		actual.ServeHTTP(w, r)
 	})
 }
+
+// versionETag is the entity tag of a job or preset version
+func versionETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// matchesIfMatch tells if the request may change the given
+// version. Requests without If-Match always may.
+func matchesIfMatch(r *http.Request, version int64) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return true
+	}
+
+	etag := versionETag(version)
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// getUpdateErrorStatus is the status of a failed update. Updates
+// that lost a race fail their precondition if the client gave one.
+func getUpdateErrorStatus(r *http.Request, err error) int {
+	if err != db.ErrVersionConflict {
+		return http.StatusInternalServerError
+	} else if r.Header.Get("If-Match") != "" {
+		return http.StatusPreconditionFailed
+	}
+	return http.StatusConflict
+}
+
+// retrieveJob retrieves a job of the tenant of the request. The
+// jobs of other tenants are not found.
+func (sn *SnickersServer) retrieveJob(r *http.Request, jobID string) (types.Job, error) {
+	job, err := sn.db.RetrieveJob(jobID)
+	if err != nil {
+		return types.Job{}, err
+	}
+	if job.Owner != tenant(r) {
+		return types.Job{}, errors.New("job not found")
+	}
+	return job, nil
+}
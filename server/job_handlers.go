@@ -2,12 +2,17 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"code.cloudfoundry.org/lager"
-	"github.com/dchest/uniuri"
 	"github.com/gorilla/mux"
+	"github.com/snickers/snickers/db"
 	"github.com/snickers/snickers/pipeline"
 	"github.com/snickers/snickers/types"
 )
@@ -20,7 +25,10 @@ func (sn *SnickersServer) DeleteJob(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
 	jobID := vars["jobID"]
-	_, err := sn.db.DeleteJob(jobID)
+	_, err := sn.retrieveJob(r, jobID)
+	if err == nil {
+		_, err = sn.db.DeleteJob(jobID)
+	}
 	if err != nil {
 		log.Error("failed-deleting-job", err)
 		HTTPError(w, http.StatusBadRequest, "deleting job", err)
@@ -43,27 +51,42 @@ func (sn *SnickersServer) CreateJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	preset, err := sn.db.RetrievePreset(jobInput.PresetName)
-	if err != nil {
-		log.Error("failed-retrieving-preset", err)
-		HTTPError(w, http.StatusBadRequest, "retrieving preset", err)
+	if strings.HasPrefix(jobInput.Source, "file://") {
+		err := errors.New("local sources are only allowed on watch folders")
+		log.Error("failed-validating-source", err)
+		HTTPError(w, http.StatusBadRequest, "validating source", err)
 		return
 	}
 
-	var job types.Job
+	jobInput.Owner = tenant(r)
+	startNow := jobInput.AutoStart && (jobInput.StartAt == nil || !jobInput.StartAt.After(time.Now()))
+	if startNow {
+		err := pipeline.CheckRunningQuota(sn.config, sn.db, jobInput.Owner, "")
+		if err == nil {
+			err = pipeline.CheckStorageQuota(sn.config, sn.db, jobInput.Owner, 0)
+		}
+		if err != nil {
+			log.Error("failed-checking-quota", err)
+			HTTPError(w, getQuotaErrorStatus(err), "creating job", err)
+			return
+		}
+	}
 
-	job.ID = uniuri.New()
-	job.Source = jobInput.Source
-	job.Destination = jobInput.Destination
-	job.Preset = preset
-	job.Status = types.JobCreated
-	_, err = sn.db.StoreJob(job)
+	job, err := pipeline.CreateJob(sn.db, jobInput)
 	if err != nil {
-		log.Error("failed-storing-job", err)
-		HTTPError(w, http.StatusBadRequest, "storing job", err)
+		log.Error("failed-creating-job", err)
+		HTTPError(w, http.StatusBadRequest, "creating job", err)
 		return
 	}
 
+	if startNow && !pipeline.Jobs.Draining() {
+		if queued, err := pipeline.StartScheduledJob(log, sn.config, sn.db, job.ID); err != nil {
+			log.Error("failed-starting-job", err)
+		} else {
+			job = queued
+		}
+	}
+
 	result, err := json.Marshal(job)
 	if err != nil {
 		log.Error("failed-packaging-job-data", err)
@@ -76,20 +99,40 @@ func (sn *SnickersServer) CreateJob(w http.ResponseWriter, r *http.Request) {
 	log.Info("created", lager.Data{"id": job.ID})
 }
 
-// ListJobs lists all jobs
+// ListJobs lists a page of the jobs of the caller, filtered and
+// sorted by the query string. When there are more pages, the Link header
+// points to the next one.
 func (sn *SnickersServer) ListJobs(w http.ResponseWriter, r *http.Request) {
 	log := sn.logger.Session("list-jobs")
 	log.Debug("started")
 	defer log.Debug("finished")
 
-	jobs, err := sn.db.GetJobs()
+	query, err := parseJobQuery(r.URL.Query())
+	if err != nil {
+		log.Error("failed-parsing-query", err)
+		HTTPError(w, http.StatusBadRequest, "parsing query", err)
+		return
+	}
+	query.Owner = tenant(r)
+
+	page, err := sn.db.QueryJobs(query)
 	if err != nil {
 		log.Error("failed-getting-jobs", err)
 		HTTPError(w, http.StatusBadRequest, "getting jobs", err)
 		return
 	}
 
-	result, err := json.Marshal(jobs)
+	if page.NextCursor != "" {
+		next := r.URL.Query()
+		next.Set("cursor", page.NextCursor)
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, next.Encode()))
+	}
+
+	for i := range page.Jobs {
+		page.Jobs[i] = withTimeEstimate(page.Jobs[i])
+	}
+
+	result, err := json.Marshal(page.Jobs)
 	if err != nil {
 		log.Error("failed-packaging-jobs", err)
 		HTTPError(w, http.StatusBadRequest, "packing jobs data", err)
@@ -107,25 +150,27 @@ func (sn *SnickersServer) GetJobDetails(w http.ResponseWriter, r *http.Request)
 
 	vars := mux.Vars(r)
 	jobID := vars["jobID"]
-	job, err := sn.db.RetrieveJob(jobID)
+	job, err := sn.retrieveJob(r, jobID)
 	if err != nil {
 		log.Error("failed-retrieving-job", err)
 		HTTPError(w, http.StatusBadRequest, "retrieving job", err)
 		return
 	}
 
-	result, err := json.Marshal(job)
+	result, err := json.Marshal(withTimeEstimate(job))
 	if err != nil {
 		log.Error("failed-packaging-job-data", err)
 		HTTPError(w, http.StatusBadRequest, "packing job data", err)
 		return
 	}
 
+	w.Header().Set("ETag", versionETag(job.Version))
 	fmt.Fprintf(w, "%s", result)
 	log.Info("got-job-details", lager.Data{"id": job.ID})
 }
 
-// StartJob triggers an encoding process
+// StartJob triggers an encoding process. With If-Match, the job
+// is only started if it's still on the given version.
 func (sn *SnickersServer) StartJob(w http.ResponseWriter, r *http.Request) {
 	log := sn.logger.Session("start-job")
 	log.Debug("started")
@@ -133,14 +178,116 @@ func (sn *SnickersServer) StartJob(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
 	jobID := vars["jobID"]
-	job, err := sn.db.RetrieveJob(jobID)
+	job, err := sn.retrieveJob(r, jobID)
 	if err != nil {
 		log.Error("failed-retrieving-job", err)
 		HTTPError(w, http.StatusBadRequest, "retrieving job", err)
 		return
 	}
+	if !matchesIfMatch(r, job.Version) {
+		HTTPError(w, http.StatusPreconditionFailed, "starting job", db.ErrVersionConflict)
+		return
+	}
+	if pipeline.Jobs.Draining() {
+		HTTPError(w, http.StatusServiceUnavailable, "starting job", pipeline.ErrDraining)
+		return
+	}
+	err = pipeline.CheckRunningQuota(sn.config, sn.db, job.Owner, job.ID)
+	if err == nil {
+		err = pipeline.CheckStorageQuota(sn.config, sn.db, job.Owner, 0)
+	}
+	if err != nil {
+		log.Error("failed-checking-quota", err)
+		HTTPError(w, getQuotaErrorStatus(err), "starting job", err)
+		return
+	}
 
 	log.Debug("starting-job", lager.Data{"id": job.ID})
+	job, err = pipeline.QueueJob(sn.db, job.ID)
+	if err == pipeline.ErrNotStartable {
+		HTTPError(w, http.StatusConflict, "starting job", err)
+		return
+	} else if err != nil {
+		log.Error("failed-queueing-job", err)
+		HTTPError(w, http.StatusInternalServerError, "starting job", err)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
-	go pipeline.StartJob(log, sn.config, sn.db, job)
+	go pipeline.StartQueuedJob(log, sn.config, sn.db, job)
+}
+
+// CancelJob cancels a job that didn't start running yet
+func (sn *SnickersServer) CancelJob(w http.ResponseWriter, r *http.Request) {
+	log := sn.logger.Session("cancel-job")
+	log.Debug("started")
+	defer log.Debug("finished")
+
+	vars := mux.Vars(r)
+	jobID := vars["jobID"]
+	if _, err := sn.retrieveJob(r, jobID); err != nil {
+		log.Error("failed-retrieving-job", err)
+		HTTPError(w, http.StatusNotFound, "retrieving job", err)
+		return
+	}
+
+	job, err := pipeline.CancelJob(sn.db, jobID)
+	if err == pipeline.ErrNotCancelable {
+		HTTPError(w, http.StatusConflict, "canceling job", err)
+		return
+	} else if err != nil {
+		log.Error("failed-canceling-job", err)
+		HTTPError(w, http.StatusInternalServerError, "canceling job", err)
+		return
+	}
+
+	result, err := json.Marshal(job)
+	if err != nil {
+		log.Error("failed-packaging-job-data", err)
+		HTTPError(w, http.StatusInternalServerError, "packing job data", err)
+		return
+	}
+
+	log.Info("canceled", lager.Data{"id": job.ID})
+	fmt.Fprintf(w, "%s", result)
+}
+
+// withTimeEstimate fills in the estimated time remaining, in
+// seconds, for jobs that are running
+func withTimeEstimate(job types.Job) types.Job {
+	if remaining, ok := job.EstimateTimeRemaining(time.Now()); ok {
+		seconds := remaining.Seconds()
+		job.EstimatedTimeRemaining = &seconds
+	}
+	return job
+}
+
+// parseJobQuery reads the job listing parameters. Times are
+// in RFC 3339 format.
+func parseJobQuery(values url.Values) (types.JobQuery, error) {
+	query := types.JobQuery{
+		Status:      types.JobStatus(values.Get("status")),
+		PresetName:  values.Get("preset"),
+		Source:      values.Get("source"),
+		Destination: values.Get("destination"),
+		Sort:        values.Get("sort"),
+		Cursor:      values.Get("cursor"),
+	}
+
+	var err error
+	if value := values.Get("createdAfter"); value != "" {
+		if query.CreatedAfter, err = time.Parse(time.RFC3339, value); err != nil {
+			return query, fmt.Errorf("invalid createdAfter %q", value)
+		}
+	}
+	if value := values.Get("createdBefore"); value != "" {
+		if query.CreatedBefore, err = time.Parse(time.RFC3339, value); err != nil {
+			return query, fmt.Errorf("invalid createdBefore %q", value)
+		}
+	}
+	if value := values.Get("limit"); value != "" {
+		if query.Limit, err = strconv.Atoi(value); err != nil || query.Limit < 0 {
+			return query, fmt.Errorf("invalid limit %q", value)
+		}
+	}
+	return query, nil
 }
@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
+	"time"
 
 	"code.cloudfoundry.org/lager/lagertest"
 	"github.com/flavioribeiro/gonfig"
@@ -64,6 +66,68 @@ var _ = Describe("Job handler", func() {
 			Expect(job.Destination).To(BeIdenticalTo(input.Destination))
 		})
 
+		It("should keep the source checksum on the job", func() {
+			recorder := httptest.NewRecorder()
+			input.SourceChecksum = "md5:ce922d89a6c244fb0c5aff66bc46e9be"
+			data, _ := json.Marshal(input)
+			req, _ := http.NewRequest(http.MethodPost, "/jobs", bytes.NewReader(data))
+			sn.Handler().ServeHTTP(recorder, req)
+			Expect(recorder.Code).To(BeIdenticalTo(http.StatusCreated))
+
+			var jobBody map[string]interface{}
+			json.Unmarshal(recorder.Body.Bytes(), &jobBody)
+			job, err := dbInstance.RetrieveJob(jobBody["id"].(string))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(job.SourceChecksum).To(Equal(input.SourceChecksum))
+		})
+
+		It("should start jobs created with autoStart", func() {
+			recorder := httptest.NewRecorder()
+			input.AutoStart = true
+			data, _ := json.Marshal(input)
+			req, _ := http.NewRequest(http.MethodPost, "/jobs", bytes.NewReader(data))
+			sn.Handler().ServeHTTP(recorder, req)
+			Expect(recorder.Code).To(BeIdenticalTo(http.StatusCreated))
+
+			var job types.Job
+			json.Unmarshal(recorder.Body.Bytes(), &job)
+			Expect(job.Status).To(Equal(types.JobQueued))
+		})
+
+		It("should schedule jobs created with startAt", func() {
+			recorder := httptest.NewRecorder()
+			startAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+			input.StartAt = &startAt
+			data, _ := json.Marshal(input)
+			req, _ := http.NewRequest(http.MethodPost, "/jobs", bytes.NewReader(data))
+			sn.Handler().ServeHTTP(recorder, req)
+			Expect(recorder.Code).To(BeIdenticalTo(http.StatusCreated))
+
+			var job types.Job
+			json.Unmarshal(recorder.Body.Bytes(), &job)
+			Expect(job.Status).To(Equal(types.JobScheduled))
+			stored, _ := dbInstance.RetrieveJob(job.ID)
+			Expect(stored.StartAt.Equal(startAt)).To(BeTrue())
+		})
+
+		It("should refuse an invalid source checksum", func() {
+			recorder := httptest.NewRecorder()
+			input.SourceChecksum = "crc32:deadbeef"
+			data, _ := json.Marshal(input)
+			req, _ := http.NewRequest(http.MethodPost, "/jobs", bytes.NewReader(data))
+			sn.Handler().ServeHTTP(recorder, req)
+			Expect(recorder.Code).To(BeIdenticalTo(http.StatusBadRequest))
+		})
+
+		It("should refuse local sources", func() {
+			recorder := httptest.NewRecorder()
+			input.Source = "file:///etc/passwd"
+			data, _ := json.Marshal(input)
+			req, _ := http.NewRequest(http.MethodPost, "/jobs", bytes.NewReader(data))
+			sn.Handler().ServeHTTP(recorder, req)
+			Expect(recorder.Code).To(BeIdenticalTo(http.StatusBadRequest))
+		})
+
 		It("should get a given job details", func() {
 			var jobBody map[string]interface{}
 
@@ -74,6 +138,71 @@ var _ = Describe("Job handler", func() {
 			Expect(recorder.Code).To(BeIdenticalTo(http.StatusOK))
 			Expect(jobBody["id"]).To(BeIdenticalTo(respJobInputBody["id"]))
 			Expect(jobBody["status"]).To(BeIdenticalTo(respJobInputBody["status"]))
+			Expect(recorder.Header().Get("ETag")).To(Equal(`"0"`))
+		})
+
+		It("should not start a job that changed since the given version", func() {
+			jobID := respJobInputBody["id"].(string)
+			job, _ := dbInstance.RetrieveJob(jobID)
+			dbInstance.UpdateJob(jobID, job)
+
+			recorder := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/jobs/"+jobID+"/start", nil)
+			req.Header.Set("If-Match", `"0"`)
+			sn.Handler().ServeHTTP(recorder, req)
+			Expect(recorder.Code).To(BeIdenticalTo(http.StatusPreconditionFailed))
+
+			job, _ = dbInstance.RetrieveJob(jobID)
+			Expect(job.Status).To(Equal(types.JobCreated))
+		})
+
+		for _, status := range []types.JobStatus{types.JobFinished, types.JobEncoding, types.JobCanceled} {
+			status := status
+			It("should not start a job that is "+string(status), func() {
+				jobID := respJobInputBody["id"].(string)
+				job, _ := dbInstance.RetrieveJob(jobID)
+				job.Status = status
+				dbInstance.UpdateJob(jobID, job)
+
+				recorder := httptest.NewRecorder()
+				req, _ := http.NewRequest(http.MethodPost, "/jobs/"+jobID+"/start", nil)
+				sn.Handler().ServeHTTP(recorder, req)
+				Expect(recorder.Code).To(BeIdenticalTo(http.StatusConflict))
+
+				job, _ = dbInstance.RetrieveJob(jobID)
+				Expect(job.Status).To(Equal(status))
+			})
+		}
+
+		It("should cancel a job that didn't start running", func() {
+			jobID := respJobInputBody["id"].(string)
+			recorder := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/jobs/"+jobID+"/cancel", nil)
+			sn.Handler().ServeHTTP(recorder, req)
+			Expect(recorder.Code).To(BeIdenticalTo(http.StatusOK))
+
+			job, _ := dbInstance.RetrieveJob(jobID)
+			Expect(job.Status).To(Equal(types.JobCanceled))
+			Expect(job.FinishedAt).NotTo(BeNil())
+		})
+
+		It("should not cancel a running job", func() {
+			jobID := respJobInputBody["id"].(string)
+			job, _ := dbInstance.RetrieveJob(jobID)
+			job.Status = types.JobEncoding
+			dbInstance.UpdateJob(jobID, job)
+
+			recorder := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/jobs/"+jobID+"/cancel", nil)
+			sn.Handler().ServeHTTP(recorder, req)
+			Expect(recorder.Code).To(BeIdenticalTo(http.StatusConflict))
+		})
+
+		It("should not find a missing job to cancel", func() {
+			recorder := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/jobs/missing/cancel", nil)
+			sn.Handler().ServeHTTP(recorder, req)
+			Expect(recorder.Code).To(BeIdenticalTo(http.StatusNotFound))
 		})
 
 		It("should list all jobs", func() {
@@ -97,5 +226,75 @@ var _ = Describe("Job handler", func() {
 			Expect(listRecorder.Code).To(BeIdenticalTo(http.StatusOK))
 			Expect(len(jobListBody)).To(Equal(2))
 		})
+
+		It("should paginate the job list", func() {
+			secondInput := input
+			secondInput.Source = "http://s3.example.com/videos/video2.mov"
+			data, _ := json.Marshal(secondInput)
+			req, _ := http.NewRequest(http.MethodPost, "/jobs", bytes.NewReader(data))
+			sn.Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+			listRecorder := httptest.NewRecorder()
+			listJobsRequest, _ := http.NewRequest(http.MethodGet, "/jobs?limit=1&sort=id", nil)
+			sn.Handler().ServeHTTP(listRecorder, listJobsRequest)
+			Expect(listRecorder.Code).To(BeIdenticalTo(http.StatusOK))
+
+			var firstPage []map[string]interface{}
+			json.Unmarshal(listRecorder.Body.Bytes(), &firstPage)
+			Expect(firstPage).To(HaveLen(1))
+
+			link := listRecorder.Header().Get("Link")
+			Expect(link).To(HavePrefix("</jobs?"))
+			Expect(link).To(HaveSuffix(`>; rel="next"`))
+
+			nextRecorder := httptest.NewRecorder()
+			nextRequest, _ := http.NewRequest(http.MethodGet, strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`), nil)
+			sn.Handler().ServeHTTP(nextRecorder, nextRequest)
+
+			var secondPage []map[string]interface{}
+			json.Unmarshal(nextRecorder.Body.Bytes(), &secondPage)
+			Expect(secondPage).To(HaveLen(1))
+			Expect(secondPage[0]["id"]).NotTo(Equal(firstPage[0]["id"]))
+			Expect(nextRecorder.Header().Get("Link")).To(BeEmpty())
+		})
+
+		It("should filter the job list", func() {
+			listRecorder := httptest.NewRecorder()
+			listJobsRequest, _ := http.NewRequest(http.MethodGet, "/jobs?status=finished", nil)
+			sn.Handler().ServeHTTP(listRecorder, listJobsRequest)
+
+			var jobListBody []map[string]interface{}
+			json.Unmarshal(listRecorder.Body.Bytes(), &jobListBody)
+			Expect(listRecorder.Code).To(BeIdenticalTo(http.StatusOK))
+			Expect(jobListBody).To(BeEmpty())
+		})
+
+		It("should estimate the time remaining of running jobs", func() {
+			startedAt := time.Now().Add(-time.Minute)
+			dbInstance.StoreJob(types.Job{
+				ID:       "running",
+				Status:   types.JobEncoding,
+				Progress: types.NewProgress(types.StageEncode, 50, 100, types.ProgressFrames, 0),
+				Stages:   []types.StageTiming{{Stage: types.StageEncode, StartedAt: startedAt}},
+			})
+
+			recorder := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/jobs/running", nil)
+			sn.Handler().ServeHTTP(recorder, req)
+
+			var jobBody map[string]interface{}
+			json.Unmarshal(recorder.Body.Bytes(), &jobBody)
+			Expect(jobBody["estimatedTimeRemaining"]).To(BeNumerically("~", 60, 1))
+			Expect(jobBody).NotTo(HaveKey("finishedAt"))
+		})
+
+		It("should refuse invalid list parameters", func() {
+			for _, params := range []string{"limit=abc", "createdAfter=yesterday", "sort=status", "cursor=!!"} {
+				listRecorder := httptest.NewRecorder()
+				listJobsRequest, _ := http.NewRequest(http.MethodGet, "/jobs?"+params, nil)
+				sn.Handler().ServeHTTP(listRecorder, listJobsRequest)
+				Expect(listRecorder.Code).To(BeIdenticalTo(http.StatusBadRequest))
+			}
+		})
 	})
 })
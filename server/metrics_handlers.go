@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/snickers/snickers/metrics"
+	"github.com/snickers/snickers/pipeline"
+)
+
+// newRegistry returns the registry of the metrics read from the
+// storage and the pipeline at scrape time
+func newRegistry(sn *SnickersServer) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics.NewJobsCollector(sn.db))
+	registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Name:      "running_jobs",
+		Help:      "Jobs running on this process.",
+	}, func() float64 {
+		return float64(len(pipeline.Jobs.Running()))
+	}))
+	return registry
+}
+
+// Metrics exposes the metrics of Snickers to Prometheus
+func (sn *SnickersServer) Metrics(w http.ResponseWriter, r *http.Request) {
+	log := sn.logger.Session("metrics")
+	log.Debug("started")
+	defer log.Debug("finished")
+
+	gatherers := prometheus.Gatherers{prometheus.DefaultGatherer, sn.registry}
+	promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// instrument observes the latency of the requests to a route,
+// labelled by its path template rather than the requested path
+func instrument(route RouterArguments, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		handler(recorder, r)
+
+		code := strconv.Itoa(recorder.status)
+		metrics.HTTPRequestDuration.WithLabelValues(route.Method, route.Path, code).Observe(time.Since(start).Seconds())
+	}
+}
+
+// statusRecorder keeps the status code written to a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps the event streams working through the recorder
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/flavioribeiro/gonfig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/pipeline"
+	"github.com/snickers/snickers/types"
+)
+
+var _ = Describe("Metrics handler", func() {
+	var (
+		sn         *SnickersServer
+		dbInstance db.Storage
+	)
+
+	getMetrics := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/metrics", nil)
+		sn.Handler().ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	BeforeEach(func() {
+		currentDir, _ := os.Getwd()
+		cfg, _ := gonfig.FromJsonFile(currentDir + "/../fixtures/config.json")
+		dbInstance, _ = db.GetDatabase(cfg)
+		dbInstance.ClearDatabase()
+		sn = New(lagertest.NewTestLogger("metrics-handler"), cfg, "tcp", ":8000", dbInstance)
+		pipeline.Jobs = pipeline.NewJobTracker()
+	})
+
+	AfterEach(func() {
+		dbInstance.ClearDatabase()
+		pipeline.Jobs = pipeline.NewJobTracker()
+	})
+
+	It("should expose the jobs by status", func() {
+		dbInstance.StoreJob(types.Job{ID: "123", Status: types.JobEncoding})
+		dbInstance.StoreJob(types.Job{ID: "456", Status: types.JobFinished})
+
+		recorder := getMetrics()
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Body.String()).To(ContainSubstring(`snickers_jobs{status="encoding"} 1`))
+		Expect(recorder.Body.String()).To(ContainSubstring(`snickers_jobs{status="finished"} 1`))
+		Expect(recorder.Body.String()).To(ContainSubstring(`snickers_jobs{status="created"} 0`))
+	})
+
+	It("should expose the jobs running on this process", func() {
+		pipeline.Jobs.Acquire("123")
+
+		Expect(getMetrics().Body.String()).To(ContainSubstring("snickers_running_jobs 1"))
+	})
+
+	It("should expose the latency of the requests by route", func() {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/jobs/123", nil)
+		sn.Handler().ServeHTTP(recorder, req)
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+
+		body := getMetrics().Body.String()
+		Expect(body).To(ContainSubstring(`snickers_http_request_duration_seconds_count{code="400",method="GET",route="/jobs/{jobID}"}`))
+	})
+
+	It("should expose the pipeline metrics", func() {
+		body := getMetrics().Body.String()
+		Expect(body).To(ContainSubstring("snickers_downloaded_bytes_total"))
+		Expect(body).To(ContainSubstring("snickers_uploaded_bytes_total"))
+		Expect(body).To(ContainSubstring("snickers_queue_depth"))
+	})
+})
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/gorilla/mux"
+	"github.com/snickers/snickers/helpers"
+)
+
+// outputContentTypes covers the HLS extensions that aren't on
+// every mime database
+var outputContentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+}
+
+// GetJobOutput serves a file of a job with local:// destination.
+// Range requests are supported so outputs can be played from here.
+func (sn *SnickersServer) GetJobOutput(w http.ResponseWriter, r *http.Request) {
+	log := sn.logger.Session("get-job-output")
+	log.Debug("started")
+	defer log.Debug("finished")
+
+	vars := mux.Vars(r)
+	if _, err := sn.retrieveJob(r, vars["jobID"]); err != nil {
+		HTTPError(w, http.StatusNotFound, "retrieving output", errors.New("output not found"))
+		return
+	}
+
+	outputDir, err := helpers.GetLocalOutputDirectory(sn.config)
+	if err != nil {
+		log.Error("failed-getting-output-directory", err)
+		HTTPError(w, http.StatusInternalServerError, "getting output directory", err)
+		return
+	}
+
+	// cleaning the rooted path keeps requests inside the job folder
+	outputPath := path.Clean("/" + vars["path"])
+	filePath := filepath.Join(outputDir, path.Base("/"+vars["jobID"]), filepath.FromSlash(outputPath))
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		HTTPError(w, http.StatusNotFound, "retrieving output", errors.New("output not found"))
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		HTTPError(w, http.StatusNotFound, "retrieving output", errors.New("output not found"))
+		return
+	}
+
+	contentType, ok := outputContentTypes[path.Ext(outputPath)]
+	if !ok {
+		contentType = mime.TypeByExtension(path.Ext(outputPath))
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	} else {
+		// let ServeContent sniff it instead of the JSON default
+		w.Header().Del("Content-Type")
+	}
+
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/flavioribeiro/gonfig"
+	"github.com/gorilla/mux"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/helpers"
+	"github.com/snickers/snickers/types"
+)
+
+var _ = Describe("Output handlers", func() {
+	var (
+		sn        *SnickersServer
+		outputDir string
+	)
+
+	BeforeEach(func() {
+		currentDir, _ := os.Getwd()
+		cfg, _ := gonfig.FromJsonFile(currentDir + "/../fixtures/config.json")
+		dbInstance, _ := db.GetDatabase(cfg)
+		sn = New(lagertest.NewTestLogger("output-handlers"), cfg, "tcp", ":8000", dbInstance)
+		dbInstance.StoreJob(types.Job{ID: "123"})
+
+		outputDir, _ = helpers.GetLocalOutputDirectory(cfg)
+		os.MkdirAll(filepath.Join(outputDir, "123", "hls_240p"), 0700)
+		ioutil.WriteFile(filepath.Join(outputDir, "123", "hls_240p", "video.m3u8"), []byte("#EXTM3U"), 0600)
+		ioutil.WriteFile(filepath.Join(outputDir, "123", "video_240p.mp4"), []byte("snickers"), 0600)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(filepath.Join(outputDir, "123"))
+	})
+
+	getOutput := func(url string, rangeHeader string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		sn.Handler().ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	It("should serve an output with its content type", func() {
+		recorder := getOutput("/jobs/123/outputs/video_240p.mp4", "")
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Header().Get("Content-Type")).To(Equal("video/mp4"))
+		Expect(recorder.Body.String()).To(Equal("snickers"))
+	})
+
+	It("should serve files inside output folders", func() {
+		recorder := getOutput("/jobs/123/outputs/hls_240p/video.m3u8", "")
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Header().Get("Content-Type")).To(Equal("application/vnd.apple.mpegurl"))
+	})
+
+	It("should support range requests", func() {
+		recorder := getOutput("/jobs/123/outputs/video_240p.mp4", "bytes=3-5")
+		Expect(recorder.Code).To(Equal(http.StatusPartialContent))
+		Expect(recorder.Header().Get("Content-Range")).To(Equal("bytes 3-5/8"))
+		Expect(recorder.Body.String()).To(Equal("cke"))
+	})
+
+	It("should return not found for missing outputs", func() {
+		recorder := getOutput("/jobs/123/outputs/missing.mp4", "")
+		Expect(recorder.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should not serve files outside the job folder", func() {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/jobs/123/outputs/passwd", nil)
+		req = mux.SetURLVars(req, map[string]string{"jobID": "123", "path": "../../../etc/passwd"})
+		sn.GetJobOutput(recorder, req)
+		Expect(recorder.Code).To(Equal(http.StatusNotFound))
+	})
+})
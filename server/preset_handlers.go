@@ -2,11 +2,13 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"code.cloudfoundry.org/lager"
 	"github.com/gorilla/mux"
+	"github.com/snickers/snickers/db"
 	"github.com/snickers/snickers/types"
 )
 
@@ -23,13 +25,21 @@ func (sn *SnickersServer) CreatePreset(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := sn.db.StorePreset(preset)
+	owner, err := presetOwner(r)
+	if err != nil {
+		HTTPError(w, http.StatusForbidden, "storing preset", err)
+		return
+	}
+	preset.Owner = owner
+
+	preset, err = sn.db.StorePreset(preset)
 	if err != nil {
 		log.Error("failed-storing-preset", err)
 		HTTPError(w, http.StatusBadRequest, "storing preset", err)
 		return
 	}
 
+	w.Header().Set("ETag", versionETag(preset.Version))
 	w.WriteHeader(http.StatusCreated)
 	result, err := json.Marshal(preset)
 	if err != nil {
@@ -41,7 +51,8 @@ func (sn *SnickersServer) CreatePreset(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "%s", result)
 }
 
-// UpdatePreset updates a preset
+// UpdatePreset updates a preset. With If-Match, the preset is
+// only updated if it's still on the given version.
 func (sn *SnickersServer) UpdatePreset(w http.ResponseWriter, r *http.Request) {
 	log := sn.logger.Session("update-preset")
 	log.Debug("started")
@@ -54,20 +65,39 @@ func (sn *SnickersServer) UpdatePreset(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := sn.db.RetrievePreset(preset.Name)
+	owner, err := presetOwner(r)
+	if err != nil {
+		HTTPError(w, http.StatusForbidden, "updating preset", err)
+		return
+	}
+
+	current, err := sn.db.RetrievePreset(owner, preset.Name)
+	if err == nil && current.Owner != owner {
+		err = errors.New("preset not found")
+	}
 	if err != nil {
 		log.Error("failed-retrieving-preset", err)
 		HTTPError(w, http.StatusBadRequest, "retrieving preset", err)
 		return
 	}
+	if !matchesIfMatch(r, current.Version) {
+		HTTPError(w, http.StatusPreconditionFailed, "updating preset", db.ErrVersionConflict)
+		return
+	}
 
-	_, err = sn.db.UpdatePreset(preset.Name, preset)
-	if err != nil {
+	preset.Version = current.Version
+	preset, err = sn.db.UpdatePreset(owner, preset.Name, preset)
+	if err == db.ErrVersionConflict {
+		log.Error("failed-updating-preset", err)
+		HTTPError(w, getUpdateErrorStatus(r, err), "updating preset", err)
+		return
+	} else if err != nil {
 		log.Error("failed-updating-preset", err)
 		HTTPError(w, http.StatusBadRequest, "updating preset", err)
 		return
 	}
 
+	w.Header().Set("ETag", versionETag(preset.Version))
 	w.WriteHeader(http.StatusOK)
 	result, err := json.Marshal(preset)
 	if err != nil {
@@ -79,13 +109,13 @@ func (sn *SnickersServer) UpdatePreset(w http.ResponseWriter, r *http.Request) {
 	log.Info("preset-updated", lager.Data{"preset-name": preset.Name})
 }
 
-// ListPresets list all presets available
+// ListPresets list the presets of the caller and the system presets
 func (sn *SnickersServer) ListPresets(w http.ResponseWriter, r *http.Request) {
 	log := sn.logger.Session("list-presets")
 	log.Debug("started")
 	defer log.Debug("finished")
 
-	presets, err := sn.db.GetPresets()
+	presets, err := sn.db.GetPresets(tenant(r))
 	if err != nil {
 		log.Error("failed-getting-preset", err)
 		HTTPError(w, http.StatusBadRequest, "getting presets", err)
@@ -109,7 +139,7 @@ func (sn *SnickersServer) GetPresetDetails(w http.ResponseWriter, r *http.Reques
 
 	vars := mux.Vars(r)
 	presetName := vars["presetName"]
-	preset, err := sn.db.RetrievePreset(presetName)
+	preset, err := sn.db.RetrievePreset(tenant(r), presetName)
 	if err != nil {
 		log.Error("failed-retrieving-preset", err)
 		HTTPError(w, http.StatusBadRequest, "retrieving preset", err)
@@ -123,6 +153,7 @@ func (sn *SnickersServer) GetPresetDetails(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	w.Header().Set("ETag", versionETag(preset.Version))
 	fmt.Fprintf(w, "%s", result)
 }
 
@@ -132,9 +163,15 @@ func (sn *SnickersServer) DeletePreset(w http.ResponseWriter, r *http.Request) {
 	log.Debug("started")
 	defer log.Debug("finished")
 
+	owner, err := presetOwner(r)
+	if err != nil {
+		HTTPError(w, http.StatusForbidden, "deleting preset", err)
+		return
+	}
+
 	vars := mux.Vars(r)
 	presetName := vars["presetName"]
-	_, err := sn.db.DeletePreset(presetName)
+	_, err = sn.db.DeletePreset(owner, presetName)
 	if err != nil {
 		log.Error("failed-deleting-preset", err)
 		HTTPError(w, http.StatusBadRequest, "deleting preset", err)
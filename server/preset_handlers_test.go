@@ -9,6 +9,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path"
+	"strconv"
 
 	"code.cloudfoundry.org/lager/lagertest"
 
@@ -64,9 +65,12 @@ var _ = Describe("Preset Handlers", func() {
 		return resp
 	}
 
-	updatePreset := func(body io.Reader) *http.Response {
+	updatePreset := func(body io.Reader, ifMatch ...string) *http.Response {
 		req, err := http.NewRequest(http.MethodPut, testServer.URL+"/presets", body)
 		Expect(err).NotTo(HaveOccurred())
+		for _, etag := range ifMatch {
+			req.Header.Add("If-Match", etag)
+		}
 
 		resp, err := client.Do(req)
 		Expect(err).NotTo(HaveOccurred())
@@ -128,6 +132,20 @@ var _ = Describe("Preset Handlers", func() {
 			preset = bytes.NewBufferString(`{"name":"foobar"}`)
 			updatePresetResp = updatePreset(preset)
 			Expect(updatePresetResp.StatusCode).To(Equal(http.StatusOK))
+			Expect(updatePresetResp.Header.Get("ETag")).To(Equal(`"1"`))
+		})
+
+		It("refuses updates made on top of an outdated version", func() {
+			preset = bytes.NewBufferString(`{"name":"foobar","description":"outdated"}`)
+			updatePresetResp = updatePreset(preset, `"0"`)
+			Expect(updatePresetResp.StatusCode).To(Equal(http.StatusPreconditionFailed))
+		})
+
+		It("updates the preset when If-Match has its version", func() {
+			preset = bytes.NewBufferString(`{"name":"foobar"}`)
+			updatePresetResp = updatePreset(preset, `"1"`)
+			Expect(updatePresetResp.StatusCode).To(Equal(http.StatusOK))
+			Expect(updatePresetResp.Header.Get("ETag")).To(Equal(`"2"`))
 		})
 
 	})
@@ -143,19 +161,26 @@ var _ = Describe("Preset Handlers", func() {
 	})
 
 	Describe("GetPresetDetails", func() {
-		var (
-			preset            types.Preset
-			presetDetailsResp *http.Response
-		)
+		var preset types.Preset
+
+		BeforeEach(func() {
+			var err error
+			preset, err = dbInstance.StorePreset(types.Preset{Name: "details"})
+			Expect(err).NotTo(HaveOccurred())
+			preset, err = dbInstance.UpdatePreset(preset.Owner, preset.Name, preset)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			dbInstance.DeletePreset(preset.Owner, preset.Name)
+		})
 
 		It("returns preset details", func() {
-			preset = types.Preset{
-				Name: "foobar",
-			}
-			presetDetailsResp = presetDetails(preset.Name)
+			presetDetailsResp := presetDetails(preset.Name)
 			body, err := ioutil.ReadAll(presetDetailsResp.Body)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(presetDetailsResp.StatusCode).To(Equal(http.StatusOK))
+			Expect(presetDetailsResp.Header.Get("ETag")).To(Equal(strconv.Quote(strconv.FormatInt(preset.Version, 10))))
 
 			jsonPreset, err := json.Marshal(preset)
 			Expect(err).NotTo(HaveOccurred())
@@ -0,0 +1,16 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/snickers/snickers/pipeline"
+)
+
+// getQuotaErrorStatus is 429 for exceeded quotas and 500 for
+// failures checking them
+func getQuotaErrorStatus(err error) int {
+	if _, ok := err.(pipeline.QuotaExceededError); ok {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/snickers/snickers/types"
 )
 
 type Router struct {
@@ -18,6 +19,10 @@ type RouterArguments struct {
 	Handler http.HandlerFunc
 	Path    string
 	Method  string
+
+	// Scope is what the API key of the requests must be granted,
+	// routes without one are public
+	Scope types.APIScope
 }
 
 func NewRouter() *Router {
@@ -1,6 +1,10 @@
 package server
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/snickers/snickers/types"
+)
 
 type Route int
 
@@ -10,25 +14,57 @@ const (
 	ListJobs
 	GetJobDetails
 	StartJob
+	CancelJob
+	UploadSource
+	GetSourceUpload
+	ResumeSourceUpload
+	GetJobOutput
+	StreamJobEvents
+	StreamEvents
 	CreatePreset
 	UpdatePreset
 	ListPresets
 	GetPresetDetails
 	DeletePreset
+	Health
+	Metrics
+	CreateAPIKey
+	ListAPIKeys
+	RevokeAPIKey
 )
 
 var Routes = map[Route]RouterArguments{
 	//Job routes
-	CreateJob:     RouterArguments{Path: "/jobs", Method: http.MethodPost},
-	ListJobs:      RouterArguments{Path: "/jobs", Method: http.MethodGet},
-	GetJobDetails: RouterArguments{Path: "/jobs/{jobID}", Method: http.MethodGet},
-	DeleteJob:     RouterArguments{Path: "/jobs/{jobID}", Method: http.MethodDelete},
-	StartJob:      RouterArguments{Path: "/jobs/{jobID}/start", Method: http.MethodPost},
+	CreateJob:     RouterArguments{Path: "/jobs", Method: http.MethodPost, Scope: types.ScopeWriteJobs},
+	ListJobs:      RouterArguments{Path: "/jobs", Method: http.MethodGet, Scope: types.ScopeReadJobs},
+	GetJobDetails: RouterArguments{Path: "/jobs/{jobID}", Method: http.MethodGet, Scope: types.ScopeReadJobs},
+	DeleteJob:     RouterArguments{Path: "/jobs/{jobID}", Method: http.MethodDelete, Scope: types.ScopeWriteJobs},
+	StartJob:      RouterArguments{Path: "/jobs/{jobID}/start", Method: http.MethodPost, Scope: types.ScopeWriteJobs},
+	CancelJob:     RouterArguments{Path: "/jobs/{jobID}/cancel", Method: http.MethodPost, Scope: types.ScopeWriteJobs},
+	GetJobOutput:  RouterArguments{Path: "/jobs/{jobID}/outputs/{path:.+}", Method: http.MethodGet, Scope: types.ScopeReadJobs},
+
+	//Event routes
+	StreamJobEvents: RouterArguments{Path: "/jobs/{jobID}/events", Method: http.MethodGet, Scope: types.ScopeReadJobs},
+	StreamEvents:    RouterArguments{Path: "/events", Method: http.MethodGet, Scope: types.ScopeReadJobs},
+
+	//Source upload routes
+	UploadSource:       RouterArguments{Path: "/jobs/{jobID}/source", Method: http.MethodPost, Scope: types.ScopeWriteJobs},
+	GetSourceUpload:    RouterArguments{Path: "/jobs/{jobID}/source", Method: http.MethodHead, Scope: types.ScopeReadJobs},
+	ResumeSourceUpload: RouterArguments{Path: "/jobs/{jobID}/source", Method: http.MethodPatch, Scope: types.ScopeWriteJobs},
 
 	//Preset routes
-	CreatePreset:     RouterArguments{Path: "/presets", Method: http.MethodPost},
-	UpdatePreset:     RouterArguments{Path: "/presets", Method: http.MethodPut},
-	ListPresets:      RouterArguments{Path: "/presets", Method: http.MethodGet},
-	GetPresetDetails: RouterArguments{Path: "/presets/{presetName}", Method: http.MethodGet},
-	DeletePreset:     RouterArguments{Path: "/presets/{presetName}", Method: http.MethodDelete},
+	CreatePreset:     RouterArguments{Path: "/presets", Method: http.MethodPost, Scope: types.ScopeManagePresets},
+	UpdatePreset:     RouterArguments{Path: "/presets", Method: http.MethodPut, Scope: types.ScopeManagePresets},
+	ListPresets:      RouterArguments{Path: "/presets", Method: http.MethodGet, Scope: types.ScopeReadJobs},
+	GetPresetDetails: RouterArguments{Path: "/presets/{presetName}", Method: http.MethodGet, Scope: types.ScopeReadJobs},
+	DeletePreset:     RouterArguments{Path: "/presets/{presetName}", Method: http.MethodDelete, Scope: types.ScopeManagePresets},
+
+	//Health routes
+	Health:  RouterArguments{Path: "/healthz", Method: http.MethodGet},
+	Metrics: RouterArguments{Path: "/metrics", Method: http.MethodGet},
+
+	//API key routes
+	CreateAPIKey: RouterArguments{Path: "/apikeys", Method: http.MethodPost, Scope: types.ScopeAdmin},
+	ListAPIKeys:  RouterArguments{Path: "/apikeys", Method: http.MethodGet, Scope: types.ScopeAdmin},
+	RevokeAPIKey: RouterArguments{Path: "/apikeys/{keyID}", Method: http.MethodDelete, Scope: types.ScopeAdmin},
 }
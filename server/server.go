@@ -1,12 +1,17 @@
 package server
 
 import (
+	"context"
 	"net"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/flavioribeiro/gonfig"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/events"
+	"github.com/snickers/snickers/pipeline"
 
 	"code.cloudfoundry.org/lager"
 )
@@ -20,8 +25,15 @@ type SnickersServer struct {
 	router        *Router
 	server        *http.Server
 	db            db.Storage
+	events        *events.Bus
+	registry      *prometheus.Registry
+	done          chan struct{}
 }
 
+// shutdownGrace is how long open connections get to finish once
+// the jobs are drained, before they are closed
+const shutdownGrace = 5 * time.Second
+
 func New(log lager.Logger, config gonfig.Gonfig, listenNetwork string, listenAddr string, db db.Storage) *SnickersServer {
 	s := &SnickersServer{
 		logger:        log.Session("snickers-server"),
@@ -30,24 +42,40 @@ func New(log lager.Logger, config gonfig.Gonfig, listenNetwork string, listenAdd
 		router:        NewRouter(),
 		config:        config,
 		db:            db,
+		events:        events.DefaultBus,
+		done:          make(chan struct{}),
 	}
+	s.registry = newRegistry(s)
 
 	s.logger.Debug("setting-up-routes")
 	// Set up routes
 	routes := map[Route]RouterArguments{
-		CreateJob:        {Path: Routes[CreateJob].Path, Method: Routes[CreateJob].Method, Handler: s.CreateJob},
-		ListJobs:         {Path: Routes[ListJobs].Path, Method: Routes[ListJobs].Method, Handler: s.ListJobs},
-		GetJobDetails:    {Path: Routes[GetJobDetails].Path, Method: Routes[GetJobDetails].Method, Handler: s.GetJobDetails},
-		DeleteJob:        {Path: Routes[DeleteJob].Path, Method: Routes[DeleteJob].Method, Handler: s.DeleteJob},
-		StartJob:         {Path: Routes[StartJob].Path, Method: Routes[StartJob].Method, Handler: s.StartJob},
-		CreatePreset:     {Path: Routes[CreatePreset].Path, Method: Routes[CreatePreset].Method, Handler: s.CreatePreset},
-		UpdatePreset:     {Path: Routes[UpdatePreset].Path, Method: Routes[UpdatePreset].Method, Handler: s.UpdatePreset},
-		ListPresets:      {Path: Routes[ListPresets].Path, Method: Routes[ListPresets].Method, Handler: s.ListPresets},
-		GetPresetDetails: {Path: Routes[GetPresetDetails].Path, Method: Routes[GetPresetDetails].Method, Handler: s.GetPresetDetails},
-		DeletePreset:     {Path: Routes[DeletePreset].Path, Method: Routes[DeletePreset].Method, Handler: s.DeletePreset},
+		CreateJob:          {Path: Routes[CreateJob].Path, Method: Routes[CreateJob].Method, Handler: s.CreateJob},
+		ListJobs:           {Path: Routes[ListJobs].Path, Method: Routes[ListJobs].Method, Handler: s.ListJobs},
+		GetJobDetails:      {Path: Routes[GetJobDetails].Path, Method: Routes[GetJobDetails].Method, Handler: s.GetJobDetails},
+		DeleteJob:          {Path: Routes[DeleteJob].Path, Method: Routes[DeleteJob].Method, Handler: s.DeleteJob},
+		StartJob:           {Path: Routes[StartJob].Path, Method: Routes[StartJob].Method, Handler: s.StartJob},
+		CancelJob:          {Path: Routes[CancelJob].Path, Method: Routes[CancelJob].Method, Handler: s.CancelJob},
+		GetJobOutput:       {Path: Routes[GetJobOutput].Path, Method: Routes[GetJobOutput].Method, Handler: s.GetJobOutput},
+		StreamJobEvents:    {Path: Routes[StreamJobEvents].Path, Method: Routes[StreamJobEvents].Method, Handler: s.StreamJobEvents},
+		StreamEvents:       {Path: Routes[StreamEvents].Path, Method: Routes[StreamEvents].Method, Handler: s.StreamEvents},
+		UploadSource:       {Path: Routes[UploadSource].Path, Method: Routes[UploadSource].Method, Handler: s.UploadSource},
+		GetSourceUpload:    {Path: Routes[GetSourceUpload].Path, Method: Routes[GetSourceUpload].Method, Handler: s.GetSourceUpload},
+		ResumeSourceUpload: {Path: Routes[ResumeSourceUpload].Path, Method: Routes[ResumeSourceUpload].Method, Handler: s.ResumeSourceUpload},
+		CreatePreset:       {Path: Routes[CreatePreset].Path, Method: Routes[CreatePreset].Method, Handler: s.CreatePreset},
+		UpdatePreset:       {Path: Routes[UpdatePreset].Path, Method: Routes[UpdatePreset].Method, Handler: s.UpdatePreset},
+		ListPresets:        {Path: Routes[ListPresets].Path, Method: Routes[ListPresets].Method, Handler: s.ListPresets},
+		GetPresetDetails:   {Path: Routes[GetPresetDetails].Path, Method: Routes[GetPresetDetails].Method, Handler: s.GetPresetDetails},
+		DeletePreset:       {Path: Routes[DeletePreset].Path, Method: Routes[DeletePreset].Method, Handler: s.DeletePreset},
+		Health:             {Path: Routes[Health].Path, Method: Routes[Health].Method, Handler: s.Health},
+		Metrics:            {Path: Routes[Metrics].Path, Method: Routes[Metrics].Method, Handler: s.Metrics},
+		CreateAPIKey:       {Path: Routes[CreateAPIKey].Path, Method: Routes[CreateAPIKey].Method, Handler: s.CreateAPIKey},
+		ListAPIKeys:        {Path: Routes[ListAPIKeys].Path, Method: Routes[ListAPIKeys].Method, Handler: s.ListAPIKeys},
+		RevokeAPIKey:       {Path: Routes[RevokeAPIKey].Path, Method: Routes[RevokeAPIKey].Method, Handler: s.RevokeAPIKey},
 	}
-	for _, route := range routes {
-		s.router.AddHandler(RouterArguments{Path: route.Path, Method: route.Method, Handler: route.Handler})
+	for name, route := range routes {
+		handler := s.authenticate(Routes[name].Scope, route.Handler)
+		s.router.AddHandler(RouterArguments{Path: route.Path, Method: route.Method, Handler: instrument(route, handler)})
 	}
 
 	s.server = &http.Server{
@@ -105,3 +133,28 @@ func (sn *SnickersServer) Stop() error {
 
 	return sn.Listener.Close()
 }
+
+// Shutdown stops accepting jobs and waits up to timeout for the
+// running ones to end, then closes the server. The health endpoint
+// reports the drain meanwhile. Jobs still running by then are left
+// for the recovery of the next process.
+func (sn *SnickersServer) Shutdown(timeout time.Duration) error {
+	log := sn.logger.Session("shutdown")
+	log.Info("draining", lager.Data{"running-jobs": pipeline.Jobs.Running(), "timeout": timeout.String()})
+
+	if unfinished := pipeline.Jobs.Drain(timeout); len(unfinished) > 0 {
+		log.Info("left-for-recovery", lager.Data{"jobs": unfinished})
+	}
+
+	// event streams never go idle, so they are ended first
+	close(sn.done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+	defer cancel()
+	if err := sn.server.Shutdown(ctx); err != nil {
+		log.Error("failed-closing-connections", err)
+		return sn.server.Close()
+	}
+	log.Info("stopped")
+	return nil
+}
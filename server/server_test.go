@@ -1,10 +1,13 @@
 package server_test
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"time"
@@ -16,6 +19,7 @@ import (
 
 	"github.com/flavioribeiro/gonfig"
 	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/pipeline"
 	"github.com/snickers/snickers/server"
 )
 
@@ -88,6 +92,26 @@ var _ = Describe("Snickers Server", func() {
 				})
 			})
 		})
+
+		Describe("Shutdown", func() {
+			AfterEach(func() {
+				pipeline.Jobs = pipeline.NewJobTracker()
+			})
+
+			It("waits for the running jobs and closes the server", func() {
+				pipeline.Jobs.Acquire("123")
+				go func() {
+					time.Sleep(50 * time.Millisecond)
+					pipeline.Jobs.Release("123")
+				}()
+
+				Expect(snickersServer.Shutdown(time.Minute)).To(Succeed())
+				Expect(pipeline.Jobs.Running()).To(BeEmpty())
+
+				_, err := net.Dial("unix", socketPath)
+				Expect(err).To(HaveOccurred())
+			})
+		})
 	})
 
 	Context("when passed a tcp addr", func() {
@@ -110,4 +134,16 @@ var _ = Describe("Snickers Server", func() {
 			}
 		})
 	})
+
+	Describe("HTTPError", func() {
+		It("should answer the error as JSON", func() {
+			recorder := httptest.NewRecorder()
+			server.HTTPError(recorder, http.StatusBadRequest, "validating api key", errors.New(`unknown scope "jobs:everything"`))
+
+			var body map[string]string
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &body)).To(Succeed())
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(body).To(Equal(map[string]string{"error": `validating api key: unknown scope "jobs:everything"`}))
+		})
+	})
 })
@@ -0,0 +1,316 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/gorilla/mux"
+	"github.com/snickers/snickers/helpers"
+	"github.com/snickers/snickers/pipeline"
+	"github.com/snickers/snickers/types"
+)
+
+// TusResumable is the version of the tus protocol spoken by the
+// resumable source upload endpoints
+const TusResumable = "1.0.0"
+
+// UploadSource receives the job source on the request body. When
+// the body is empty and Upload-Length is set, it creates a
+// resumable upload to be sent in chunks with PATCH instead.
+func (sn *SnickersServer) UploadSource(w http.ResponseWriter, r *http.Request) {
+	log := sn.logger.Session("upload-source")
+	log.Debug("started")
+	defer log.Debug("finished")
+
+	w.Header().Set("Tus-Resumable", TusResumable)
+	job, status, err := sn.retrieveUploadableJob(r, mux.Vars(r)["jobID"])
+	if err != nil {
+		log.Error("failed-retrieving-job", err)
+		HTTPError(w, status, "retrieving job", err)
+		return
+	}
+
+	filename, err := getUploadFilename(r, job)
+	if err != nil {
+		log.Error("failed-getting-filename", err)
+		HTTPError(w, http.StatusBadRequest, "getting filename", err)
+		return
+	}
+
+	maxSize, err := sn.config.GetInt("MAX_SOURCE_SIZE", 0)
+	if err != nil {
+		log.Error("failed-getting-max-source-size", err)
+		HTTPError(w, http.StatusInternalServerError, "getting max source size", err)
+		return
+	}
+
+	incoming := r.ContentLength
+	if length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64); err == nil && incoming <= 0 {
+		incoming = length
+	}
+	if err := pipeline.CheckStorageQuota(sn.config, sn.db, job.Owner, incoming); err != nil {
+		log.Error("failed-checking-quota", err)
+		HTTPError(w, getQuotaErrorStatus(err), "uploading source", err)
+		return
+	}
+
+	localSource, err := sn.getUploadPath(job.ID, filename)
+	if err != nil {
+		log.Error("failed-getting-local-source", err)
+		HTTPError(w, http.StatusInternalServerError, "getting local source", err)
+		return
+	}
+
+	file, err := os.Create(localSource)
+	if err != nil {
+		log.Error("failed-creating-local-source", err)
+		HTTPError(w, http.StatusInternalServerError, "creating local source", err)
+		return
+	}
+	defer file.Close()
+
+	job.Source = "upload://" + filename
+	job.Upload = &types.SourceUpload{Filename: filename}
+
+	if uploadLength := r.Header.Get("Upload-Length"); uploadLength != "" && r.ContentLength <= 0 {
+		length, err := strconv.ParseInt(uploadLength, 10, 64)
+		if err != nil || length < 0 {
+			HTTPError(w, http.StatusBadRequest, "parsing Upload-Length", errors.New("invalid length "+uploadLength))
+			return
+		}
+		if maxSize > 0 && length > int64(maxSize) {
+			HTTPError(w, http.StatusRequestEntityTooLarge, "creating upload", fmt.Errorf("source exceeds the maximum of %d bytes", maxSize))
+			return
+		}
+
+		job.Upload.Length = length
+		job.Upload.Complete = length == 0
+		if _, err := sn.db.UpdateJob(job.ID, job); err != nil {
+			log.Error("failed-updating-job", err)
+			HTTPError(w, getUpdateErrorStatus(r, err), "updating job", err)
+			return
+		}
+
+		w.Header().Set("Location", "/jobs/"+job.ID+"/source")
+		w.Header().Set("Upload-Offset", "0")
+		w.WriteHeader(http.StatusCreated)
+		log.Info("upload-created", lager.Data{"id": job.ID, "length": length})
+		return
+	}
+
+	written, err := copyUpload(file, r.Body, int64(maxSize))
+	if err != nil {
+		log.Error("failed-writing-source", err)
+		os.Remove(localSource)
+		HTTPError(w, getUploadErrorStatus(err), "writing source", err)
+		return
+	}
+
+	job.Upload.Length = written
+	job.Upload.Offset = written
+	job.Upload.Complete = true
+	if _, err := sn.db.UpdateJob(job.ID, job); err != nil {
+		log.Error("failed-updating-job", err)
+		HTTPError(w, getUpdateErrorStatus(r, err), "updating job", err)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(written, 10))
+	w.WriteHeader(http.StatusCreated)
+	log.Info("source-uploaded", lager.Data{"id": job.ID, "size": written})
+}
+
+// GetSourceUpload tells how much of a resumable upload was
+// already received
+func (sn *SnickersServer) GetSourceUpload(w http.ResponseWriter, r *http.Request) {
+	log := sn.logger.Session("get-source-upload")
+	log.Debug("started")
+	defer log.Debug("finished")
+
+	w.Header().Set("Tus-Resumable", TusResumable)
+	w.Header().Set("Cache-Control", "no-store")
+
+	job, err := sn.retrieveJob(r, mux.Vars(r)["jobID"])
+	if err != nil {
+		log.Error("failed-retrieving-job", err)
+		HTTPError(w, http.StatusNotFound, "retrieving job", err)
+		return
+	}
+	if job.Upload == nil {
+		HTTPError(w, http.StatusNotFound, "retrieving upload", errors.New("job has no source upload"))
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(job.Upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(job.Upload.Length, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+// ResumeSourceUpload appends a chunk to a resumable upload. The
+// Upload-Offset header must match what was received so far.
+func (sn *SnickersServer) ResumeSourceUpload(w http.ResponseWriter, r *http.Request) {
+	log := sn.logger.Session("resume-source-upload")
+	log.Debug("started")
+	defer log.Debug("finished")
+
+	w.Header().Set("Tus-Resumable", TusResumable)
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		HTTPError(w, http.StatusUnsupportedMediaType, "resuming upload", errors.New("content type must be application/offset+octet-stream"))
+		return
+	}
+
+	job, status, err := sn.retrieveUploadableJob(r, mux.Vars(r)["jobID"])
+	if err != nil {
+		log.Error("failed-retrieving-job", err)
+		HTTPError(w, status, "retrieving job", err)
+		return
+	}
+	if job.Upload == nil || job.Upload.Complete {
+		HTTPError(w, http.StatusConflict, "resuming upload", errors.New("job has no pending source upload"))
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset != job.Upload.Offset {
+		HTTPError(w, http.StatusConflict, "resuming upload", fmt.Errorf("expected Upload-Offset %d", job.Upload.Offset))
+		return
+	}
+
+	localSource, err := sn.getUploadPath(job.ID, job.Upload.Filename)
+	if err != nil {
+		log.Error("failed-getting-local-source", err)
+		HTTPError(w, http.StatusInternalServerError, "getting local source", err)
+		return
+	}
+
+	file, err := os.OpenFile(localSource, os.O_WRONLY, 0600)
+	if err != nil {
+		log.Error("failed-opening-local-source", err)
+		HTTPError(w, http.StatusInternalServerError, "opening local source", err)
+		return
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		log.Error("failed-seeking-local-source", err)
+		HTTPError(w, http.StatusInternalServerError, "seeking local source", err)
+		return
+	}
+
+	// a chunk that is cut short is still kept, so the client
+	// can resume from wherever it stopped
+	written, copyErr := copyUpload(file, r.Body, job.Upload.Length-offset)
+	job.Upload.Offset += written
+	job.Upload.Complete = job.Upload.Offset == job.Upload.Length
+	if _, err := sn.db.UpdateJob(job.ID, job); err != nil {
+		log.Error("failed-updating-job", err)
+		HTTPError(w, getUpdateErrorStatus(r, err), "updating job", err)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(job.Upload.Offset, 10))
+	if copyErr != nil {
+		log.Error("failed-writing-chunk", copyErr)
+		HTTPError(w, getUploadErrorStatus(copyErr), "writing chunk", copyErr)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	log.Info("chunk-received", lager.Data{"id": job.ID, "offset": job.Upload.Offset, "complete": job.Upload.Complete})
+}
+
+// retrieveUploadableJob returns the job if its source can still
+// be uploaded, along with the HTTP status to use otherwise
+func (sn *SnickersServer) retrieveUploadableJob(r *http.Request, jobID string) (types.Job, int, error) {
+	job, err := sn.retrieveJob(r, jobID)
+	if err != nil {
+		return types.Job{}, http.StatusNotFound, err
+	}
+	if job.Status != types.JobCreated && job.Status != types.JobScheduled {
+		return types.Job{}, http.StatusConflict, errors.New("source can only be uploaded before the job starts")
+	}
+	return job, http.StatusOK, nil
+}
+
+func (sn *SnickersServer) getUploadPath(jobID string, filename string) (string, error) {
+	sourceDir, err := helpers.GetLocalSourcePath(sn.config, jobID)
+	if err != nil {
+		return "", err
+	}
+	return sourceDir + filename, nil
+}
+
+// getUploadFilename takes the filename from the query string, the
+// tus Upload-Metadata header or the job source, in this order
+func getUploadFilename(r *http.Request, job types.Job) (string, error) {
+	filename := r.URL.Query().Get("filename")
+	if filename == "" {
+		filename = getUploadMetadata(r.Header.Get("Upload-Metadata"), "filename")
+	}
+	if filename == "" && job.Source != "" {
+		filename = path.Base(job.Source)
+	}
+
+	filename = path.Base(filename)
+	if filename == "" || filename == "." || filename == "/" || filename == ".." {
+		return "", errors.New("a filename is required")
+	}
+	return filename, nil
+}
+
+// getUploadMetadata decodes a key from a tus Upload-Metadata
+// header, formatted as "key base64value,key base64value"
+func getUploadMetadata(metadata string, key string) string {
+	for _, pair := range strings.Split(metadata, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), " ", 2)
+		if len(parts) == 2 && parts[0] == key {
+			value, err := base64.StdEncoding.DecodeString(parts[1])
+			if err == nil {
+				return string(value)
+			}
+		}
+	}
+	return ""
+}
+
+var errUploadTooLarge = errors.New("upload exceeds the expected size")
+
+// copyUpload copies at most limit bytes, or everything when limit
+// is zero, failing with errUploadTooLarge if there is more
+func copyUpload(dst io.Writer, src io.Reader, limit int64) (int64, error) {
+	if limit <= 0 {
+		if limit < 0 {
+			return 0, errUploadTooLarge
+		}
+		return io.Copy(dst, src)
+	}
+
+	written, err := io.Copy(dst, io.LimitReader(src, limit))
+	if err != nil {
+		return written, err
+	}
+
+	extra, err := src.Read(make([]byte, 1))
+	if extra > 0 {
+		return written, errUploadTooLarge
+	}
+	if err != nil && err != io.EOF {
+		return written, err
+	}
+	return written, nil
+}
+
+func getUploadErrorStatus(err error) int {
+	if err == errUploadTooLarge {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
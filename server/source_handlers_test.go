@@ -0,0 +1,154 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/flavioribeiro/gonfig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/helpers"
+	"github.com/snickers/snickers/types"
+)
+
+var _ = Describe("Source handlers", func() {
+	var (
+		dbInstance db.Storage
+		cfg        gonfig.Gonfig
+		sn         *SnickersServer
+		job        types.Job
+	)
+
+	BeforeEach(func() {
+		currentDir, _ := os.Getwd()
+		cfg, _ = gonfig.FromJsonFile(currentDir + "/../fixtures/config.json")
+		dbInstance, _ = db.GetDatabase(cfg)
+		dbInstance.ClearDatabase()
+		sn = New(lagertest.NewTestLogger("source-handlers"), cfg, "tcp", ":8000", dbInstance)
+
+		job = types.Job{
+			ID:          "source-upload",
+			Destination: "s3://example-bucket/future/",
+			Preset:      types.Preset{Name: "mp4_1080p", Container: "mp4"},
+			Status:      types.JobCreated,
+		}
+		dbInstance.StoreJob(job)
+	})
+
+	AfterEach(func() {
+		swapDir, _ := cfg.GetString("SWAP_DIRECTORY", "")
+		os.RemoveAll(swapDir + job.ID)
+	})
+
+	serve := func(method string, url string, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, bytes.NewReader(body))
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		sn.Handler().ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	localSource := func(filename string) string {
+		sourceDir, _ := helpers.GetLocalSourcePath(cfg, job.ID)
+		return sourceDir + filename
+	}
+
+	Context("streaming upload", func() {
+		It("should store the body on the job swap directory", func() {
+			recorder := serve(http.MethodPost, "/jobs/"+job.ID+"/source?filename=video.mov", []byte("snickers"), nil)
+			Expect(recorder.Code).To(Equal(http.StatusCreated))
+			Expect(recorder.Header().Get("Upload-Offset")).To(Equal("8"))
+			Expect(ioutil.ReadFile(localSource("video.mov"))).To(Equal([]byte("snickers")))
+
+			changedJob, _ := dbInstance.RetrieveJob(job.ID)
+			Expect(changedJob.Source).To(Equal("upload://video.mov"))
+			Expect(*changedJob.Upload).To(Equal(types.SourceUpload{Filename: "video.mov", Length: 8, Offset: 8, Complete: true}))
+		})
+
+		It("should require a filename", func() {
+			recorder := serve(http.MethodPost, "/jobs/"+job.ID+"/source", []byte("snickers"), nil)
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("should refuse uploads once the job started", func() {
+			job.Status = types.JobEncoding
+			dbInstance.UpdateJob(job.ID, job)
+			recorder := serve(http.MethodPost, "/jobs/"+job.ID+"/source?filename=video.mov", []byte("snickers"), nil)
+			Expect(recorder.Code).To(Equal(http.StatusConflict))
+		})
+
+		It("should refuse sources bigger than MAX_SOURCE_SIZE", func() {
+			sn.config, _ = gonfig.FromJson(strings.NewReader(`{"SWAP_DIRECTORY": "/tmp/", "MAX_SOURCE_SIZE": 4}`))
+			recorder := serve(http.MethodPost, "/jobs/"+job.ID+"/source?filename=video.mov", []byte("snickers"), nil)
+			Expect(recorder.Code).To(Equal(http.StatusRequestEntityTooLarge))
+			Expect(localSource("video.mov")).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Context("resumable upload", func() {
+		var patchHeaders func(offset string) map[string]string
+
+		BeforeEach(func() {
+			patchHeaders = func(offset string) map[string]string {
+				return map[string]string{
+					"Content-Type":  "application/offset+octet-stream",
+					"Upload-Offset": offset,
+					"Tus-Resumable": TusResumable,
+				}
+			}
+
+			recorder := serve(http.MethodPost, "/jobs/"+job.ID+"/source", nil, map[string]string{
+				"Upload-Length":   "8",
+				"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("video.mov")),
+				"Tus-Resumable":   TusResumable,
+			})
+			Expect(recorder.Code).To(Equal(http.StatusCreated))
+			Expect(recorder.Header().Get("Location")).To(Equal("/jobs/" + job.ID + "/source"))
+		})
+
+		It("should receive the source in chunks", func() {
+			recorder := serve(http.MethodPatch, "/jobs/"+job.ID+"/source", []byte("snic"), patchHeaders("0"))
+			Expect(recorder.Code).To(Equal(http.StatusNoContent))
+			Expect(recorder.Header().Get("Upload-Offset")).To(Equal("4"))
+
+			recorder = serve(http.MethodHead, "/jobs/"+job.ID+"/source", nil, nil)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("Upload-Offset")).To(Equal("4"))
+			Expect(recorder.Header().Get("Upload-Length")).To(Equal("8"))
+
+			recorder = serve(http.MethodPatch, "/jobs/"+job.ID+"/source", []byte("kers"), patchHeaders("4"))
+			Expect(recorder.Code).To(Equal(http.StatusNoContent))
+
+			changedJob, _ := dbInstance.RetrieveJob(job.ID)
+			Expect(changedJob.Upload.Complete).To(BeTrue())
+			Expect(ioutil.ReadFile(localSource("video.mov"))).To(Equal([]byte("snickers")))
+		})
+
+		It("should refuse chunks on the wrong offset", func() {
+			recorder := serve(http.MethodPatch, "/jobs/"+job.ID+"/source", []byte("kers"), patchHeaders("4"))
+			Expect(recorder.Code).To(Equal(http.StatusConflict))
+		})
+
+		It("should refuse chunks past the upload length", func() {
+			recorder := serve(http.MethodPatch, "/jobs/"+job.ID+"/source", []byte("snickers!"), patchHeaders("0"))
+			Expect(recorder.Code).To(Equal(http.StatusRequestEntityTooLarge))
+		})
+
+		It("should show the upload on the job details", func() {
+			recorder := serve(http.MethodGet, "/jobs/"+job.ID, nil, nil)
+			var jobBody map[string]interface{}
+			json.Unmarshal(recorder.Body.Bytes(), &jobBody)
+			Expect(jobBody["upload"]).To(HaveKeyWithValue("length", BeNumerically("==", 8)))
+		})
+	})
+})
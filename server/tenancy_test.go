@@ -0,0 +1,179 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/flavioribeiro/gonfig"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/pipeline"
+	"github.com/snickers/snickers/types"
+)
+
+var _ = Describe("Tenancy", func() {
+	var (
+		sn         *SnickersServer
+		dbInstance db.Storage
+		swapDir    string
+
+		teamA string
+		teamB string
+	)
+
+	request := func(method, path, key string, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer "+key)
+		sn.Handler().ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	storeKey := func(id string, tenant string, scopes ...types.APIScope) string {
+		secret := newAPIKeySecret(id)
+		dbInstance.StoreAPIKey(types.APIKey{ID: id, Tenant: tenant, Hash: hashAPIKey(secret), Scopes: scopes})
+		return secret
+	}
+
+	newServer := func(quotas string) {
+		cfg, _ := gonfig.FromJson(strings.NewReader(`{
+			"DATABASE_DRIVER": "memory",
+			"SWAP_DIRECTORY": "` + swapDir + `/",
+			"ADMIN_API_KEY": "admin-secret",
+			"TENANT_QUOTAS": ` + quotas + `
+		}`))
+		dbInstance, _ = db.GetDatabase(cfg)
+		sn = New(lagertest.NewTestLogger("tenancy"), cfg, "tcp", ":8000", dbInstance)
+	}
+
+	BeforeEach(func() {
+		swapDir, _ = ioutil.TempDir("", "tenancy")
+		newServer(`{}`)
+		dbInstance.ClearDatabase()
+		pipeline.Jobs = pipeline.NewJobTracker()
+
+		all := []types.APIScope{types.ScopeReadJobs, types.ScopeWriteJobs, types.ScopeManagePresets}
+		teamA = storeKey("a", "team-a", all...)
+		teamB = storeKey("b", "team-b", all...)
+	})
+
+	AfterEach(func() {
+		dbInstance.ClearDatabase()
+		pipeline.Jobs = pipeline.NewJobTracker()
+		os.RemoveAll(swapDir)
+	})
+
+	Describe("presets", func() {
+		It("should only show presets to their tenant", func() {
+			Expect(request(http.MethodPost, "/presets", teamA, `{"name": "720p"}`).Code).To(Equal(http.StatusCreated))
+
+			Expect(request(http.MethodGet, "/presets/720p", teamA, "").Code).To(Equal(http.StatusOK))
+			Expect(request(http.MethodGet, "/presets/720p", teamB, "").Code).To(Equal(http.StatusBadRequest))
+			Expect(request(http.MethodGet, "/presets", teamB, "").Body.String()).To(Equal("[]"))
+			Expect(request(http.MethodDelete, "/presets/720p", teamB, "").Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("should let tenants use the same preset names", func() {
+			Expect(request(http.MethodPost, "/presets", teamA, `{"name": "720p"}`).Code).To(Equal(http.StatusCreated))
+			Expect(request(http.MethodPost, "/presets", teamB, `{"name": "720p"}`).Code).To(Equal(http.StatusCreated))
+		})
+
+		It("should show system presets to every tenant", func() {
+			Expect(request(http.MethodPost, "/presets?system=true", "admin-secret", `{"name": "1080p"}`).Code).To(Equal(http.StatusCreated))
+
+			var preset types.Preset
+			recorder := request(http.MethodGet, "/presets/1080p", teamB, "")
+			json.Unmarshal(recorder.Body.Bytes(), &preset)
+			Expect(preset.Owner).To(Equal(types.SystemOwner))
+			Expect(request(http.MethodPost, "/jobs", teamA, `{"source": "http://source.here.mp4", "destination": "s3://dst", "preset": "1080p"}`).Code).To(Equal(http.StatusCreated))
+		})
+
+		It("should only let admin keys change system presets", func() {
+			Expect(request(http.MethodPost, "/presets?system=true", teamA, `{"name": "1080p"}`).Code).To(Equal(http.StatusForbidden))
+
+			request(http.MethodPost, "/presets?system=true", "admin-secret", `{"name": "1080p"}`)
+			Expect(request(http.MethodPut, "/presets", teamA, `{"name": "1080p"}`).Code).To(Equal(http.StatusBadRequest))
+			Expect(request(http.MethodDelete, "/presets/1080p", teamA, "").Code).To(Equal(http.StatusBadRequest))
+			Expect(request(http.MethodDelete, "/presets/1080p?system=true", "admin-secret", "").Code).To(Equal(http.StatusOK))
+		})
+	})
+
+	Describe("jobs", func() {
+		var job types.Job
+
+		BeforeEach(func() {
+			request(http.MethodPost, "/presets", teamA, `{"name": "720p"}`)
+			recorder := request(http.MethodPost, "/jobs", teamA, `{"source": "http://source.here.mp4", "destination": "s3://dst", "preset": "720p"}`)
+			json.Unmarshal(recorder.Body.Bytes(), &job)
+		})
+
+		It("should own jobs by the tenant creating them", func() {
+			Expect(job.Owner).To(Equal("team-a"))
+		})
+
+		It("should only show jobs to their tenant", func() {
+			Expect(request(http.MethodGet, "/jobs/"+job.ID, teamA, "").Code).To(Equal(http.StatusOK))
+			Expect(request(http.MethodGet, "/jobs/"+job.ID, teamB, "").Code).To(Equal(http.StatusBadRequest))
+			Expect(request(http.MethodGet, "/jobs", teamB, "").Body.String()).To(Equal("[]"))
+			Expect(request(http.MethodGet, "/jobs/"+job.ID+"/events", teamB, "").Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("should not let other tenants change jobs", func() {
+			Expect(request(http.MethodPost, "/jobs/"+job.ID+"/start", teamB, "").Code).To(Equal(http.StatusBadRequest))
+			Expect(request(http.MethodPost, "/jobs/"+job.ID+"/source", teamB, "source").Code).To(Equal(http.StatusNotFound))
+			Expect(request(http.MethodDelete, "/jobs/"+job.ID, teamB, "").Code).To(Equal(http.StatusBadRequest))
+			Expect(request(http.MethodPost, "/jobs/"+job.ID+"/cancel", teamB, "").Code).To(Equal(http.StatusNotFound))
+
+			_, err := dbInstance.RetrieveJob(job.ID)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should not start jobs over the running jobs quota", func() {
+			newServer(`{"*": {"maxRunningJobs": 1}}`)
+			dbInstance.StoreJob(types.Job{ID: "running", Owner: "team-a", Status: types.JobEncoding})
+			dbInstance.StoreJob(types.Job{ID: "other", Owner: "team-b", Status: types.JobEncoding})
+
+			recorder := request(http.MethodPost, "/jobs/"+job.ID+"/start", teamA, "")
+			Expect(recorder.Code).To(Equal(http.StatusTooManyRequests))
+			Expect(recorder.Body.String()).To(ContainSubstring("1 jobs running of 1"))
+		})
+
+		It("should count queued and due jobs against the running jobs quota", func() {
+			newServer(`{"*": {"maxRunningJobs": 2}}`)
+			past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+			dbInstance.StoreJob(types.Job{ID: "queued", Owner: "team-a", Status: types.JobQueued})
+			dbInstance.StoreJob(types.Job{ID: "later", Owner: "team-a", Status: types.JobScheduled, StartAt: &future})
+			dbInstance.StoreJob(types.Job{ID: "due", Owner: "team-a", Status: types.JobScheduled, StartAt: &past})
+			recorder := request(http.MethodPost, "/jobs/"+job.ID+"/start", teamA, "")
+			Expect(recorder.Code).To(Equal(http.StatusTooManyRequests))
+			Expect(recorder.Body.String()).To(ContainSubstring("2 jobs running of 2"))
+		})
+
+		It("should not take sources over the storage quota", func() {
+			newServer(`{"team-a": {"maxStorageBytes": 10}}`)
+			os.MkdirAll(filepath.Join(swapDir, "old", "src"), 0700)
+			ioutil.WriteFile(filepath.Join(swapDir, "old", "src", "video.mp4"), []byte("12345678"), 0600)
+			dbInstance.StoreJob(types.Job{ID: "old", Owner: "team-a", Status: types.JobError})
+
+			recorder := request(http.MethodPost, "/jobs/"+job.ID+"/source", teamA, "source")
+			Expect(recorder.Code).To(Equal(http.StatusTooManyRequests))
+			Expect(recorder.Body.String()).To(ContainSubstring("8 bytes used of 10"))
+
+			Expect(request(http.MethodPost, "/jobs/"+job.ID+"/source", teamA, "s").Code).To(Equal(http.StatusCreated))
+		})
+	})
+
+	It("should refuse keys for the system tenant", func() {
+		recorder := request(http.MethodPost, "/apikeys", "admin-secret", `{"name": "x", "tenant": "system", "scopes": ["jobs:read"]}`)
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -0,0 +1,51 @@
+package types
+
+import "time"
+
+// These constants are the scopes an API key may be granted
+const (
+	ScopeReadJobs      = APIScope("jobs:read")
+	ScopeWriteJobs     = APIScope("jobs:write")
+	ScopeManagePresets = APIScope("presets:manage")
+	ScopeAdmin         = APIScope("admin")
+)
+
+// APIScope represents what an API key is allowed to do
+type APIScope string
+
+// Scopes lists every scope an API key may be granted
+var Scopes = []APIScope{ScopeReadJobs, ScopeWriteJobs, ScopeManagePresets, ScopeAdmin}
+
+// APIKey grants access to the API on the given scopes, acting on
+// the jobs and presets of its tenant. Only the hash of the key is
+// stored; the key itself is handed out once, when it's created.
+type APIKey struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Tenant    string     `json:"tenant,omitempty"`
+	Scopes    []APIScope `json:"scopes"`
+	Key       string     `json:"key,omitempty"`
+	Hash      string     `json:"hash,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// Allows tells if the key was granted the scope, which the
+// admin scope grants as well
+func (k APIKey) Allows(scope APIScope) bool {
+	for _, granted := range k.Scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidScope tells if the scope is one of the known ones
+func ValidScope(scope APIScope) bool {
+	for _, known := range Scopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
@@ -1,13 +1,22 @@
 package types
 
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
 // These constants are used on the status field of Job type
 const (
 	JobCreated     = JobStatus("created")
+	JobScheduled   = JobStatus("scheduled")
+	JobQueued      = JobStatus("queued")
 	JobDownloading = JobStatus("downloading")
 	JobEncoding    = JobStatus("encoding")
 	JobUploading   = JobStatus("uploading")
 	JobFinished    = JobStatus("finished")
 	JobError       = JobStatus("error")
+	JobCanceled    = JobStatus("canceled")
 )
 
 // JobStatus represents the status of a job
@@ -15,21 +24,243 @@ type JobStatus string
 
 // Job is the set of parameters of a given job
 type Job struct {
-	ID               string    `json:"id"`
-	Source           string    `json:"source"`
-	Destination      string    `json:"destination"`
-	Preset           Preset    `json:"preset"`
-	Status           JobStatus `json:"status"`
-	Details          string    `json:"details"`
-	Progress         string    `json:"progress"`
-	LocalSource      string    `json:"-"`
-	LocalDestination string    `json:"-"`
+	ID               string        `json:"id"`
+	Owner            string        `json:"owner,omitempty"`
+	Source           string        `json:"source"`
+	Destination      string        `json:"destination"`
+	Preset           Preset        `json:"preset"`
+	Status           JobStatus     `json:"status"`
+	Priority         int           `json:"priority"`
+	Details          string        `json:"details"`
+	Progress         Progress      `json:"progressDetails"`
+	ProgressText     string        `json:"progress"`
+	SourceChecksum   string        `json:"sourceChecksum,omitempty"`
+	Manifest         bool          `json:"manifest,omitempty"`
+	Outputs          []OutputFile  `json:"outputs,omitempty"`
+	Upload           *SourceUpload `json:"upload,omitempty"`
+	CreatedAt        time.Time     `json:"createdAt"`
+	StartAt          *time.Time    `json:"startAt,omitempty"`
+	StartedAt        *time.Time    `json:"startedAt,omitempty"`
+	FinishedAt       *time.Time    `json:"finishedAt,omitempty"`
+	Duration         float64       `json:"duration,omitempty"`
+	Stages           []StageTiming `json:"stages,omitempty"`
+	Lease            *JobLease     `json:"lease,omitempty"`
+	LocalSource      string        `json:"-"`
+	LocalDestination string        `json:"-"`
+
+	// Version is bumped on every update, which only succeeds
+	// if it was made on top of the stored version
+	Version int64 `json:"version"`
+
+	// EstimatedTimeRemaining is filled in by the API from the
+	// progress rate of the current stage, it isn't stored
+	EstimatedTimeRemaining *float64 `json:"estimatedTimeRemaining,omitempty" bson:"-"`
+}
+
+// JobLease is held by the worker running a job, which renews it
+// until the job is done. Other workers may take over expired leases.
+type JobLease struct {
+	Worker    string    `json:"worker"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// These constants are the stages a job goes through
+const (
+	StageDownload = JobStage("download")
+	StageEncode   = JobStage("encode")
+	StageUpload   = JobStage("upload")
+)
+
+// JobStage represents a stage of the pipeline
+type JobStage string
+
+// StageTiming records when a stage of the job ran. Durations
+// are in seconds.
+type StageTiming struct {
+	Stage      JobStage   `json:"stage"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Duration   float64    `json:"duration,omitempty"`
+}
+
+// CurrentStage returns the timing of the stage running now,
+// if there is one
+func (j Job) CurrentStage() *StageTiming {
+	if len(j.Stages) == 0 || j.Stages[len(j.Stages)-1].FinishedAt != nil {
+		return nil
+	}
+	return &j.Stages[len(j.Stages)-1]
+}
+
+// EstimateTimeRemaining tells how long the current stage will
+// take, from its speed when known or else extrapolating how much of
+// it was done since it started. It returns false while there is no
+// progress to estimate from.
+func (j Job) EstimateTimeRemaining(now time.Time) (time.Duration, bool) {
+	stage := j.CurrentStage()
+	if stage == nil || j.Progress.Stage != stage.Stage {
+		return 0, false
+	}
+
+	p := j.Progress
+	if p.Speed > 0 && p.Total > 0 {
+		return time.Duration(float64(p.Total-p.Processed) / p.Speed * float64(time.Second)), true
+	}
+	if p.StagePercent <= 0 || p.StagePercent > 100 {
+		return 0, false
+	}
+
+	elapsed := now.Sub(stage.StartedAt)
+	return time.Duration(float64(elapsed) * (100 - p.StagePercent) / p.StagePercent), true
+}
+
+// StartDue tells whether a scheduled job may start at the given
+// time, which is once its start time came and its uploaded source,
+// if it has one, is complete
+func (j Job) StartDue(now time.Time) bool {
+	if j.Status != JobScheduled || (j.StartAt != nil && j.StartAt.After(now)) {
+		return false
+	}
+	return j.Upload == nil || j.Upload.Complete
+}
+
+// SetProgress sets the progress of the job along with the
+// progress string kept for older API clients
+func (j *Job) SetProgress(progress Progress) {
+	j.Progress = progress
+	j.ProgressText = fmt.Sprintf("%.2f%%", progress.Percent)
+}
+
+// These constants are the units of Progress
+const (
+	ProgressBytes  = "bytes"
+	ProgressFrames = "frames"
+)
+
+// StageWeights is how much of the overall progress each stage
+// accounts for
+var StageWeights = []struct {
+	Stage  JobStage
+	Weight float64
+}{
+	{StageDownload, 10},
+	{StageEncode, 80},
+	{StageUpload, 10},
+}
+
+// Progress tells how far the job is. Percentages go from 0 to
+// 100 and the speed is in units per second.
+type Progress struct {
+	Stage        JobStage `json:"stage,omitempty"`
+	StagePercent float64  `json:"stagePercent"`
+	Percent      float64  `json:"percent"`
+	Processed    int64    `json:"processed,omitempty"`
+	Total        int64    `json:"total,omitempty"`
+	Unit         string   `json:"unit,omitempty"`
+	Speed        float64  `json:"speed,omitempty"`
+}
+
+// NewProgress builds the progress of a stage that processed part
+// of a total, which may be unknown (zero)
+func NewProgress(stage JobStage, processed int64, total int64, unit string, speed float64) Progress {
+	stagePercent := float64(0)
+	if total > 0 {
+		stagePercent = math.Min(float64(processed)*100/float64(total), 100)
+	}
+
+	return Progress{
+		Stage:        stage,
+		StagePercent: stagePercent,
+		Percent:      overallPercent(stage, stagePercent),
+		Processed:    processed,
+		Total:        total,
+		Unit:         unit,
+		Speed:        speed,
+	}
+}
+
+// CompletedProgress is the progress of a stage that is done
+func CompletedProgress(stage JobStage) Progress {
+	return Progress{Stage: stage, StagePercent: 100, Percent: overallPercent(stage, 100)}
+}
+
+func overallPercent(stage JobStage, stagePercent float64) float64 {
+	done := float64(0)
+	for _, w := range StageWeights {
+		if w.Stage == stage {
+			return math.Min(done+w.Weight*stagePercent/100, 100)
+		}
+		done += w.Weight
+	}
+	return done
+}
+
+// OutputFile describes a file uploaded to the job destination
+type OutputFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	MD5    string `json:"md5"`
+	SHA256 string `json:"sha256"`
+	ETag   string `json:"etag,omitempty"`
+}
+
+// SourceUpload tracks a source sent straight to Snickers
+// instead of being downloaded
+type SourceUpload struct {
+	Filename string `json:"filename"`
+	Length   int64  `json:"length"`
+	Offset   int64  `json:"offset"`
+	Complete bool   `json:"complete"`
 }
 
 // JobInput stores the information passed from the
 // user when creating a job.
 type JobInput struct {
-	Source      string `json:"source"`
-	Destination string `json:"destination"`
-	PresetName  string `json:"preset"`
+	Source         string `json:"source"`
+	Destination    string `json:"destination"`
+	PresetName     string `json:"preset"`
+	SourceChecksum string `json:"sourceChecksum,omitempty"`
+	Manifest       bool   `json:"manifest,omitempty"`
+
+	// Priority orders the jobs waiting to run, higher first
+	Priority int `json:"priority,omitempty"`
+
+	// StartAt starts the job at the given time, and AutoStart
+	// right after it's created
+	StartAt   *time.Time `json:"startAt,omitempty"`
+	AutoStart bool       `json:"autoStart,omitempty"`
+
+	// Owner is the tenant creating the job, set by the caller
+	Owner string `json:"-"`
+}
+
+// These constants are the orders accepted by JobQuery. A leading
+// dash sorts descending; ties are broken by the job ID.
+const (
+	SortByCreatedAt     = "createdAt"
+	SortByCreatedAtDesc = "-createdAt"
+	SortByID            = "id"
+	SortByIDDesc        = "-id"
+)
+
+// JobQuery filters, sorts and paginates a job listing. Zero
+// values are ignored, but for Owner where it's the default tenant.
+type JobQuery struct {
+	Owner         string // tenant of the jobs, or AnyOwner
+	Status        JobStatus
+	PresetName    string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Source        string // substring of the source
+	Destination   string // substring of the destination
+	Sort          string
+	Limit         int
+	Cursor        string // NextCursor of the previous page
+}
+
+// JobPage is a page of a job listing. NextCursor is empty on
+// the last page.
+type JobPage struct {
+	Jobs       []Job  `json:"jobs"`
+	NextCursor string `json:"nextCursor,omitempty"`
 }
@@ -3,11 +3,16 @@ package types
 // Preset define the set of parameters of a given preset
 type Preset struct {
 	Name        string      `json:"name,omitempty"`
+	Owner       string      `json:"owner,omitempty"`
 	Description string      `json:"description,omitempty"`
 	Container   string      `json:"container,omitempty"`
 	RateControl string      `json:"rateControl,omitempty"`
 	Video       VideoPreset `json:"video"`
 	Audio       AudioPreset `json:"audio"`
+
+	// Version is bumped on every update, which only succeeds
+	// if it was made on top of the stored version
+	Version int64 `json:"version"`
 }
 
 // VideoPreset define the set of parameters for video on a given preset
@@ -21,6 +26,10 @@ type VideoPreset struct {
 	Profile       string `json:"profile,omitempty"`
 	ProfileLevel  string `json:"profileLevel,omitempty"`
 	InterlaceMode string `json:"interlaceMode,omitempty"`
+
+	// Chunks splits long videos in up to this many parts
+	// encoded in parallel
+	Chunks int `json:"chunks,omitempty"`
 }
 
 // AudioPreset define the set of parameters for audio on a given preset
@@ -0,0 +1,27 @@
+package types
+
+// SystemOwner owns the presets every tenant can use. Only admin
+// API keys may change them.
+const SystemOwner = "system"
+
+// AnyOwner queries the jobs of every tenant. Jobs and presets
+// without an owner belong to the default tenant, used when
+// authentication is off.
+const AnyOwner = "*"
+
+// Quota limits what the jobs of a tenant may use. Zero means
+// unlimited.
+type Quota struct {
+	// MaxRunningJobs is how many jobs may be queued, due to start,
+	// downloading, encoding or uploading at once
+	MaxRunningJobs int `json:"maxRunningJobs"`
+
+	// MaxStorageBytes is how much of the swap directory the
+	// sources and outputs of unfinished jobs may take
+	MaxStorageBytes int64 `json:"maxStorageBytes"`
+}
+
+// ValidTenant tells if a tenant may be given to API keys
+func ValidTenant(tenant string) bool {
+	return tenant != SystemOwner && tenant != AnyOwner
+}
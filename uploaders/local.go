@@ -0,0 +1,182 @@
+package uploaders
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/flavioribeiro/gonfig"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/events"
+	"github.com/snickers/snickers/helpers"
+	"github.com/snickers/snickers/types"
+)
+
+// LocalUpload keeps the outputs on LOCAL_OUTPUT_DIRECTORY so Snickers
+// can serve them on /jobs/{jobID}/outputs/. Job Destination should be
+// in format: local://
+func LocalUpload(logger lager.Logger, config gonfig.Gonfig, dbInstance db.Storage, jobID string) error {
+	log := logger.Session("local-upload")
+	log.Info("start", lager.Data{"job": jobID})
+	defer log.Info("finished")
+
+	job, err := db.ModifyJob(dbInstance, jobID, func(job *types.Job) error {
+		job.Status = types.JobUploading
+		job.Outputs = nil
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	events.PublishJob(events.JobStatusChanged, job)
+
+	outputDir, err := helpers.GetLocalOutputDirectory(config)
+	if err != nil {
+		return err
+	}
+
+	jobDir := filepath.Join(outputDir, job.ID)
+	if err := os.MkdirAll(jobDir, 0700); err != nil {
+		return err
+	}
+
+	fileInfo, err := os.Stat(job.LocalDestination)
+	if err != nil {
+		return err
+	}
+
+	base := filepath.Base(job.LocalDestination)
+	files := []string{base}
+	if fileInfo.IsDir() {
+		if err := os.MkdirAll(filepath.Join(jobDir, base), 0700); err != nil {
+			return err
+		}
+		entries, err := ioutil.ReadDir(job.LocalDestination)
+		if err != nil {
+			return err
+		}
+		files = []string{}
+		for _, entry := range entries {
+			files = append(files, path.Join(base, entry.Name()))
+		}
+	}
+
+	for _, file := range files {
+		target := filepath.Join(jobDir, filepath.FromSlash(file))
+		if err := moveFile(filepath.Join(filepath.Dir(job.LocalDestination), filepath.FromSlash(file)), target); err != nil {
+			log.Error("moving-output-failed", err, lager.Data{"file": file})
+			return err
+		}
+
+		output, err := newOutputFile(target, GetLocalOutputPath(job.ID, file))
+		if err != nil {
+			return err
+		}
+		job.Outputs = append(job.Outputs, output)
+	}
+
+	if job.Manifest {
+		manifest, err := buildManifest(job)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(manifestPath(filepath.Join(jobDir, base), fileInfo.IsDir()), manifest, 0600); err != nil {
+			log.Error("writing-manifest-failed", err)
+			return err
+		}
+	}
+
+	// retention counts from the moment the outputs are ready
+	now := time.Now()
+	os.Chtimes(jobDir, now, now)
+
+	return storeOutputs(dbInstance, job.ID, job.Outputs)
+}
+
+// GetLocalOutputPath returns the URL path serving a local output
+func GetLocalOutputPath(jobID string, file string) string {
+	return path.Join("/jobs", jobID, "outputs", file)
+}
+
+// StartLocalRetention removes local outputs older than
+// LOCAL_OUTPUT_RETENTION_HOURS in background. Outputs are kept
+// forever if it isn't set.
+func StartLocalRetention(logger lager.Logger, config gonfig.Gonfig) error {
+	hours, err := config.GetInt("LOCAL_OUTPUT_RETENTION_HOURS", 0)
+	if err != nil || hours <= 0 {
+		return err
+	}
+
+	retention := time.Duration(hours) * time.Hour
+	go func() {
+		for {
+			ExpireLocalOutputs(logger, config, retention)
+			time.Sleep(time.Minute)
+		}
+	}()
+	return nil
+}
+
+// ExpireLocalOutputs removes the local outputs of jobs finished
+// more than retention ago
+func ExpireLocalOutputs(logger lager.Logger, config gonfig.Gonfig, retention time.Duration) error {
+	log := logger.Session("expire-local-outputs")
+
+	outputDir, err := helpers.GetLocalOutputDirectory(config)
+	if err != nil {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(outputDir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		log.Error("listing-outputs-failed", err)
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || time.Since(entry.ModTime()) < retention {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(outputDir, entry.Name())); err != nil {
+			log.Error("removing-outputs-failed", err, lager.Data{"job": entry.Name()})
+			continue
+		}
+		log.Info("removed-outputs", lager.Data{"job": entry.Name()})
+	}
+	return nil
+}
+
+// moveFile renames src to dst, copying it over when they
+// are on different filesystems
+func moveFile(src string, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
@@ -0,0 +1,73 @@
+package uploaders
+
+import (
+	"encoding/json"
+	"path"
+
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/events"
+	"github.com/snickers/snickers/helpers"
+	"github.com/snickers/snickers/types"
+)
+
+// Manifest is the JSON document uploaded next to the outputs
+// when the job asks for it
+type Manifest struct {
+	JobID       string             `json:"jobId"`
+	Source      string             `json:"source"`
+	Destination string             `json:"destination"`
+	Preset      string             `json:"preset"`
+	Outputs     []types.OutputFile `json:"outputs"`
+}
+
+// storeOutputs records the uploaded outputs on the job, along
+// with the upload stage being complete
+func storeOutputs(dbInstance db.Storage, jobID string, outputs []types.OutputFile) error {
+	job, err := db.ModifyJob(dbInstance, jobID, func(job *types.Job) error {
+		job.Outputs = outputs
+		job.SetProgress(types.CompletedProgress(types.StageUpload))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	events.PublishJob(events.JobProgressChanged, job)
+	return nil
+}
+
+// newOutputFile computes the size and checksums of a local file
+// that is going to be uploaded to remotePath
+func newOutputFile(localPath string, remotePath string) (types.OutputFile, error) {
+	md5sum, sha256sum, size, err := helpers.FileDigests(localPath)
+	if err != nil {
+		return types.OutputFile{}, err
+	}
+
+	return types.OutputFile{
+		Path:   remotePath,
+		Size:   size,
+		MD5:    md5sum,
+		SHA256: sha256sum,
+	}, nil
+}
+
+// buildManifest returns the manifest contents for a given job
+func buildManifest(job types.Job) ([]byte, error) {
+	return json.MarshalIndent(Manifest{
+		JobID:       job.ID,
+		Source:      job.Source,
+		Destination: job.Destination,
+		Preset:      job.Preset.Name,
+		Outputs:     job.Outputs,
+	}, "", "  ")
+}
+
+// manifestPath returns where the manifest is stored for a
+// given output path. Directory outputs, like HLS playlists, keep
+// it inside the directory, next to the files it lists.
+func manifestPath(outputPath string, isDir bool) string {
+	if isDir {
+		return path.Join(outputPath, "manifest.json")
+	}
+	return outputPath + ".manifest.json"
+}
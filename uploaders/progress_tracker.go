@@ -1,58 +1,74 @@
 package uploaders
 
 import (
-	"fmt"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/events"
 	"github.com/snickers/snickers/types"
 )
 
+// ProgressTracker reports the progress of an upload on its own
+// copy of the job, so the uploader may keep changing the original
 type ProgressTracker struct {
 	current int64
 	Total   int64
 
-	job *types.Job
-	db  db.Storage
+	mtx      sync.Mutex
+	job      types.Job
+	progress *db.ProgressWriter
 
 	finishOnce sync.Once
 	finish     chan struct{}
-	isFinish   bool
+	refreshing sync.WaitGroup
 
 	startValue   int64
+	startTime    time.Time
 	currentValue int64
 }
 
 func (pt *ProgressTracker) Start() *ProgressTracker {
 	pt.startValue = pt.current
+	pt.startTime = time.Now()
 	pt.Update()
+	pt.refreshing.Add(1)
 	go pt.refresher()
 	return pt
 }
 
+// Finish stops the refresher, waiting for it to exit, and writes
+// the last progress
 func (pt *ProgressTracker) Finish() {
 	pt.finishOnce.Do(func() {
 		close(pt.finish)
-		pt.isFinish = true
+		pt.refreshing.Wait()
+		pt.Update()
+		pt.progress.Flush()
 	})
 }
 
-func (pt *ProgressTracker) Update() {
+// Update reports the current progress, and tells if the upload
+// is complete
+func (pt *ProgressTracker) Update() bool {
+	pt.mtx.Lock()
+	defer pt.mtx.Unlock()
+
 	c := atomic.LoadInt64(&pt.current)
 	if c != pt.currentValue {
 		pt.currentValue = c
 	}
 
-	percent := (float64(c) / float64(pt.Total)) * float64(100)
-
-	pt.job.Progress = fmt.Sprintf("%6.02f%%", percent)
-	pt.db.UpdateJob(pt.job.ID, *pt.job)
-
-	if c >= pt.Total && pt.isFinish != true {
-		pt.Finish()
+	speed := float64(0)
+	if elapsed := time.Since(pt.startTime).Seconds(); elapsed > 0 {
+		speed = float64(c-pt.startValue) / elapsed
 	}
+
+	pt.job.SetProgress(types.NewProgress(types.StageUpload, c, pt.Total, types.ProgressBytes, speed))
+	pt.progress.Update(pt.job.Progress)
+	events.PublishJob(events.JobProgressChanged, pt.job)
+	return c >= pt.Total
 }
 
 func (pt *ProgressTracker) Get() int64 {
@@ -100,21 +116,26 @@ func NewProgressTracker(total int, job *types.Job, dbInstance db.Storage) *Progr
 func NewProgressTracker64(total int64, job *types.Job, dbInstance db.Storage) *ProgressTracker {
 	pt := &ProgressTracker{
 		Total:        total,
-		job:          job,
+		job:          *job,
 		currentValue: -1,
-		db:           dbInstance,
+		progress:     db.NewProgressWriter(dbInstance, job.ID),
 		finish:       make(chan struct{}),
 	}
 	return pt
 }
 
+// refresher updates the progress until the upload is complete
+// or the tracker is finished
 func (pt *ProgressTracker) refresher() {
+	defer pt.refreshing.Done()
 	for {
 		select {
 		case <-pt.finish:
 			return
 		case <-time.After(time.Millisecond * 200):
-			pt.Update()
+			if pt.Update() {
+				return
+			}
 		}
 	}
 }
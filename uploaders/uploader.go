@@ -4,18 +4,21 @@ import (
 	"strings"
 
 	"code.cloudfoundry.org/lager"
+	"github.com/flavioribeiro/gonfig"
 	"github.com/snickers/snickers/db"
 )
 
 // UploadFunc is a function type for the multiple
 // possible ways to upload the source file
-type UploadFunc func(logger lager.Logger, dbInstance db.Storage, jobID string) error
+type UploadFunc func(logger lager.Logger, config gonfig.Gonfig, dbInstance db.Storage, jobID string) error
 
 // GetUploadFunc returns the upload function
 // based on the job source.
 func GetUploadFunc(jobDestination string) UploadFunc {
-	if strings.HasPrefix(jobDestination, "ftp://") {
+	if strings.HasPrefix(jobDestination, "ftp://") || strings.HasPrefix(jobDestination, "ftps://") {
 		return FTPUpload
+	} else if strings.HasPrefix(jobDestination, "local://") {
+		return LocalUpload
 	}
 
 	return S3Upload
@@ -0,0 +1,321 @@
+package watcher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/flavioribeiro/gonfig"
+	"github.com/snickers/snickers/db"
+	"github.com/snickers/snickers/pipeline"
+	"github.com/snickers/snickers/types"
+)
+
+// Folders that receive the sources once their jobs are done
+const (
+	ProcessedFolder = "processed"
+	FailedFolder    = "failed"
+)
+
+// defaultStableTime is how long a file size must stay the same
+// before it is considered completely written
+const defaultStableTime = 10 * time.Second
+
+// Folder is a directory watched for new sources, as set on
+// the WATCH_FOLDERS config. Its jobs belong to Owner, or to the
+// default tenant when it's empty.
+type Folder struct {
+	Directory     string   `json:"directory"`
+	Preset        string   `json:"preset"`
+	Presets       []string `json:"presets"`
+	Destination   string   `json:"destination"`
+	StableSeconds int      `json:"stableSeconds"`
+	Owner         string   `json:"owner"`
+}
+
+// Watcher polls a folder and creates and starts one job per
+// preset for every file that has finished being written
+type Watcher struct {
+	logger lager.Logger
+	config gonfig.Gonfig
+	db     db.Storage
+	folder Folder
+
+	mtx      sync.Mutex
+	pending  map[string]fileState
+	inFlight map[string]bool
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+type fileState struct {
+	size        int64
+	modTime     time.Time
+	stableSince time.Time
+}
+
+// GetFolders reads the watch folders from config
+func GetFolders(config gonfig.Gonfig) ([]Folder, error) {
+	raw, err := config.Get("WATCH_FOLDERS", nil)
+	if err != nil || raw == nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var folders []Folder
+	if err := json.Unmarshal(data, &folders); err != nil {
+		return nil, err
+	}
+
+	for _, folder := range folders {
+		if folder.Directory == "" || folder.Destination == "" || len(folder.presetNames()) == 0 {
+			return nil, errors.New("watch folders need a directory, a destination and at least one preset")
+		}
+		if folder.Owner != "" && !types.ValidTenant(folder.Owner) {
+			return nil, fmt.Errorf("watch folders can't be owned by %q", folder.Owner)
+		}
+	}
+	return folders, nil
+}
+
+// StartAll starts a watcher for every folder on config
+func StartAll(logger lager.Logger, config gonfig.Gonfig, dbInstance db.Storage) ([]*Watcher, error) {
+	folders, err := GetFolders(config)
+	if err != nil {
+		return nil, err
+	}
+
+	watchers := []*Watcher{}
+	for _, folder := range folders {
+		w := New(logger, config, dbInstance, folder)
+		if err := w.Start(); err != nil {
+			return nil, err
+		}
+		watchers = append(watchers, w)
+	}
+	return watchers, nil
+}
+
+// New returns a watcher for the given folder
+func New(logger lager.Logger, config gonfig.Gonfig, dbInstance db.Storage, folder Folder) *Watcher {
+	return &Watcher{
+		logger:   logger.Session("watcher", lager.Data{"directory": folder.Directory}),
+		config:   config,
+		db:       dbInstance,
+		folder:   folder,
+		pending:  map[string]fileState{},
+		inFlight: map[string]bool{},
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start creates the processed and failed folders and starts
+// polling the directory every second
+func (w *Watcher) Start() error {
+	for _, dir := range []string{ProcessedFolder, FailedFolder} {
+		if err := os.MkdirAll(filepath.Join(w.folder.Directory, dir), 0700); err != nil {
+			return err
+		}
+	}
+
+	w.logger.Info("started")
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				w.logger.Info("stopped")
+				return
+			case <-ticker.C:
+				w.Poll()
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops polling. Jobs already started keep running.
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+}
+
+// Poll scans the folder once and ingests the files whose size
+// didn't change for the configured stable time
+func (w *Watcher) Poll() {
+	log := w.logger.Session("poll")
+
+	entries, err := ioutil.ReadDir(w.folder.Directory)
+	if err != nil {
+		log.Error("listing-directory-failed", err)
+		return
+	}
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	now := time.Now()
+	present := map[string]bool{}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		filePath := filepath.Join(w.folder.Directory, entry.Name())
+		present[filePath] = true
+		if w.inFlight[filePath] {
+			continue
+		}
+
+		state, ok := w.pending[filePath]
+		if !ok || state.size != entry.Size() || !state.modTime.Equal(entry.ModTime()) {
+			w.pending[filePath] = fileState{size: entry.Size(), modTime: entry.ModTime(), stableSince: now}
+			continue
+		}
+
+		if now.Sub(state.stableSince) >= w.stableTime() {
+			delete(w.pending, filePath)
+			w.inFlight[filePath] = true
+			go w.ingest(filePath)
+		}
+	}
+
+	for filePath := range w.pending {
+		if !present[filePath] {
+			delete(w.pending, filePath)
+		}
+	}
+}
+
+// ingest creates and starts the jobs for a source and moves
+// it away once all of them are done
+func (w *Watcher) ingest(filePath string) {
+	log := w.logger.Session("ingest", lager.Data{"file": filePath})
+	log.Info("started")
+	defer log.Info("finished")
+
+	// the source stays in place for the next process, or for the
+	// next poll once draining is over
+	if pipeline.Jobs.Draining() {
+		log.Info("skipped-while-draining")
+		w.clearInFlight(filePath)
+		return
+	}
+
+	jobs := []types.Job{}
+	for _, presetName := range w.folder.presetNames() {
+		job, err := pipeline.CreateJob(w.db, types.JobInput{
+			Source:      (&url.URL{Scheme: "file", Path: filePath}).String(),
+			Destination: w.folder.Destination,
+			PresetName:  presetName,
+			Owner:       w.folder.Owner,
+		})
+		if err != nil {
+			log.Error("creating-job-failed", err, lager.Data{"preset": presetName})
+			w.deleteJobs(log, jobs)
+			w.moveSource(log, filePath, FailedFolder)
+			return
+		}
+		log.Info("created-job", lager.Data{"id": job.ID, "preset": presetName})
+		jobs = append(jobs, job)
+	}
+
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job types.Job) {
+			defer wg.Done()
+			pipeline.StartJob(log, w.config, w.db, job)
+		}(job)
+	}
+	wg.Wait()
+	w.settle(log, filePath, jobs)
+}
+
+// settle moves the source to the processed folder once all of its
+// jobs finished, or to the failed one. Jobs left unstarted by a
+// drain are canceled, and the source stays in place to be picked up
+// again by the next process.
+func (w *Watcher) settle(log lager.Logger, filePath string, jobs []types.Job) {
+	destination := ProcessedFolder
+	unstarted := []types.Job{}
+	for _, job := range jobs {
+		result, err := w.db.RetrieveJob(job.ID)
+		if err == nil && (result.Status == types.JobCreated || result.Status == types.JobQueued) {
+			unstarted = append(unstarted, result)
+		} else if err != nil || result.Status != types.JobFinished {
+			destination = FailedFolder
+		}
+	}
+
+	if len(unstarted) > 0 {
+		log.Info("not-started-while-draining", lager.Data{"jobs": len(unstarted)})
+		for _, job := range unstarted {
+			if _, err := pipeline.CancelJob(w.db, job.ID); err != nil {
+				log.Error("canceling-job-failed", err, lager.Data{"id": job.ID})
+			}
+		}
+		w.clearInFlight(filePath)
+		return
+	}
+	w.moveSource(log, filePath, destination)
+}
+
+// deleteJobs deletes the jobs created for a source that couldn't
+// get all of its jobs, so none of them is left behind
+func (w *Watcher) deleteJobs(log lager.Logger, jobs []types.Job) {
+	for _, job := range jobs {
+		if _, err := w.db.DeleteJob(job.ID); err != nil {
+			log.Error("deleting-job-failed", err, lager.Data{"id": job.ID})
+		}
+	}
+}
+
+// clearInFlight lets the next poll pick the source up again
+func (w *Watcher) clearInFlight(filePath string) {
+	w.mtx.Lock()
+	delete(w.inFlight, filePath)
+	w.mtx.Unlock()
+}
+
+// moveSource moves the source to the processed or failed folder.
+// Sources that can't be moved stay flagged as in flight, otherwise
+// they would be picked up again on the next poll.
+func (w *Watcher) moveSource(log lager.Logger, filePath string, folder string) {
+	target := filepath.Join(w.folder.Directory, folder, filepath.Base(filePath))
+	if err := os.Rename(filePath, target); err != nil {
+		log.Error("moving-source-failed", err, lager.Data{"target": target})
+		return
+	}
+	log.Info("moved-source", lager.Data{"target": target})
+	w.clearInFlight(filePath)
+}
+
+func (w *Watcher) stableTime() time.Duration {
+	if w.folder.StableSeconds <= 0 {
+		return defaultStableTime
+	}
+	return time.Duration(w.folder.StableSeconds) * time.Second
+}
+
+func (f Folder) presetNames() []string {
+	if f.Preset != "" {
+		return append([]string{f.Preset}, f.Presets...)
+	}
+	return f.Presets
+}